@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// -------------------- interactive browsing of search results --------------------
+
+// prefix of the command browsing the results of a search: browse <searchtype> <searchfield> <search value>
+const browsePrefix = "browse"
+
+// errNoTerminal is returned when browsing (or starting the full-screen UI) without a terminal to read keys from
+var errNoTerminal = errors.New("This command needs a terminal")
+
+// browseView is a list of records being stepped through: the results of a search, or records reached from them
+type browseView struct {
+	Title    string
+	Records  []interface{} // Organization, User or Ticket records, with their associated records
+	Position int
+	Expanded bool // whether associated records are listed, or only counted
+}
+
+// Browser steps through records one at a time, following the links between them. Following a link opens a new view,
+// and going back returns to the previous one.
+type Browser struct {
+	data    *Dataset
+	keys    *LineEditor
+	out     io.Writer
+	views   []*browseView
+	message string // shown below the record until the next key
+}
+
+// parseBrowseCommand returns the search to browse, and whether the input is a browse command
+func parseBrowseCommand(input string) (string, bool) {
+	fields := strings.SplitN(strings.TrimSpace(input), " ", 2)
+	if strings.ToLower(fields[0]) != browsePrefix {
+		return "", false
+	}
+	if len(fields) < 2 {
+		return "", true
+	}
+
+	return strings.TrimSpace(fields[1]), true
+}
+
+// NewBrowser returns a browser over the dataset, reading keys with the line editor
+func NewBrowser(data *Dataset, keys *LineEditor, out io.Writer) *Browser {
+	return &Browser{data: data, keys: keys, out: out}
+}
+
+// searchRecords returns the records of a search result
+func searchRecords(result SearchResult) []interface{} {
+	records := []interface{}{}
+	for _, org := range result.Orgs {
+		records = append(records, org)
+	}
+	for _, user := range result.Users {
+		records = append(records, user)
+	}
+	for _, ticket := range result.Tickets {
+		records = append(records, ticket)
+	}
+
+	return records
+}
+
+// Browse steps through records until the user quits
+func (browser *Browser) Browse(title string, records []interface{}) error {
+	if len(records) <= 0 {
+		return errors.New("No results to browse")
+	}
+
+	restore, err := browser.keys.rawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	browser.views = []*browseView{{Title: title, Records: records}}
+	for {
+		browser.render()
+		browser.message = ""
+
+		key, err := browser.keys.readKey()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if key == "q" || key == "Q" || key == "ctrl-c" {
+			fmt.Fprint(browser.out, "\r\n")
+			return nil
+		}
+
+		browser.handleKey(key)
+	}
+}
+
+// handleKey moves through the records, expands or collapses associated records, or follows a link
+func (browser *Browser) handleKey(key string) {
+	view := browser.views[len(browser.views)-1]
+
+	switch key {
+	case "n", "j", "right", "down", " ":
+		if view.Position < len(view.Records)-1 {
+			view.Position++
+		} else {
+			browser.message = "Last record"
+		}
+	case "p", "k", "left", "up":
+		if view.Position > 0 {
+			view.Position--
+		} else {
+			browser.message = "First record"
+		}
+	case "home", "g":
+		view.Position = 0
+	case "end", "G":
+		view.Position = len(view.Records) - 1
+
+	case "e", "enter":
+		view.Expanded = !view.Expanded
+
+	case "b", "backspace", "esc":
+		if len(browser.views) > 1 {
+			browser.views = browser.views[:len(browser.views)-1]
+		} else {
+			browser.message = "Already at the search results"
+		}
+
+	default:
+		title, records := linkedRecords(browser.data, view.Records[view.Position], key)
+		if title == "" {
+			browser.message = fmt.Sprintf("Unknown key %q", key)
+			return
+		}
+		if len(records) <= 0 {
+			browser.message = "No " + title
+			return
+		}
+		browser.views = append(browser.views, &browseView{Title: title, Records: records})
+	}
+}
+
+// linkedRecords returns the records reached from a record with a key, with their associated records and a title for them
+// (empty if the key isn't a link). Tickets link to their org (o), submitter (s) and assignee (a), users to their org (o),
+// submitted (s) and assigned (a) tickets, and orgs to their users (u) and tickets (t).
+func linkedRecords(data *Dataset, record interface{}, key string) (string, []interface{}) {
+	records := []interface{}{}
+
+	switch record := record.(type) {
+	case Ticket:
+		var userID int
+		switch key {
+		case "o":
+			if org, found := data.GetOrg(record.Org); found {
+				records = append(records, getAssociatedUsersAndTickets([]Organization{org}, data.OrgUserIndex, data.OrgTicketIndex)[0])
+			}
+			return fmt.Sprintf("org of ticket %s", record.ID), records
+		case "s":
+			userID = record.Submitter
+		case "a":
+			userID = record.Assignee
+		default:
+			return "", nil
+		}
+
+		if user, found := data.GetUser(userID); found {
+			records = append(records, getAssociatedOrgsAndTickets([]User{user}, data.OrgIndex, data.UserSubmittedTixIndex, data.UserAssignedTixIndex)[0])
+		}
+		return fmt.Sprintf("%s of ticket %s", map[string]string{"s": "submitter", "a": "assignee"}[key], record.ID), records
+
+	case User:
+		var tickets []Ticket
+		switch key {
+		case "o":
+			if org, found := data.GetOrg(record.Org); found {
+				records = append(records, getAssociatedUsersAndTickets([]Organization{org}, data.OrgUserIndex, data.OrgTicketIndex)[0])
+			}
+			return fmt.Sprintf("org of user %d", record.ID), records
+		case "s":
+			tickets = record.TicketsSubmitted
+		case "a":
+			tickets = record.TicketsAssigned
+		default:
+			return "", nil
+		}
+
+		for _, ticket := range getAssociatedUsersAndOrgs(tickets, data.UserIndex, data.OrgIndex) {
+			records = append(records, ticket)
+		}
+		return fmt.Sprintf("tickets %s by user %d", map[string]string{"s": "submitted", "a": "assigned"}[key], record.ID), records
+
+	case Organization:
+		switch key {
+		case "u":
+			for _, user := range getAssociatedOrgsAndTickets(record.AssociatedUsers, data.OrgIndex, data.UserSubmittedTixIndex, data.UserAssignedTixIndex) {
+				records = append(records, user)
+			}
+			return fmt.Sprintf("users of org %d", record.ID), records
+		case "t":
+			for _, ticket := range getAssociatedUsersAndOrgs(record.AssociatedTickets, data.UserIndex, data.OrgIndex) {
+				records = append(records, ticket)
+			}
+			return fmt.Sprintf("tickets of org %d", record.ID), records
+		}
+	}
+
+	return "", nil
+}
+
+// render clears the screen and shows the current record, its associated records and the keys
+func (browser *Browser) render() {
+	view := browser.views[len(browser.views)-1]
+	titles := []string{}
+	for _, view := range browser.views {
+		titles = append(titles, view.Title)
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H\x1b[2J")
+	heading := fmt.Sprintf("BROWSE: %s [%d/%d]", strings.Join(titles, " > "), view.Position+1, len(view.Records))
+	screen.WriteString(heading + "\n" + strings.Repeat("-", len(heading)) + "\n")
+	screen.WriteString(formatRecordFields(view.Records[view.Position]))
+	screen.WriteString("\n" + formatBrowseLinks(view.Records[view.Position], view.Expanded))
+
+	screen.WriteString("\nn/p: next/previous  e: expand/collapse  " + browseLinkKeys(view.Records[view.Position]) + "  b: back  q: quit\n")
+	if browser.message != "" {
+		screen.WriteString(browser.message + "\n")
+	}
+
+	// in raw mode, newlines may not return the cursor to the start of the line
+	fmt.Fprint(browser.out, strings.Replace(screen.String(), "\n", "\r\n", -1))
+}
+
+// formatRecordFields lists the data fields and custom attributes of a record
+func formatRecordFields(record interface{}) string {
+	var formatted strings.Builder
+	value := reflect.ValueOf(record)
+	for i := 0; i < value.NumField(); i++ {
+		if tag := value.Type().Field(i).Tag.Get("json"); tag != "" && tag != "-" {
+			formatted.WriteString(fmt.Sprintf("%-16s %v\n", value.Type().Field(i).Name+":", value.Field(i).Interface()))
+		}
+	}
+
+	formatted.WriteString(formatCustomAttributes(value.FieldByName("Custom").Interface().(CustomAttributes), ""))
+	return formatted.String()
+}
+
+// recordLinkKeys returns the keys following the links of a record, in the order formatBrowseLinks lists them
+func recordLinkKeys(record interface{}) []string {
+	if _, isOrg := record.(Organization); isOrg {
+		return []string{"u", "t"}
+	}
+
+	return []string{"o", "s", "a"}
+}
+
+// browseLinkKeys describes the keys following the links of a record
+func browseLinkKeys(record interface{}) string {
+	switch record.(type) {
+	case Ticket:
+		return "o: org  s: submitter  a: assignee"
+	case User:
+		return "o: org  s: submitted tickets  a: assigned tickets"
+	default:
+		return "u: users  t: tickets"
+	}
+}
+
+// formatBrowseLinks summarizes the associated records of a record: a line for each associated org or user, and a count
+// of associated users and tickets (or a line for each if expanded)
+func formatBrowseLinks(record interface{}, expanded bool) string {
+	var formatted strings.Builder
+
+	switch record := record.(type) {
+	case Ticket:
+		formatted.WriteString(formatBrowseOrg("Org (o)", record.OrgObj, record.Org))
+		formatted.WriteString(formatBrowseUser("Submitter (s)", record.SubmitterObj, record.Submitter, expanded))
+		formatted.WriteString(formatBrowseUser("Assignee (a)", record.AssigneeObj, record.Assignee, expanded))
+
+	case User:
+		formatted.WriteString(formatBrowseOrg("Org (o)", record.OrgObject, record.Org))
+		formatted.WriteString(formatBrowseTickets("Submitted tickets (s)", record.TicketsSubmitted, expanded))
+		formatted.WriteString(formatBrowseTickets("Assigned tickets (a)", record.TicketsAssigned, expanded))
+
+	case Organization:
+		formatted.WriteString(fmt.Sprintf("%-24s %d\n", "Users (u):", len(record.AssociatedUsers)))
+		if expanded {
+			for _, user := range record.AssociatedUsers {
+				formatted.WriteString(fmt.Sprintf("    %-6d %s (%s, %s)\n", user.ID, user.Name, user.Role, user.Email))
+			}
+		}
+		formatted.WriteString(formatBrowseTickets("Tickets (t)", record.AssociatedTickets, expanded))
+	}
+
+	return formatted.String()
+}
+
+func formatBrowseOrg(label string, org Organization, id int) string {
+	if org.ID == 0 {
+		return fmt.Sprintf("%-24s %s\n", label+":", strings.TrimSpace(formatUnresolvedReference("org", id)))
+	}
+
+	return fmt.Sprintf("%-24s %d %s\n", label+":", org.ID, org.Name)
+}
+
+func formatBrowseUser(label string, user User, id int, expanded bool) string {
+	if user.ID == 0 {
+		return fmt.Sprintf("%-24s %s\n", label+":", strings.TrimSpace(formatUnresolvedReference("user", id)))
+	}
+
+	if expanded {
+		return fmt.Sprintf("%-24s %d %s (%s, %s)\n", label+":", user.ID, user.Name, user.Role, user.Email)
+	}
+	return fmt.Sprintf("%-24s %d %s\n", label+":", user.ID, user.Name)
+}
+
+func formatBrowseTickets(label string, tickets []Ticket, expanded bool) string {
+	formatted := fmt.Sprintf("%-24s %d\n", label+":", len(tickets))
+	if expanded {
+		for _, ticket := range tickets {
+			formatted += fmt.Sprintf("    %s  %-8s %s\n", ticket.ID, ticket.Status, ticket.Subject)
+		}
+	}
+
+	return formatted
+}
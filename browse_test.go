@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// browse runs the browser over the results of a search on the given keys, as if typed at a terminal
+func browse(t *testing.T, data *Dataset, search, keys string) (*Browser, string) {
+	t.Helper()
+
+	result, err := data.Search(search, nil)
+	if err != nil {
+		t.Fatalf("browse: unexpected error: %v\n", err)
+	}
+
+	out := &bytes.Buffer{}
+	browser := NewBrowser(data, newLineEditor(strings.NewReader(keys), out, nil), out)
+	if err := browser.Browse(search, searchRecords(result)); err != nil {
+		t.Fatalf("browse: unexpected error: %v\n", err)
+	}
+
+	return browser, out.String()
+}
+
+func TestBrowse(t *testing.T) {
+	data := loadTestDataset(t)
+
+	if search, isBrowseCommand := parseBrowseCommand("browse ticket Status pending"); !isBrowseCommand || search != "ticket Status pending" {
+		t.Errorf("TestBrowse: browse command not parsed: %q\n", search)
+	}
+	if _, isBrowseCommand := parseBrowseCommand("ticket Subject browse"); isBrowseCommand {
+		t.Errorf("TestBrowse: search taken for a browse command\n")
+	}
+
+	// step through the results
+	browser, output := browse(t, data, "ticket Status pending", "nnp\x1b[Cq")
+	tickets, _ := SearchTickets("Status", "pending", data.TicketList)
+	if view := browser.views[0]; len(browser.views) != 1 || view.Position != 2 || len(view.Records) != len(tickets) {
+		t.Errorf("TestBrowse: unexpected position: %+v\n", view)
+	}
+	if !strings.Contains(output, "[3/45]") || !strings.Contains(output, "Subject:") || !strings.Contains(output, "Submitter (s):") {
+		t.Errorf("TestBrowse: unexpected rendering: %s\n", output)
+	}
+
+	// follow a ticket to its submitter, then to the tickets the submitter was assigned, and back
+	browser, output = browse(t, data, "ticket Status pending", "sab")
+	ticket := tickets[0]
+	if len(browser.views) != 2 {
+		t.Fatalf("TestBrowse: expected 2 views, got %d\n", len(browser.views))
+	}
+	submitter := browser.views[1].Records[0].(User)
+	if submitter.ID != ticket.Submitter || len(submitter.TicketsAssigned) != len(data.UserAssignedTixIndex[ticket.Submitter]) {
+		t.Errorf("TestBrowse: expected submitter %d with their tickets, got %+v\n", ticket.Submitter, submitter)
+	}
+	if !strings.Contains(output, "BROWSE: ticket Status pending > submitter of ticket "+ticket.ID+" > tickets assigned by user") {
+		t.Errorf("TestBrowse: expected the assigned tickets to have been shown: %s\n", output)
+	}
+
+	// expand an org's users and tickets, and follow it to its users
+	browser, output = browse(t, data, "org ID 101", "eu")
+	if len(browser.views) != 2 || len(browser.views[1].Records) != len(data.OrgUserIndex[101]) || !browser.views[0].Expanded {
+		t.Errorf("TestBrowse: unexpected views: %+v\n", browser.views)
+	}
+	for _, user := range data.OrgUserIndex[101] {
+		if !strings.Contains(output, user.Name) {
+			t.Errorf("TestBrowse: expanded org doesn't list user %s\n", user.Name)
+		}
+	}
+
+	// links that can't be followed are reported, without opening a view
+	browser, output = browse(t, data, "org ID 101", "bxq")
+	if len(browser.views) != 1 || !strings.Contains(output, "Already at the search results") || !strings.Contains(output, `Unknown key "x"`) {
+		t.Errorf("TestBrowse: unexpected handling of keys: %s\n", output)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// -------------------- bulk operations on search results --------------------
+
+// maximum number of changed records shown in full in a bulk operation preview
+const maxBulkPreviewRecords = 20
+
+// BulkCommand applies a write operation to every record matching a search:
+//
+//	bulk [preview] update <field> <value> where <searchtype> <searchfield> <search value>
+//	bulk [preview] add tag <tag> where ...
+//	bulk [preview] remove tag <tag> where ...
+//	bulk [preview] reassign <id> where ...  (sets the assignee of tickets, or the org of users)
+//
+// With preview, the changes are shown but not applied.
+type BulkCommand struct {
+	Operation   WriteCommand // write command applied to each matching record (EntityType and ID are taken from the record)
+	Preview     bool
+	SearchType  string
+	SearchField string
+	SearchValue string
+}
+
+// BulkChange is a record before and after a bulk operation
+type BulkChange struct {
+	Before interface{}
+	After  interface{}
+}
+
+// parseBulkCommand parses a bulk command, returning false if the input isn't a bulk command
+func parseBulkCommand(input string) (BulkCommand, bool, error) {
+	words, rest := splitWords(input, 1)
+	if len(words) <= 0 || strings.ToLower(words[0]) != "bulk" {
+		return BulkCommand{}, false, nil
+	}
+
+	formatErr := errors.New("Invalid bulk format. Format: $> bulk [preview] <update <field> <value> | add tag <tag> | remove tag <tag> | reassign <id>> where <searchtype> <searchfield> <search value>")
+
+	// the search follows the last "where" that is followed by a search type, so that the operation's value can contain
+	// the word (e.g. bulk update Subject Ask where to ship where ticket Status pending)
+	whereIndex := bulkSearchIndex(rest)
+	if whereIndex < 0 {
+		return BulkCommand{}, true, formatErr
+	}
+	operation, search := rest[:whereIndex], rest[whereIndex+len(" where "):]
+
+	command := BulkCommand{}
+	if words, remaining := splitWords(operation, 1); len(words) > 0 && strings.ToLower(words[0]) == "preview" {
+		command.Preview = true
+		operation = remaining
+	}
+
+	words, value := splitWords(operation, 1)
+	if len(words) <= 0 {
+		return command, true, formatErr
+	}
+
+	switch strings.ToLower(words[0]) {
+	case "update":
+		fieldWords, fieldValue := splitWords(value, 1)
+		if len(fieldWords) <= 0 {
+			return command, true, formatErr
+		}
+		command.Operation = WriteCommand{Action: "update", Field: fieldWords[0], Value: fieldValue}
+
+	case "add", "remove":
+		tagWords, tag := splitWords(value, 1)
+		if len(tagWords) <= 0 || strings.ToLower(tagWords[0]) != "tag" || tag == "" {
+			return command, true, formatErr
+		}
+		command.Operation = WriteCommand{Action: strings.ToLower(words[0]) + "-tag", Value: tag}
+
+	case "reassign":
+		if value == "" || strings.ContainsAny(value, " \t") {
+			return command, true, formatErr
+		}
+		command.Operation = WriteCommand{Action: "reassign", Value: value}
+
+	default:
+		return command, true, formatErr
+	}
+
+	var err error
+	command.SearchType, command.SearchField, command.SearchValue, err = parseSearchInput(strings.TrimSpace(search) + "\n")
+	if err != nil {
+		return command, true, err
+	}
+	command.SearchType = strings.ToLower(command.SearchType)
+
+	return command, true, nil
+}
+
+// bulkSearchIndex returns the position of the " where " before the search in a bulk command (after the bulk keyword): the
+// last one followed by a search type (with any matching flags), or failing that the last one. Returns -1 if there is none.
+func bulkSearchIndex(command string) int {
+	lower := strings.ToLower(command)
+	last := strings.LastIndex(lower, " where ")
+
+	for index := last; index >= 0; index = strings.LastIndex(lower[:index], " where ") {
+		words, _ := splitWords(lower[index+len(" where "):], 1)
+		if len(words) <= 0 {
+			continue
+		}
+
+		for _, entityType := range entityTypes {
+			if strings.SplitN(words[0], ":", 2)[0] == entityType {
+				return index
+			}
+		}
+	}
+
+	return last
+}
+
+// SearchRecords returns the orgs, users or tickets matching a search (as Organization, User or Ticket values). The search type
+// can be followed by matching flags, e.g. "ticket:i".
+func SearchRecords(data *Dataset, searchType, searchField, searchValue string) ([]interface{}, error) {
+	records := []interface{}{}
+
+	searchType, opts, err := resolveSearchType(searchType, data.MatchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(searchType) {
+	case "org":
+		orgs, err := data.FindOrgs(searchField, searchValue, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, org := range orgs {
+			records = append(records, org)
+		}
+
+	case "user":
+		users, err := data.FindUsers(searchField, searchValue, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			records = append(records, user)
+		}
+
+	case "ticket":
+		tickets, err := data.FindTickets(searchField, searchValue, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, ticket := range tickets {
+			records = append(records, ticket)
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid search type: %s (must be one of %s)", searchType, strings.Join(entityTypes, ", "))
+	}
+
+	return records, nil
+}
+
+// PlanBulkCommand works out the change a bulk command makes to each matching record, without applying it. Records that the
+// operation leaves unchanged (e.g. removing a tag a record doesn't have) are left out. Nothing is changed if the operation
+// is invalid for any of the records.
+func PlanBulkCommand(data *Dataset, command BulkCommand) ([]BulkChange, error) {
+	records, err := SearchRecords(data, command.SearchType, command.SearchField, command.SearchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []BulkChange{}
+	for _, record := range records {
+		var updated interface{}
+		var err error
+
+		switch command.Operation.Action {
+		case "update":
+			updated, err = SetRecordField(data, record, command.Operation.Field, command.Operation.Value)
+
+		case "add-tag":
+			updated, err = AddRecordTag(record, command.Operation.Value)
+
+		case "remove-tag":
+			updated, err = RemoveRecordTag(record, command.Operation.Value)
+			if err != nil {
+				// records without the tag are left as they are
+				updated, err = record, nil
+			}
+
+		case "reassign":
+			switch record.(type) {
+			case Ticket:
+				updated, err = SetRecordField(data, record, "Assignee", command.Operation.Value)
+			case User:
+				updated, err = SetRecordField(data, record, "Org", command.Operation.Value)
+			default:
+				err = errors.New("Only tickets (to another assignee) and users (to another org) can be reassigned")
+			}
+		}
+
+		if err != nil {
+			entityType, id := recordType(record)
+			return nil, fmt.Errorf("%s %s: %v", entityType, id, err)
+		}
+
+		if len(diffRecords(record, updated)) > 0 {
+			changes = append(changes, BulkChange{Before: record, After: updated})
+		}
+	}
+
+	return changes, nil
+}
+
+// ApplyBulkChanges applies planned bulk changes to the dataset
+func ApplyBulkChanges(data *Dataset, changes []BulkChange) {
+	for _, change := range changes {
+		data.PutRecord(change.After)
+	}
+}
+
+// describeBulkCommand returns a one-line description of a bulk command, e.g. for the change journal
+func describeBulkCommand(command BulkCommand, changed int) string {
+	var operation string
+	switch command.Operation.Action {
+	case "update":
+		operation = fmt.Sprintf("set %s to %q", command.Operation.Field, command.Operation.Value)
+	case "add-tag":
+		operation = fmt.Sprintf("added tag %q", command.Operation.Value)
+	case "remove-tag":
+		operation = fmt.Sprintf("removed tag %q", command.Operation.Value)
+	case "reassign":
+		operation = fmt.Sprintf("reassigned to %s", command.Operation.Value)
+	}
+
+	return fmt.Sprintf("Bulk %s on %d %s(s) matching %s %s %q", operation, changed, command.SearchType, command.SearchType, command.SearchField, command.SearchValue)
+}
+
+// diffRecords lists the fields (and custom attributes) that differ between two versions of a record, as "<field>: <before> -> <after>"
+func diffRecords(before, after interface{}) []string {
+	diffs := []string{}
+
+	recordType := reflect.TypeOf(before)
+	for i := 0; i < recordType.NumField(); i++ {
+		field := recordType.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		beforeValue, afterValue := recordFieldString(before, field.Name), recordFieldString(after, field.Name)
+		if beforeValue != afterValue {
+			diffs = append(diffs, fmt.Sprintf("%s: %q -> %q", field.Name, beforeValue, afterValue))
+		}
+	}
+
+	beforeCustom := reflect.ValueOf(before).FieldByName("Custom").Interface().(CustomAttributes).Flatten()
+	afterCustom := reflect.ValueOf(after).FieldByName("Custom").Interface().(CustomAttributes).Flatten()
+
+	paths := []string{}
+	for path := range beforeCustom {
+		paths = append(paths, path)
+	}
+	for path := range afterCustom {
+		if _, found := beforeCustom[path]; !found {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if beforeCustom[path] != afterCustom[path] {
+			diffs = append(diffs, fmt.Sprintf("%s%s: %q -> %q", customFieldPrefix, path, beforeCustom[path], afterCustom[path]))
+		}
+	}
+
+	return diffs
+}
+
+// FormatBulkPreview outputs the number of records a bulk command changes, along with the changes made to each (up to
+// maxBulkPreviewRecords records)
+func FormatBulkPreview(changes []BulkChange) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nPREVIEW\n-------\n")
+
+	if len(changes) <= 0 {
+		formattedResult.WriteString("<No records would change>\n")
+		return formattedResult.String()
+	}
+
+	formattedResult.WriteString(fmt.Sprintf("%d record(s) would change:\n", len(changes)))
+	for i, change := range changes {
+		if i >= maxBulkPreviewRecords {
+			formattedResult.WriteString(fmt.Sprintf("\n... and %d more\n", len(changes)-maxBulkPreviewRecords))
+			break
+		}
+
+		entityType, id := recordType(change.Before)
+		formattedResult.WriteString(fmt.Sprintf("\n%s %s\n", entityType, id))
+		for _, diff := range diffRecords(change.Before, change.After) {
+			formattedResult.WriteString(fmt.Sprintf("\t%s\n", diff))
+		}
+	}
+
+	return formattedResult.String()
+}
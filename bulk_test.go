@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBulkCommand(t *testing.T) {
+	inputs := map[string]BulkCommand{
+		"bulk update Status solved where ticket Status pending\n":                          {Operation: WriteCommand{Action: "update", Field: "Status", Value: "solved"}, SearchType: "ticket", SearchField: "Status", SearchValue: "pending"},
+		"bulk preview add tag New South Wales where user Org 119\n":                        {Operation: WriteCommand{Action: "add-tag", Value: "New South Wales"}, Preview: true, SearchType: "user", SearchField: "Org", SearchValue: "119"},
+		"bulk remove tag Ohio where Ticket Type incident\n":                                {Operation: WriteCommand{Action: "remove-tag", Value: "Ohio"}, SearchType: "ticket", SearchField: "Type", SearchValue: "incident"},
+		"bulk reassign 49 where ticket Assignee 38\n":                                      {Operation: WriteCommand{Action: "reassign", Value: "49"}, SearchType: "ticket", SearchField: "Assignee", SearchValue: "38"},
+		"bulk update Description A Nuisance where ticket Subject A Nuisance in Kiribati\n": {Operation: WriteCommand{Action: "update", Field: "Description", Value: "A Nuisance"}, SearchType: "ticket", SearchField: "Subject", SearchValue: "A Nuisance in Kiribati"},
+		"bulk update Subject Ask where to ship where ticket Status pending\n":              {Operation: WriteCommand{Action: "update", Field: "Subject", Value: "Ask where to ship"}, SearchType: "ticket", SearchField: "Status", SearchValue: "pending"},
+		"bulk update Subject Where now where ticket:i Subject Where to go\n":               {Operation: WriteCommand{Action: "update", Field: "Subject", Value: "Where now"}, SearchType: "ticket:i", SearchField: "Subject", SearchValue: "Where to go"},
+	}
+
+	for input, expected := range inputs {
+		command, isBulkCommand, err := parseBulkCommand(input)
+		if !isBulkCommand || err != nil || command != expected {
+			t.Errorf("TestParseBulkCommand: %q parsed as %+v (bulk command %v, error %v)\n", input, command, isBulkCommand, err)
+		}
+	}
+
+	for _, input := range []string{"bulk update Status solved\n", "bulk rename x where ticket Status pending\n", "bulk reassign where ticket Status pending\n"} {
+		if _, isBulkCommand, err := parseBulkCommand(input); !isBulkCommand || err == nil {
+			t.Errorf("TestParseBulkCommand: invalid bulk command %q not reported as an error\n", input)
+		}
+	}
+
+	if _, isBulkCommand, _ := parseBulkCommand("ticket Status pending\n"); isBulkCommand {
+		t.Error("TestParseBulkCommand: search parsed as a bulk command.\n")
+	}
+}
+
+func TestBulkCommand(t *testing.T) {
+	data := loadTestDataset(t)
+	data.TakeChanges()
+
+	pending, _ := SearchTickets("Status", "pending", data.TicketList)
+
+	command, _, _ := parseBulkCommand("bulk update Status hold where ticket Status pending\n")
+	changes, err := PlanBulkCommand(data, command)
+	if err != nil || len(changes) != len(pending) {
+		t.Fatalf("TestBulkCommand: expected %d changes, got %d (error %v)\n", len(pending), len(changes), err)
+	}
+
+	// planning a bulk command shouldn't change anything
+	if stillPending, _ := SearchTickets("Status", "pending", data.TicketList); len(stillPending) != len(pending) || !data.TakeChanges().Empty() {
+		t.Error("TestBulkCommand: data changed by planning a bulk command.\n")
+	}
+
+	preview := FormatBulkPreview(changes)
+	if !strings.Contains(preview, `Status: "pending" -> "hold"`) || strings.Count(preview, "\nticket ") != maxBulkPreviewRecords {
+		t.Errorf("TestBulkCommand: unexpected preview:\n%s\n", preview)
+	}
+
+	ApplyBulkChanges(data, changes)
+	if hold, _ := SearchTickets("Status", "hold", data.TicketList); len(data.TakeChanges().Tickets) != len(pending) || len(hold) < len(pending) {
+		t.Error("TestBulkCommand: bulk changes not applied.\n")
+	}
+
+	// reassigning a user's tickets should move them between assignee index entries
+	assigned := len(data.UserAssignedTixIndex[38])
+	command, _, _ = parseBulkCommand("bulk reassign 49 where ticket Assignee 38\n")
+	changes, err = PlanBulkCommand(data, command)
+	if err != nil || len(changes) != assigned {
+		t.Fatalf("TestBulkCommand: expected %d reassignments, got %d (error %v)\n", assigned, len(changes), err)
+	}
+	ApplyBulkChanges(data, changes)
+	if len(data.UserAssignedTixIndex[38]) != 0 {
+		t.Error("TestBulkCommand: tickets not reassigned.\n")
+	}
+	checkIndexesMatchRebuild(t, "TestBulkCommand", data)
+
+	// an invalid change to any matching record should stop the whole operation
+	command, _, _ = parseBulkCommand("bulk reassign 999 where ticket Status hold\n")
+	if _, err := PlanBulkCommand(data, command); err == nil {
+		t.Error("TestBulkCommand: reassignment to an unknown user not rejected.\n")
+	}
+
+	// removing a tag only changes records that have it
+	command, _, _ = parseBulkCommand("bulk remove tag Ohio where ticket Status hold\n")
+	changes, _ = PlanBulkCommand(data, command)
+	for _, change := range changes {
+		if !strings.Contains(strings.Join(change.Before.(Ticket).Tags, ","), "Ohio") {
+			t.Errorf("TestBulkCommand: tag removed from ticket without it: %s\n", change.Before.(Ticket).ID)
+		}
+	}
+}
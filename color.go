@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -------------------- output styles: plain and ANSI colored search results --------------------
+
+// ANSI escape sequences used to color output
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiUnderline = "\x1b[4m"
+	ansiHighlight = "\x1b[30;43m" // black on yellow, for matched substrings
+)
+
+// colors of the headers of each entity type, keyed by the header's last word
+var entityHeaderColors = map[string]string{
+	"ORGS":    "\x1b[1;34m", // bold blue
+	"USERS":   "\x1b[1;32m", // bold green
+	"TICKETS": "\x1b[1;35m", // bold magenta
+}
+
+// useColor reports whether output should be colored: "always" or "never" as configured, otherwise (auto) only if the output
+// is a terminal and the NO_COLOR environment variable isn't set (see https://no-color.org)
+func useColor(setting string, out *os.File) bool {
+	switch strings.ToLower(setting) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	return os.Getenv("NO_COLOR") == "" && isTerminal(out)
+}
+
+// OutputStyle styles the parts of search results written in the built-in format (see FormatStyledSearchResult)
+type OutputStyle interface {
+	Name() string                                           // the style's name, e.g. plain or ANSI
+	Header(title string) string                             // entity headers, e.g. TICKETS or ASSOCIATED USERS (SUBMITTER)
+	Muted(text string) string                               // header underlines, empty fields and notes such as <No results found>
+	SearchedLabel(label string) string                      // the label of the field searched on, in the records matching the search
+	SearchedValue(value string, result SearchResult) string // the value of the field searched on
+}
+
+// NewOutputStyle returns the style search results are written in: colored with ANSI escape sequences, or plain
+func NewOutputStyle(colored bool) OutputStyle {
+	if colored {
+		return ansiStyle{}
+	}
+
+	return plainStyle{}
+}
+
+// plainStyle writes search results as plain text
+type plainStyle struct{}
+
+func (plainStyle) Name() string                                           { return "plain" }
+func (plainStyle) Header(title string) string                             { return title }
+func (plainStyle) Muted(text string) string                               { return text }
+func (plainStyle) SearchedLabel(label string) string                      { return label }
+func (plainStyle) SearchedValue(value string, result SearchResult) string { return value }
+
+// ansiStyle colors search results: entity headers in a color for each type, the field searched on in bold with the
+// substrings matching the search value highlighted, and empty values dimmed
+type ansiStyle struct{}
+
+func (ansiStyle) Name() string {
+	return "ANSI"
+}
+
+func (ansiStyle) Header(title string) string {
+	// headers are colored by their entity type, their last word before any qualifier, e.g. USERS in ASSOCIATED USERS (SUBMITTER)
+	words := strings.Fields(strings.Split(title, " (")[0])
+	color, found := entityHeaderColors[words[len(words)-1]]
+	if !found {
+		color = ansiBold
+	}
+
+	return color + title + ansiReset
+}
+
+func (ansiStyle) Muted(text string) string {
+	return ansiDim + text + ansiReset
+}
+
+func (ansiStyle) SearchedLabel(label string) string {
+	return ansiBold + ansiUnderline + label + ansiReset
+}
+
+func (ansiStyle) SearchedValue(value string, result SearchResult) string {
+	return highlightMatches(value, result)
+}
+
+// highlightMatches highlights the parts of a value matching a search value (or for a fuzzy search, its words), compared
+// with the search's matching options
+func highlightMatches(value string, result SearchResult) string {
+	if value == "" || value == "[]" {
+		return ansiDim + value + ansiReset
+	}
+
+	searchValue, fuzzy := parseFuzzyValue(result.SearchValue)
+	terms, opts := []string{searchValue}, result.MatchOptions
+	if fuzzy {
+		terms, opts = strings.Fields(searchValue), looseMatchOptions
+	}
+
+	runes := []rune(value)
+	highlighted := make([]bool, len(runes))
+	for _, term := range terms {
+		term = opts.Normalize(term)
+		if term == "" {
+			continue
+		}
+
+		// try the substrings starting at each position, up to about twice the length of the term (normalization can
+		// change the length of a string, e.g. when accents are stripped)
+		maxLength := 2*utf8.RuneCountInString(term) + 2
+		for start := 0; start < len(runes); start++ {
+			if unicode.IsSpace(runes[start]) {
+				continue
+			}
+			for end := start + 1; end <= len(runes) && end-start <= maxLength; end++ {
+				if opts.Normalize(string(runes[start:end])) == term {
+					for j := start; j < end; j++ {
+						highlighted[j] = true
+					}
+					start = end - 1
+					break
+				}
+			}
+		}
+	}
+
+	var output strings.Builder
+	for i, r := range runes {
+		if highlighted[i] && (i == 0 || !highlighted[i-1]) {
+			output.WriteString(ansiHighlight)
+		}
+		output.WriteRune(r)
+		if highlighted[i] && (i == len(runes)-1 || !highlighted[i+1]) {
+			output.WriteString(ansiReset)
+		}
+	}
+
+	return output.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatStyledSearchResult(t *testing.T) {
+	data := loadTestDataset(t)
+
+	result, err := data.Search("user:i Tags toftrees", nil)
+	if err != nil {
+		t.Fatalf("TestFormatStyledSearchResult: unexpected error: %v\n", err)
+	}
+
+	formatted := FormatSearchResult(result)
+	colored := FormatStyledSearchResult(result, NewOutputStyle(true))
+
+	expected := []string{
+		entityHeaderColors["USERS"] + "USERS" + ansiReset,
+		"\t" + entityHeaderColors["ORGS"] + "ASSOCIATED ORGS" + ansiReset,
+		"\t" + entityHeaderColors["TICKETS"] + "TICKETS (SUBMITTED)" + ansiReset,
+		ansiBold + ansiUnderline + "Tags" + ansiReset + ": [" + ansiHighlight + "Toftrees" + ansiReset + " Draper Northridge Cucumber]",
+	}
+	for _, line := range expected {
+		if !strings.Contains(colored, line) {
+			t.Errorf("TestFormatStyledSearchResult: expected %q in the colored result\n", line)
+		}
+	}
+
+	// removing the escape sequences gives the plain result
+	plain := strings.NewReplacer(ansiReset, "", ansiBold, "", ansiDim, "", ansiUnderline, "", ansiHighlight, "",
+		entityHeaderColors["ORGS"], "", entityHeaderColors["USERS"], "", entityHeaderColors["TICKETS"], "").Replace(colored)
+	if plain != formatted {
+		t.Errorf("TestFormatStyledSearchResult: coloring changed the text of the result\n")
+	}
+
+	// empty values are dimmed
+	result, _ = data.Search("user Alias", nil)
+	if colored := FormatStyledSearchResult(result, NewOutputStyle(true)); result.Len() != 1 || !strings.Contains(colored, ansiBold+ansiUnderline+"Alias"+ansiReset+": "+ansiDim+ansiReset+"\n") {
+		t.Errorf("TestFormatStyledSearchResult: unexpected coloring of an empty value search\n")
+	}
+	result, _ = data.Search("org ID 999", nil)
+	if colored := FormatStyledSearchResult(result, NewOutputStyle(true)); !strings.Contains(colored, ansiDim+"<No results found>"+ansiReset) {
+		t.Errorf("TestFormatStyledSearchResult: unexpected coloring of no results\n")
+	}
+}
+
+func TestHighlightMatches(t *testing.T) {
+	tests := []struct {
+		value    string
+		search   string
+		opts     MatchOptions
+		expected string
+	}{
+		{"pending", "pending", MatchOptions{}, ansiHighlight + "pending" + ansiReset},
+		{"[a b c]", "b", MatchOptions{}, "[a " + ansiHighlight + "b" + ansiReset + " c]"},
+		{"Côpeland", "cope", MatchOptions{FoldCase: true, StripAccents: true}, ansiHighlight + "Côpe" + ansiReset + "land"},
+		{"Morris Ayers", "~moris ayers", MatchOptions{}, "Morris " + ansiHighlight + "Ayers" + ansiReset}, // fuzzy: words matching after normalization
+		{"", "", MatchOptions{}, ansiDim + ansiReset},
+	}
+
+	for _, test := range tests {
+		result := SearchResult{SearchValue: test.search, MatchOptions: test.opts}
+		if highlighted := highlightMatches(test.value, result); highlighted != test.expected {
+			t.Errorf("TestHighlightMatches: %q in %q: expected %q, got %q\n", test.search, test.value, test.expected, highlighted)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	noColor, set := os.LookupEnv("NO_COLOR")
+	defer func() {
+		if set {
+			os.Setenv("NO_COLOR", noColor)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	os.Unsetenv("NO_COLOR")
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if !useColor("always", file) || useColor("never", file) {
+		t.Errorf("TestUseColor: configured setting not used\n")
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	if useColor("auto", os.Stdout) || useColor("", os.Stdout) {
+		t.Errorf("TestUseColor: output colored with NO_COLOR set\n")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// -------------------- tab completion of commands, search types, fields and values --------------------
+
+// commands that can be entered at the prompt (besides searches), for completion
+var promptCommands = []string{"validate", "duplicates", "domains", "merge", "similar", "sla", "explain", "browse", "tui", "export", "apply", "save", "update", "add", "remove", "delete", "create", "bulk", "undo", "history"}
+
+// fields with a small set of known values, completed from their valid values (if any) and the values found in the data
+var enumFields = map[string][]string{
+	"Ticket.Status":   validTicketStatuses,
+	"Ticket.Priority": validTicketPriorities,
+	"Ticket.Type":     validTicketTypes,
+	"Ticket.Via":      validTicketVias,
+	"User.Role":       validUserRoles,
+	"User.Locale":     nil,
+}
+
+// zero values of the record structs, for looking up their fields
+var recordStructs = map[string]interface{}{"Organization": Organization{}, "User": User{}, "Ticket": Ticket{}}
+
+// newPromptCompleter returns a completer for the prompt, completing fields and values from the dataset, and the names of
+// saved queries after :run and :unsave
+func newPromptCompleter(data *Dataset, queries *SavedQueries) Completer {
+	return func(words []string, partial string) []string {
+		if len(words) == 1 && (strings.ToLower(words[0]) == metaCommandPrefix+"run" || strings.ToLower(words[0]) == metaCommandPrefix+"unsave") {
+			return completeWord(queries.Names(), partial)
+		}
+		return completePromptWord(data, words, partial)
+	}
+}
+
+// completePromptWord returns the completions of a word at the prompt: a command or search type, then depending on the
+// command, the record type, field or value expected next
+func completePromptWord(data *Dataset, words []string, partial string) []string {
+	if len(words) <= 0 {
+		if strings.HasPrefix(partial, metaCommandPrefix) {
+			names := []string{}
+			for _, command := range metaCommands {
+				names = append(names, strings.Fields(command.Usage)[0])
+			}
+			return completeWord(names, partial)
+		}
+		return completeWord(append(append([]string{}, entityTypes...), promptCommands...), partial)
+	}
+
+	switch strings.ToLower(words[0]) {
+	case metaCommandPrefix + "fields", metaCommandPrefix + "describe":
+		// :fields <type>, :describe <type> <field>
+		switch len(words) {
+		case 1:
+			return completeWord(entityTypes, partial)
+		case 2:
+			if strings.ToLower(words[0]) == metaCommandPrefix+"describe" {
+				return completeWord(recordFieldNames(data, words[1]), partial)
+			}
+		}
+		return nil
+
+	case explainPrefix, browsePrefix, tuiPrefix, slaPrefix:
+		return completePromptWord(data, words[1:], partial)
+
+	case "export":
+		// export <format> <file> <search>
+		switch len(words) {
+		case 1:
+			return completeWord(exportFormatNames(), partial)
+		case 2:
+			return nil
+		}
+		return completeSearchWord(data, words[3:], partial)
+
+	case "bulk":
+		// bulk [preview] <operation> where <search>
+		for i, word := range words {
+			if strings.ToLower(word) == "where" {
+				return completeSearchWord(data, words[i+1:], partial)
+			}
+		}
+		if len(words) == 1 || (len(words) == 2 && strings.ToLower(words[1]) == "preview") {
+			return completeWord([]string{"preview", "update", "add", "remove", "reassign"}, partial)
+		}
+		return completeWord([]string{"where"}, partial)
+
+	case "update":
+		// update <type> <id> <field> <value>
+		switch len(words) {
+		case 1:
+			return completeWord(entityTypes, partial)
+		case 3:
+			return completeWord(recordFieldNames(data, words[1]), partial)
+		case 4:
+			return completeWord(knownFieldValues(data, words[1], words[3]), partial)
+		}
+		return nil
+
+	case "add", "remove":
+		// add/remove tag <type> <id> <tag>
+		switch len(words) {
+		case 1:
+			return completeWord([]string{"tag"}, partial)
+		case 2:
+			return completeWord(entityTypes, partial)
+		}
+		return nil
+
+	case "delete", "create":
+		if len(words) == 1 {
+			return completeWord(entityTypes, partial)
+		}
+		return nil
+
+	case "merge":
+		if len(words) == 1 {
+			return completeWord([]string{"user", "org"}, partial)
+		}
+		return nil
+
+	case "similar":
+		if len(words) == 1 {
+			return completeWord([]string{"ticket"}, partial)
+		}
+		return nil
+
+	case "domains":
+		if len(words) == 1 {
+			return completeWord([]string{"fill"}, partial)
+		}
+		return nil
+	}
+
+	return completeSearchWord(data, words, partial)
+}
+
+// completeSearchWord returns the completions of a word of a search: <searchtype> <searchfield> <search value>
+func completeSearchWord(data *Dataset, words []string, partial string) []string {
+	switch len(words) {
+	case 0:
+		return completeWord(entityTypes, partial)
+	case 1:
+		fields := recordFieldNames(data, words[0])
+		if structName, _ := typeRecords(data, words[0]); structName == "Ticket" {
+			fields = append(fields, overdueField)
+		}
+		return completeWord(fields, partial)
+	case 2:
+		return completeWord(knownFieldValues(data, words[0], words[1]), partial)
+	}
+
+	return nil
+}
+
+// completeWord returns the candidates starting with a partial word (ignoring case), sorted and without duplicates
+func completeWord(candidates []string, partial string) []string {
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if !seen[candidate] && strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(partial)) {
+			seen[candidate] = true
+			matches = append(matches, candidate)
+		}
+	}
+
+	sort.Strings(matches)
+	return matches
+}
+
+// typeRecords returns the records of a search type (which can be followed by matching flags, e.g. "org:i"), along with the
+// name of their struct
+func typeRecords(data *Dataset, searchType string) (string, []interface{}) {
+	records := []interface{}{}
+
+	switch strings.ToLower(strings.SplitN(searchType, ":", 2)[0]) {
+	case "org":
+		for _, org := range data.OrgList {
+			records = append(records, org)
+		}
+		return "Organization", records
+	case "user":
+		for _, user := range data.UserList {
+			records = append(records, user)
+		}
+		return "User", records
+	case "ticket":
+		for _, ticket := range data.TicketList {
+			records = append(records, ticket)
+		}
+		return "Ticket", records
+	}
+
+	return "", nil
+}
+
+// recordFieldNames returns the searchable fields of a record type: its data fields, and the custom attributes found in the data
+func recordFieldNames(data *Dataset, searchType string) []string {
+	structName, records := typeRecords(data, searchType)
+	if structName == "" {
+		return nil
+	}
+
+	names := []string{}
+	recordType := reflect.TypeOf(recordStructs[structName])
+	for i := 0; i < recordType.NumField(); i++ {
+		if tag := recordType.Field(i).Tag.Get("json"); tag != "" && tag != "-" {
+			names = append(names, recordType.Field(i).Name)
+		}
+	}
+
+	for _, record := range records {
+		for path := range reflect.ValueOf(record).FieldByName("Custom").Interface().(CustomAttributes).Flatten() {
+			names = append(names, customFieldPrefix+path)
+		}
+	}
+
+	return names
+}
+
+// knownFieldValues returns the values a field can be searched for: true/false for boolean fields, and for enum-like fields
+// (e.g. Ticket.Status) their valid values and the values found in the data
+func knownFieldValues(data *Dataset, searchType, field string) []string {
+	structName, records := typeRecords(data, searchType)
+	if structName == "" {
+		return nil
+	}
+
+	if fieldType, err := GetFieldType(recordStructs[structName], field); (err == nil && fieldType == "bool") || (structName == "Ticket" && strings.EqualFold(field, overdueField)) {
+		return []string{"true", "false"}
+	}
+
+	validValues, isEnum := enumFields[structName+"."+field]
+	if !isEnum {
+		return nil
+	}
+
+	values := append([]string{}, validValues...)
+	for _, record := range records {
+		if value := recordFieldString(record, field); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletePromptWord(t *testing.T) {
+	data := loadTestDataset(t)
+
+	if completions := completePromptWord(data, nil, "d"); !reflect.DeepEqual(completions, []string{"delete", "domains", "duplicates"}) {
+		t.Errorf("TestCompletePromptWord: unexpected command completions: %v\n", completions)
+	}
+
+	expected := []string{"Status", "Subject", "Submitter"}
+	if completions := completePromptWord(data, []string{"ticket"}, "s"); !reflect.DeepEqual(completions, expected) {
+		t.Errorf("TestCompletePromptWord: expected %v, got %v\n", expected, completions)
+	}
+
+	if completions := completePromptWord(data, []string{"bulk", "update", "Status", "hold", "where", "ticket", "Priority"}, ""); !reflect.DeepEqual(completions, []string{"high", "low", "normal", "urgent"}) {
+		t.Errorf("TestCompletePromptWord: unexpected bulk search value completions: %v\n", completions)
+	}
+
+	if completions := completePromptWord(data, []string{"user:i", "Active"}, ""); !reflect.DeepEqual(completions, []string{"false", "true"}) {
+		t.Errorf("TestCompletePromptWord: unexpected boolean completions: %v\n", completions)
+	}
+
+	// values of fields that aren't enum-like aren't completed
+	if completions := completePromptWord(data, []string{"user", "Name"}, ""); len(completions) != 0 {
+		t.Errorf("TestCompletePromptWord: unexpected name completions: %v\n", completions)
+	}
+
+	locales := completePromptWord(data, []string{"user", "Locale"}, "en")
+	if len(locales) <= 0 || locales[0] != "en-AU" {
+		t.Errorf("TestCompletePromptWord: locales not completed from the data: %v\n", locales)
+	}
+
+	if completions := completePromptWord(data, []string{"org"}, "custom."); len(completions) != 0 {
+		t.Errorf("TestCompletePromptWord: unexpected custom attribute completions for the sample data: %v\n", completions)
+	}
+}
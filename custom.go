@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// -------------------- custom fields and unknown attributes --------------------
+
+// prefix used to search custom attributes, e.g. `ticket custom.region APAC`
+const customFieldPrefix = "custom."
+
+// CustomAttributes holds attributes found in a data record that don't map to a struct field (e.g. custom_fields,
+// satisfaction_rating), keyed by their JSON name. Values keep their decoded JSON types: string, float64, bool, nil,
+// []interface{} or map[string]interface{}, so that records can be written back out unchanged.
+type CustomAttributes map[string]interface{}
+
+// UnmarshalJSON decodes an organization record, keeping any unknown attributes in Custom
+func (org *Organization) UnmarshalJSON(data []byte) error {
+	type orgFields Organization // separate type without this method, to avoid recursion
+	var fields orgFields
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	*org = Organization(fields)
+	org.Custom, err = readCustomAttributes(data, reflect.TypeOf(*org))
+	return err
+}
+
+// UnmarshalJSON decodes a user record, keeping any unknown attributes in Custom
+func (user *User) UnmarshalJSON(data []byte) error {
+	type userFields User
+	var fields userFields
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	*user = User(fields)
+	user.Custom, err = readCustomAttributes(data, reflect.TypeOf(*user))
+	return err
+}
+
+// UnmarshalJSON decodes a ticket record, keeping any unknown attributes in Custom
+func (ticket *Ticket) UnmarshalJSON(data []byte) error {
+	type ticketFields Ticket
+	var fields ticketFields
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	*ticket = Ticket(fields)
+	ticket.Custom, err = readCustomAttributes(data, reflect.TypeOf(*ticket))
+	return err
+}
+
+// MarshalJSON encodes an organization record in the data file format, including any custom attributes
+func (org Organization) MarshalJSON() ([]byte, error) {
+	return marshalRecord(reflect.ValueOf(org), org.Custom)
+}
+
+// MarshalJSON encodes a user record in the data file format, including any custom attributes
+func (user User) MarshalJSON() ([]byte, error) {
+	return marshalRecord(reflect.ValueOf(user), user.Custom)
+}
+
+// MarshalJSON encodes a ticket record in the data file format, including any custom attributes
+func (ticket Ticket) MarshalJSON() ([]byte, error) {
+	return marshalRecord(reflect.ValueOf(ticket), ticket.Custom)
+}
+
+// marshalRecord encodes the json-tagged fields of a record (in struct order) followed by its custom attributes (sorted by name).
+// Associated entities are left out, as are empty strings, zero IDs and nil lists - the data files omit missing fields rather
+// than storing zero values.
+func marshalRecord(record reflect.Value, custom CustomAttributes) ([]byte, error) {
+	keys, values, empty := recordJSONFields(record, custom)
+
+	present := []string{}
+	for _, key := range keys {
+		if !empty[key] {
+			present = append(present, key)
+		}
+	}
+
+	return encodeJSONObject(present, values)
+}
+
+// patchRecordJSON encodes a changed record in the layout of its original JSON, so that writing it back only changes what
+// was changed: the original's keys keep their order (and are kept even if now empty), followed by any other fields and
+// custom attributes that are set (not empty, false or null). Custom attributes the record no longer has are left out.
+func patchRecordJSON(original json.RawMessage, record interface{}) ([]byte, error) {
+	value := reflect.ValueOf(record)
+	keys, values, empty := recordJSONFields(value, value.FieldByName("Custom").Interface().(CustomAttributes))
+
+	originalKeys, err := jsonObjectKeys(original)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := []string{}
+	seen := map[string]bool{}
+	for _, key := range originalKeys {
+		if _, found := values[key]; found && !seen[key] {
+			ordered = append(ordered, key)
+			seen[key] = true
+		}
+	}
+	for _, key := range keys {
+		if !seen[key] && !empty[key] && !isZeroValue(values[key]) {
+			ordered = append(ordered, key)
+		}
+	}
+
+	return encodeJSONObject(ordered, values)
+}
+
+// isZeroValue reports whether a field value is its type's zero value (e.g. a false bool the original record left out)
+func isZeroValue(value interface{}) bool {
+	reflected := reflect.ValueOf(value)
+	return !reflected.IsValid() || reflected.IsZero()
+}
+
+// recordJSONFields returns the keys of a record's json-tagged fields (in struct order) followed by its custom attributes
+// (sorted by name), their values, and which of them are empty (empty strings, zero IDs and nil lists)
+func recordJSONFields(record reflect.Value, custom CustomAttributes) ([]string, map[string]interface{}, map[string]bool) {
+	keys := []string{}
+	values := map[string]interface{}{}
+	empty := map[string]bool{}
+
+	recordType := record.Type()
+	for i := 0; i < recordType.NumField(); i++ {
+		tag := strings.Split(recordType.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		field := record.Field(i)
+		switch field.Kind() {
+		case reflect.String, reflect.Int:
+			empty[tag] = field.IsZero()
+		case reflect.Slice:
+			empty[tag] = field.IsNil()
+		}
+
+		keys = append(keys, tag)
+		values[tag] = field.Interface()
+	}
+
+	customKeys := []string{}
+	for key := range custom {
+		customKeys = append(customKeys, key)
+	}
+	sort.Strings(customKeys)
+
+	for _, key := range customKeys {
+		keys = append(keys, key)
+		values[key] = custom[key]
+	}
+
+	return keys, values, empty
+}
+
+// encodeJSONObject encodes the given keys of a map as a JSON object, in order
+func encodeJSONObject(keys []string, values map[string]interface{}) ([]byte, error) {
+	var encoded bytes.Buffer
+	encoded.WriteString("{")
+
+	for i, key := range keys {
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		valueJSON, err := json.Marshal(values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			encoded.WriteString(",")
+		}
+		encoded.Write(keyJSON)
+		encoded.WriteString(":")
+		encoded.Write(valueJSON)
+	}
+
+	encoded.WriteString("}")
+	return encoded.Bytes(), nil
+}
+
+// jsonObjectKeys returns the keys of a JSON object, in order
+func jsonObjectKeys(object []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(object))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("Not a JSON object: %.40s", object)
+	}
+
+	keys := []string{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, token.(string))
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// readCustomAttributes returns the attributes of a JSON object that are not mapped to a json-tagged field of the given struct type
+func readCustomAttributes(data []byte, structType reflect.Type) (CustomAttributes, error) {
+	var attributes map[string]interface{}
+	err := json.Unmarshal(data, &attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < structType.NumField(); i++ {
+		tag := strings.Split(structType.Field(i).Tag.Get("json"), ",")[0]
+		if tag != "" && tag != "-" {
+			delete(attributes, tag)
+		}
+	}
+
+	if len(attributes) <= 0 {
+		return nil, nil
+	}
+
+	return CustomAttributes(attributes), nil
+}
+
+// Lookup returns the scalar values found at a dotted attribute path (e.g. "satisfaction_rating.score"). Arrays are searched
+// element-wise, and arrays of {"id": ..., "value": ...} objects (Zendesk's custom_fields format) can be indexed by id,
+// e.g. "custom_fields.360001234".
+func (attributes CustomAttributes) Lookup(path string) []interface{} {
+	return lookupAttribute(map[string]interface{}(attributes), strings.Split(path, "."))
+}
+
+func lookupAttribute(value interface{}, path []string) []interface{} {
+	if len(path) <= 0 {
+		switch v := value.(type) {
+		case []interface{}:
+			values := []interface{}{}
+			for _, item := range v {
+				values = append(values, lookupAttribute(item, path)...)
+			}
+			return values
+		case map[string]interface{}:
+			return []interface{}{}
+		}
+		return []interface{}{value}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, found := v[path[0]]
+		if found {
+			return lookupAttribute(child, path[1:])
+		}
+	case []interface{}:
+		values := []interface{}{}
+		for _, item := range v {
+			// custom_fields style {"id": 123, "value": "x"} items are addressed by id
+			if itemObj, isObj := item.(map[string]interface{}); isObj {
+				if id, hasID := itemObj["id"]; hasID && formatAttributeValue(id) == path[0] {
+					values = append(values, lookupAttribute(itemObj["value"], path[1:])...)
+					continue
+				}
+			}
+			values = append(values, lookupAttribute(item, path)...)
+		}
+		return values
+	}
+
+	return []interface{}{}
+}
+
+// Matches reports whether the attribute at the given path exactly matches a search value. An empty search value matches
+// attributes that are missing, null or empty.
+func (attributes CustomAttributes) Matches(path, searchValue string) bool {
+	return attributes.MatchesWithOptions(path, searchValue, MatchOptions{})
+}
+
+// MatchesWithOptions reports whether the attribute at the given path matches a search value under the given matching options
+func (attributes CustomAttributes) MatchesWithOptions(path, searchValue string, opts MatchOptions) bool {
+	values := attributes.Lookup(path)
+	if len(values) <= 0 {
+		return searchValue == ""
+	}
+
+	for _, value := range values {
+		if opts.Equal(formatAttributeValue(value), searchValue) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Flatten returns all attribute values keyed by their dotted paths, for display
+func (attributes CustomAttributes) Flatten() map[string]string {
+	flattened := map[string]string{}
+	for key, value := range attributes {
+		flattenAttribute(key, value, flattened)
+	}
+
+	return flattened
+}
+
+func flattenAttribute(path string, value interface{}, flattened map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenAttribute(path+"."+key, child, flattened)
+		}
+	case []interface{}:
+		scalars := []string{}
+		for _, item := range v {
+			itemObj, isObj := item.(map[string]interface{})
+			if !isObj {
+				scalars = append(scalars, formatAttributeValue(item))
+				continue
+			}
+
+			if id, hasID := itemObj["id"]; hasID {
+				flattenAttribute(path+"."+formatAttributeValue(id), itemObj["value"], flattened)
+			}
+		}
+
+		if len(scalars) > 0 || len(v) <= 0 {
+			flattened[path] = fmt.Sprintf("%v", scalars)
+		}
+	default:
+		flattened[path] = formatAttributeValue(value)
+	}
+}
+
+// formatAttributeValue converts a decoded JSON scalar into the string form used for searching and display
+func formatAttributeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		// avoid exponent formatting for large integer IDs
+		if v == float64(int64(v)) {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprintf("%v", v)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// customResultFields returns custom attributes (sorted by path) as fields of a record shown in search results
+func customResultFields(attributes CustomAttributes) []resultField {
+	flattened := attributes.Flatten()
+	paths := []string{}
+	for path := range flattened {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fields := []resultField{}
+	for _, path := range paths {
+		fields = append(fields, resultField{Name: customFieldPrefix + path, Label: customFieldPrefix + path, Value: flattened[path]})
+	}
+
+	return fields
+}
+
+// formatCustomAttributes outputs custom attributes (sorted by path) in the same style as other record fields
+func formatCustomAttributes(attributes CustomAttributes, indent string) string {
+	var formatted strings.Builder
+	for _, field := range customResultFields(attributes) {
+		formatted.WriteString(fmt.Sprintf("%s%s: %s\n", indent, field.Label, field.Value))
+	}
+
+	return formatted.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const customTicketData = `[{"_id": "t1", "subject": "Printer on fire", "status": "open", "region": "APAC",
+	"custom_fields": [{"id": 360001, "value": "hardware"}, {"id": 360002, "value": null}],
+	"satisfaction_rating": {"score": "good", "comment": "Quick fix"}},
+	{"_id": "t2", "subject": "Printer jammed", "status": "open", "region": "EMEA"}]`
+
+func TestCustomAttributesRetained(t *testing.T) {
+	var tickets []Ticket
+	err := json.Unmarshal([]byte(customTicketData), &tickets)
+	if err != nil {
+		t.Fatalf("TestCustomAttributesRetained: cannot decode tickets - %v\n", err)
+	}
+
+	if tickets[0].Subject != "Printer on fire" || tickets[0].Status != "open" {
+		t.Error("TestCustomAttributesRetained: known fields not decoded.\n")
+	}
+
+	if len(tickets[0].Custom) != 3 || tickets[0].Custom["region"] != "APAC" {
+		t.Errorf("TestCustomAttributesRetained: unknown attributes not retained: %v\n", tickets[0].Custom)
+	}
+
+	if _, found := tickets[0].Custom["subject"]; found {
+		t.Error("TestCustomAttributesRetained: known field stored as a custom attribute.\n")
+	}
+
+	formatted := FormatTicketResult(tickets[:1])
+	if !strings.Contains(formatted, "custom.custom_fields.360001: hardware") || !strings.Contains(formatted, "custom.satisfaction_rating.score: good") {
+		t.Errorf("TestCustomAttributesRetained: custom attributes missing from formatted output:\n%s\n", formatted)
+	}
+}
+
+func TestSearchCustomAttributes(t *testing.T) {
+	var tickets []Ticket
+	err := json.Unmarshal([]byte(customTicketData), &tickets)
+	if err != nil {
+		t.Fatalf("TestSearchCustomAttributes: cannot decode tickets - %v\n", err)
+	}
+
+	searches := []struct {
+		field, value string
+		expected     int
+	}{
+		{"custom.region", "APAC", 1},
+		{"custom.custom_fields.360001", "hardware", 1},
+		{"custom.custom_fields.360002", "", 2},
+		{"custom.satisfaction_rating.score", "good", 1},
+		{"custom.satisfaction_rating.score", "bad", 0},
+	}
+
+	for _, search := range searches {
+		results, err := SearchTickets(search.field, search.value, tickets)
+		if err != nil || len(results) != search.expected {
+			t.Errorf("TestSearchCustomAttributes: ticket %s %q returned %d results (error %v), expected %d\n", search.field, search.value, len(results), err, search.expected)
+		}
+	}
+
+	// the sample data has no custom attributes
+	_, userDataFile, _, err := GetAppConfig()
+	if err != nil {
+		t.Error("TestSearchCustomAttributes: cannot read config file.\n")
+	}
+
+	UserList, err := ReadUserData(userDataFile)
+	if err != nil {
+		t.Error("TestSearchCustomAttributes: cannot get user list.\n")
+	}
+
+	users, err := SearchUsers("custom.region", "", UserList)
+	if err != nil || len(users) != len(UserList) {
+		t.Errorf("TestSearchCustomAttributes: empty custom attribute search returned %d users (error %v)\n", len(users), err)
+	}
+}
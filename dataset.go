@@ -0,0 +1,595 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -------------------- dataset: loaded data along with indexes, kept consistent as records change --------------------
+
+// Dataset holds the loaded orgs, users and tickets along with all indexes built over them. Records are added, replaced and
+// removed through its methods, which update every index in place rather than rebuilding them from scratch.
+type Dataset struct {
+	OrgList               []Organization
+	UserList              []User
+	TicketList            []Ticket
+	OrgUserIndex          map[int][]User
+	OrgTicketIndex        map[int][]Ticket
+	OrgIndex              map[int]Organization
+	OrgDomainIndex        map[string][]Organization
+	UserSubmittedTixIndex map[int][]Ticket
+	UserAssignedTixIndex  map[int][]Ticket
+	UserIndex             map[int]User
+
+	// positions of records in the lists above, keyed by ID. IDs can be duplicated, so each ID has the positions of all its
+	// records, the first being the record used by lookups.
+	orgPositions    map[int][]int
+	userPositions   map[int][]int
+	ticketPositions map[string][]int
+
+	// how string values are compared by searches that don't give their own matching options
+	MatchOptions MatchOptions
+
+	// the time tickets' due dates are compared with, for the overdue search and SLA reports
+	SLA SLAOptions
+
+	// trigram indexes over fuzzy-matchable fields, keyed by <struct name>.<field name>
+	fuzzyIndexes map[string]*FuzzyIndex
+
+	// IDs of records changed since the changes were last taken (to be persisted)
+	changes ChangeSet
+}
+
+// ChangeSet holds the IDs of records that have been added, replaced or removed
+type ChangeSet struct {
+	Orgs    map[int]bool
+	Users   map[int]bool
+	Tickets map[string]bool
+
+	// records as they were before the first change, keyed by record key (e.g. "org/101"), nil for records that were added
+	Originals map[string]interface{}
+}
+
+func newChangeSet() ChangeSet {
+	return ChangeSet{Orgs: map[int]bool{}, Users: map[int]bool{}, Tickets: map[string]bool{}, Originals: map[string]interface{}{}}
+}
+
+// Empty reports whether no records have changed
+func (changes ChangeSet) Empty() bool {
+	return len(changes.Orgs) <= 0 && len(changes.Users) <= 0 && len(changes.Tickets) <= 0
+}
+
+// Len returns the number of changed records
+func (changes ChangeSet) Len() int {
+	return len(changes.Orgs) + len(changes.Users) + len(changes.Tickets)
+}
+
+// NewDataset builds all indexes over the given data
+func NewDataset(OrgList []Organization, UserList []User, TicketList []Ticket) *Dataset {
+	data := newDataset(OrgList, UserList, TicketList)
+	data.OrgUserIndex = indexOrgUsers(UserList)
+	data.OrgTicketIndex = indexOrgTickets(TicketList)
+	data.OrgDomainIndex = indexOrgDomains(OrgList)
+	data.UserSubmittedTixIndex = indexUserSubmittedTickets(TicketList)
+	data.UserAssignedTixIndex = indexUserAssignedTickets(TicketList)
+
+	return data
+}
+
+// RelationshipIndexes holds the IDs of the records in each entry of the relationship indexes, as persisted by a store
+type RelationshipIndexes struct {
+	OrgUsers         map[int][]int
+	OrgTickets       map[int][]string
+	SubmittedTickets map[int][]string
+	AssignedTickets  map[int][]string
+	OrgDomains       map[string][]int
+}
+
+// NewDatasetWithIndexes builds a dataset over the given data with relationship indexes loaded from a store, so that only the
+// record lookups and fuzzy indexes are built. IDs of records that aren't in the data are skipped.
+func NewDatasetWithIndexes(OrgList []Organization, UserList []User, TicketList []Ticket, indexes RelationshipIndexes) *Dataset {
+	data := newDataset(OrgList, UserList, TicketList)
+
+	data.OrgUserIndex = map[int][]User{}
+	for key, ids := range indexes.OrgUsers {
+		for _, id := range ids {
+			if user, found := data.GetUser(id); found {
+				data.OrgUserIndex[key] = append(data.OrgUserIndex[key], user)
+			}
+		}
+	}
+
+	data.OrgTicketIndex = data.resolveTicketIndex(indexes.OrgTickets)
+	data.UserSubmittedTixIndex = data.resolveTicketIndex(indexes.SubmittedTickets)
+	data.UserAssignedTixIndex = data.resolveTicketIndex(indexes.AssignedTickets)
+
+	data.OrgDomainIndex = map[string][]Organization{}
+	for domain, ids := range indexes.OrgDomains {
+		for _, id := range ids {
+			if org, found := data.GetOrg(id); found {
+				data.OrgDomainIndex[domain] = append(data.OrgDomainIndex[domain], org)
+			}
+		}
+	}
+
+	return data
+}
+
+// newDataset builds a dataset's record lookups and fuzzy indexes, leaving the relationship indexes to the caller
+func newDataset(OrgList []Organization, UserList []User, TicketList []Ticket) *Dataset {
+	data := &Dataset{
+		OrgList:    OrgList,
+		UserList:   UserList,
+		TicketList: TicketList,
+		OrgIndex:   indexOrgs(OrgList),
+		UserIndex:  indexUsers(UserList),
+	}
+	data.indexPositions()
+	data.fuzzyIndexes = buildFuzzyIndexes(OrgList, UserList, TicketList)
+	data.changes = newChangeSet()
+
+	return data
+}
+
+// resolveTicketIndex returns a ticket index with the tickets for the given ticket IDs
+func (data *Dataset) resolveTicketIndex(ids map[int][]string) map[int][]Ticket {
+	index := map[int][]Ticket{}
+	for key, ticketIDs := range ids {
+		for _, id := range ticketIDs {
+			if ticket, found := data.GetTicket(id); found {
+				index[key] = append(index[key], ticket)
+			}
+		}
+	}
+
+	return index
+}
+
+// TakeChanges returns the IDs of records changed since the last call (or since the dataset was built), and starts tracking
+// changes afresh
+func (data *Dataset) TakeChanges() ChangeSet {
+	changes := data.changes
+	data.changes = newChangeSet()
+
+	return changes
+}
+
+// trackOrg marks an org as changed, keeping its original version if this is its first change
+func (data *Dataset) trackOrg(id int) {
+	if data.changes.Orgs[id] {
+		return
+	}
+
+	data.changes.Orgs[id] = true
+	data.changes.Originals[orgKey(id)] = nil
+	if org, found := data.GetOrg(id); found {
+		data.changes.Originals[orgKey(id)] = org
+	}
+}
+
+// trackUser marks a user as changed, keeping its original version if this is its first change
+func (data *Dataset) trackUser(id int) {
+	if data.changes.Users[id] {
+		return
+	}
+
+	data.changes.Users[id] = true
+	data.changes.Originals[userKey(id)] = nil
+	if user, found := data.GetUser(id); found {
+		data.changes.Originals[userKey(id)] = user
+	}
+}
+
+// trackTicket marks a ticket as changed, keeping its original version if this is its first change
+func (data *Dataset) trackTicket(id string) {
+	if data.changes.Tickets[id] {
+		return
+	}
+
+	data.changes.Tickets[id] = true
+	data.changes.Originals[ticketKey(id)] = nil
+	if ticket, found := data.GetTicket(id); found {
+		data.changes.Originals[ticketKey(id)] = ticket
+	}
+}
+
+// indexPositions builds the record position maps. As with the other indexes, the first record is used where IDs are duplicated.
+func (data *Dataset) indexPositions() {
+	data.orgPositions = map[int][]int{}
+	for i, org := range data.OrgList {
+		data.orgPositions[org.ID] = append(data.orgPositions[org.ID], i)
+	}
+
+	data.userPositions = map[int][]int{}
+	for i, user := range data.UserList {
+		data.userPositions[user.ID] = append(data.userPositions[user.ID], i)
+	}
+
+	data.ticketPositions = map[string][]int{}
+	for i, ticket := range data.TicketList {
+		data.ticketPositions[ticket.ID] = append(data.ticketPositions[ticket.ID], i)
+	}
+}
+
+// GetOrg returns the org with the given ID, and whether it was found
+func (data *Dataset) GetOrg(id int) (Organization, bool) {
+	positions, found := data.orgPositions[id]
+	if !found {
+		return Organization{}, false
+	}
+
+	return data.OrgList[positions[0]], true
+}
+
+// GetUser returns the user with the given ID, and whether it was found
+func (data *Dataset) GetUser(id int) (User, bool) {
+	positions, found := data.userPositions[id]
+	if !found {
+		return User{}, false
+	}
+
+	return data.UserList[positions[0]], true
+}
+
+// GetTicket returns the ticket with the given ID, and whether it was found
+func (data *Dataset) GetTicket(id string) (Ticket, bool) {
+	positions, found := data.ticketPositions[id]
+	if !found {
+		return Ticket{}, false
+	}
+
+	return data.TicketList[positions[0]], true
+}
+
+// FindOrgs returns the orgs matching a search: a fuzzy match if the search value starts with ~ (but not \~),
+// otherwise a match under the given matching options
+func (data *Dataset) FindOrgs(searchField, searchValue string, opts MatchOptions) ([]Organization, error) {
+	searchValue, fuzzy := parseFuzzyValue(searchValue)
+	if fuzzy {
+		return data.FuzzySearchOrgs(searchField, searchValue)
+	}
+
+	return SearchOrgsWithOptions(searchField, searchValue, data.OrgList, opts)
+}
+
+// FindUsers returns the users matching a search: a fuzzy match if the search value starts with ~ (but not \~),
+// otherwise a match under the given matching options
+func (data *Dataset) FindUsers(searchField, searchValue string, opts MatchOptions) ([]User, error) {
+	searchValue, fuzzy := parseFuzzyValue(searchValue)
+	if fuzzy {
+		return data.FuzzySearchUsers(searchField, searchValue)
+	}
+
+	return SearchUsersWithOptions(searchField, searchValue, data.UserList, opts)
+}
+
+// FindTickets returns the tickets matching a search: overdue tickets for the overdue field, a fuzzy match if the search
+// value starts with ~ (but not \~), otherwise a match under the given matching options
+func (data *Dataset) FindTickets(searchField, searchValue string, opts MatchOptions) ([]Ticket, error) {
+	if strings.EqualFold(searchField, overdueField) {
+		return data.FindOverdueTickets(searchValue)
+	}
+	searchValue, fuzzy := parseFuzzyValue(searchValue)
+	if fuzzy {
+		return data.FuzzySearchTickets(searchField, searchValue)
+	}
+
+	return SearchTicketsWithOptions(searchField, searchValue, data.TicketList, opts)
+}
+
+// UpsertOrg adds an org, or replaces the org with the same ID. Returns true if an existing org was replaced.
+func (data *Dataset) UpsertOrg(org Organization) bool {
+	data.trackOrg(org.ID)
+
+	updateFuzzyIndexes(data.fuzzyIndexes, org)
+	positions, exists := data.orgPositions[org.ID]
+	if exists {
+		updateOrgInDomainIndex(data.OrgDomainIndex, orgDomains(data.OrgList[positions[0]]), org)
+		data.OrgList[positions[0]] = org
+	} else {
+		data.orgPositions[org.ID] = []int{len(data.OrgList)}
+		data.OrgList = append(data.OrgList, org)
+		updateOrgInDomainIndex(data.OrgDomainIndex, nil, org)
+	}
+
+	data.OrgIndex[org.ID] = org
+	return exists
+}
+
+// UpsertUser adds a user, or replaces the user with the same ID. Returns true if an existing user was replaced.
+func (data *Dataset) UpsertUser(user User) bool {
+	data.trackUser(user.ID)
+
+	updateFuzzyIndexes(data.fuzzyIndexes, user)
+	positions, exists := data.userPositions[user.ID]
+	if exists {
+		oldUser := data.UserList[positions[0]]
+		data.UserList[positions[0]] = user
+
+		if oldUser.Org == user.Org {
+			replaceUserInIndex(data.OrgUserIndex, user.Org, user)
+		} else {
+			// only the first user with the ID is replaced, so any others with it stay where they are
+			removeUserFromIndex(data.OrgUserIndex, oldUser.Org, user.ID, 1)
+			data.OrgUserIndex[user.Org] = append(data.OrgUserIndex[user.Org], user)
+		}
+	} else {
+		data.userPositions[user.ID] = []int{len(data.UserList)}
+		data.UserList = append(data.UserList, user)
+		data.OrgUserIndex[user.Org] = append(data.OrgUserIndex[user.Org], user)
+	}
+
+	data.UserIndex[user.ID] = user
+	return exists
+}
+
+// UpsertTicket adds a ticket, or replaces the ticket with the same ID. Returns true if an existing ticket was replaced.
+func (data *Dataset) UpsertTicket(ticket Ticket) bool {
+	data.trackTicket(ticket.ID)
+
+	updateFuzzyIndexes(data.fuzzyIndexes, ticket)
+	positions, exists := data.ticketPositions[ticket.ID]
+	if exists {
+		oldTicket := data.TicketList[positions[0]]
+		data.TicketList[positions[0]] = ticket
+
+		updateTicketInIndex(data.OrgTicketIndex, oldTicket.Org, ticket.Org, ticket)
+		updateTicketInIndex(data.UserSubmittedTixIndex, oldTicket.Submitter, ticket.Submitter, ticket)
+		updateTicketInIndex(data.UserAssignedTixIndex, oldTicket.Assignee, ticket.Assignee, ticket)
+	} else {
+		data.ticketPositions[ticket.ID] = []int{len(data.TicketList)}
+		data.TicketList = append(data.TicketList, ticket)
+
+		data.OrgTicketIndex[ticket.Org] = append(data.OrgTicketIndex[ticket.Org], ticket)
+		data.UserSubmittedTixIndex[ticket.Submitter] = append(data.UserSubmittedTixIndex[ticket.Submitter], ticket)
+		data.UserAssignedTixIndex[ticket.Assignee] = append(data.UserAssignedTixIndex[ticket.Assignee], ticket)
+	}
+
+	return exists
+}
+
+// DeleteOrgs removes the orgs with the given IDs (every record with the ID, where IDs are duplicated), returning the number of
+// IDs removed. Users and tickets referencing them are left as they are (and show up as orphaned references when validating).
+func (data *Dataset) DeleteOrgs(ids ...int) int {
+	deleted := map[int]bool{}
+	removed := []int{}
+	for _, id := range ids {
+		positions, exists := data.orgPositions[id]
+		if !exists || deleted[id] {
+			continue
+		}
+
+		deleted[id] = true
+		data.trackOrg(id)
+		delete(data.OrgIndex, id)
+		removeFromFuzzyIndexes(data.fuzzyIndexes, "Organization", strconv.Itoa(id))
+		for _, pos := range positions {
+			for _, domain := range orgDomains(data.OrgList[pos]) {
+				removeOrgFromDomainIndex(data.OrgDomainIndex, domain, id, -1)
+			}
+		}
+		removed = append(removed, positions...)
+	}
+
+	// swap-remove the records, last position first, so that the record moved into a removed position is never one being removed
+	sort.Sort(sort.Reverse(sort.IntSlice(removed)))
+	for _, pos := range removed {
+		last := len(data.OrgList) - 1
+		if pos != last {
+			data.OrgList[pos] = data.OrgList[last]
+			movePosition(data.orgPositions[data.OrgList[pos].ID], last, pos)
+		}
+		data.OrgList = data.OrgList[:last]
+	}
+	for id := range deleted {
+		delete(data.orgPositions, id)
+	}
+
+	return len(deleted)
+}
+
+// DeleteUsers removes the users with the given IDs (every record with the ID, where IDs are duplicated), returning the number
+// of IDs removed. Tickets referencing them are left as they are.
+func (data *Dataset) DeleteUsers(ids ...int) int {
+	deleted := map[int]bool{}
+	removed := []int{}
+	for _, id := range ids {
+		positions, exists := data.userPositions[id]
+		if !exists || deleted[id] {
+			continue
+		}
+
+		deleted[id] = true
+		data.trackUser(id)
+		delete(data.UserIndex, id)
+		removeFromFuzzyIndexes(data.fuzzyIndexes, "User", strconv.Itoa(id))
+		for _, pos := range positions {
+			removeUserFromIndex(data.OrgUserIndex, data.UserList[pos].Org, id, -1)
+		}
+		removed = append(removed, positions...)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(removed)))
+	for _, pos := range removed {
+		last := len(data.UserList) - 1
+		if pos != last {
+			data.UserList[pos] = data.UserList[last]
+			movePosition(data.userPositions[data.UserList[pos].ID], last, pos)
+		}
+		data.UserList = data.UserList[:last]
+	}
+	for id := range deleted {
+		delete(data.userPositions, id)
+	}
+
+	return len(deleted)
+}
+
+// DeleteTickets removes the tickets with the given IDs (every record with the ID, where IDs are duplicated), returning the
+// number of IDs removed
+func (data *Dataset) DeleteTickets(ids ...string) int {
+	deleted := map[string]bool{}
+	removed := []int{}
+	for _, id := range ids {
+		positions, exists := data.ticketPositions[id]
+		if !exists || deleted[id] {
+			continue
+		}
+
+		deleted[id] = true
+		data.trackTicket(id)
+		removeFromFuzzyIndexes(data.fuzzyIndexes, "Ticket", id)
+		for _, pos := range positions {
+			ticket := data.TicketList[pos]
+			removeTicketFromIndex(data.OrgTicketIndex, ticket.Org, id, -1)
+			removeTicketFromIndex(data.UserSubmittedTixIndex, ticket.Submitter, id, -1)
+			removeTicketFromIndex(data.UserAssignedTixIndex, ticket.Assignee, id, -1)
+		}
+		removed = append(removed, positions...)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(removed)))
+	for _, pos := range removed {
+		last := len(data.TicketList) - 1
+		if pos != last {
+			data.TicketList[pos] = data.TicketList[last]
+			movePosition(data.ticketPositions[data.TicketList[pos].ID], last, pos)
+		}
+		data.TicketList = data.TicketList[:last]
+	}
+	for id := range deleted {
+		delete(data.ticketPositions, id)
+	}
+
+	return len(deleted)
+}
+
+// movePosition updates a record's position, after it was moved into the place of a removed record
+func movePosition(positions []int, from, to int) {
+	for i := range positions {
+		if positions[i] == from {
+			positions[i] = to
+			return
+		}
+	}
+}
+
+// replaceUserInIndex replaces the user with the same ID in an index entry, keeping its position
+func replaceUserInIndex(index map[int][]User, key int, user User) {
+	users := index[key]
+	for i := range users {
+		if users[i].ID == user.ID {
+			users[i] = user
+			return
+		}
+	}
+
+	index[key] = append(users, user)
+}
+
+// removeUserFromIndex removes the first n users with an ID (all of them if n < 0) from an index entry, removing the entry itself
+// once it's empty
+func removeUserFromIndex(index map[int][]User, key int, id int, n int) {
+	users := []User{}
+	for _, user := range index[key] {
+		if user.ID == id && n != 0 {
+			n--
+			continue
+		}
+		users = append(users, user)
+	}
+
+	if len(users) <= 0 {
+		delete(index, key)
+	} else {
+		index[key] = users
+	}
+}
+
+// updateOrgInDomainIndex replaces an org in the entries of the domains it still lists (keeping its position), removes it from
+// the entries of domains it no longer lists and adds it to the entries of new domains
+func updateOrgInDomainIndex(index map[string][]Organization, oldDomains []string, org Organization) {
+	domains := map[string]bool{}
+	for _, domain := range orgDomains(org) {
+		domains[domain] = true
+	}
+
+	for _, domain := range oldDomains {
+		if !domains[domain] {
+			removeOrgFromDomainIndex(index, domain, org.ID, 1)
+			continue
+		}
+
+		delete(domains, domain)
+		orgs := index[domain]
+		for i := range orgs {
+			if orgs[i].ID == org.ID {
+				orgs[i] = org
+				break
+			}
+		}
+	}
+
+	for _, domain := range orgDomains(org) {
+		if domains[domain] {
+			index[domain] = append(index[domain], org)
+		}
+	}
+}
+
+// removeOrgFromDomainIndex removes the first n orgs with an ID (all of them if n < 0) from a domain index entry, removing the
+// entry itself once it's empty
+func removeOrgFromDomainIndex(index map[string][]Organization, domain string, id int, n int) {
+	orgs := []Organization{}
+	for _, org := range index[domain] {
+		if org.ID == id && n != 0 {
+			n--
+			continue
+		}
+		orgs = append(orgs, org)
+	}
+
+	if len(orgs) <= 0 {
+		delete(index, domain)
+	} else {
+		index[domain] = orgs
+	}
+}
+
+// updateTicketInIndex replaces a ticket in an index entry (keeping its position) if its key is unchanged, or moves it to the
+// entry for its new key
+func updateTicketInIndex(index map[int][]Ticket, oldKey, newKey int, ticket Ticket) {
+	if oldKey == newKey {
+		tickets := index[newKey]
+		for i := range tickets {
+			if tickets[i].ID == ticket.ID {
+				tickets[i] = ticket
+				return
+			}
+		}
+	} else {
+		removeTicketFromIndex(index, oldKey, ticket.ID, 1)
+	}
+
+	index[newKey] = append(index[newKey], ticket)
+}
+
+// removeTicketFromIndex removes the first n tickets with an ID (all of them if n < 0) from an index entry, removing the entry
+// itself once it's empty
+func removeTicketFromIndex(index map[int][]Ticket, key int, id string, n int) {
+	tickets := []Ticket{}
+	for _, ticket := range index[key] {
+		if ticket.ID == id && n != 0 {
+			n--
+			continue
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if len(tickets) <= 0 {
+		delete(index, key)
+	} else {
+		index[key] = tickets
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// loadTestDataset loads the sample data set up in the app config
+func loadTestDataset(t *testing.T) *Dataset {
+	orgDataFile, userDataFile, ticketDataFile, err := GetAppConfig()
+	if err != nil {
+		t.Fatal("cannot read config file.\n")
+	}
+
+	OrgList, err := ReadOrganizationData(orgDataFile)
+	if err != nil {
+		t.Fatal("cannot get org list.\n")
+	}
+
+	UserList, err := ReadUserData(userDataFile)
+	if err != nil {
+		t.Fatal("cannot get user list.\n")
+	}
+
+	TicketList, err := ReadTicketData(ticketDataFile)
+	if err != nil {
+		t.Fatal("cannot get ticket list.\n")
+	}
+
+	return NewDataset(OrgList, UserList, TicketList)
+}
+
+// sameTicketIDs compares two ticket index entries by ticket ID, ignoring order
+func sameTicketIDs(a, b []Ticket) bool {
+	ids := map[string]int{}
+	for _, ticket := range a {
+		ids[ticket.ID]++
+	}
+	for _, ticket := range b {
+		ids[ticket.ID]--
+	}
+	for _, count := range ids {
+		if count != 0 {
+			return false
+		}
+	}
+
+	return len(a) == len(b)
+}
+
+// checkIndexesMatchRebuild checks that a dataset's indexes are the same as indexes built from scratch over its data
+func checkIndexesMatchRebuild(t *testing.T, testName string, data *Dataset) {
+	rebuilt := NewDataset(data.OrgList, data.UserList, data.TicketList)
+
+	if !reflect.DeepEqual(data.OrgIndex, rebuilt.OrgIndex) || !reflect.DeepEqual(data.UserIndex, rebuilt.UserIndex) {
+		t.Errorf("%s: org/user indexes differ from rebuilt indexes.\n", testName)
+	}
+
+	if len(data.OrgUserIndex) != len(rebuilt.OrgUserIndex) {
+		t.Errorf("%s: org user index has %d entries, expected %d.\n", testName, len(data.OrgUserIndex), len(rebuilt.OrgUserIndex))
+	}
+	for org, users := range rebuilt.OrgUserIndex {
+		if len(data.OrgUserIndex[org]) != len(users) {
+			t.Errorf("%s: org user index entry %d differs from rebuilt index.\n", testName, org)
+		}
+	}
+
+	if !reflect.DeepEqual(data.OrgDomainIndex, rebuilt.OrgDomainIndex) {
+		t.Errorf("%s: org domain index differs from rebuilt index.\n", testName)
+	}
+
+	for name, indexes := range map[string][2]map[int][]Ticket{
+		"org ticket":            {data.OrgTicketIndex, rebuilt.OrgTicketIndex},
+		"user submitted ticket": {data.UserSubmittedTixIndex, rebuilt.UserSubmittedTixIndex},
+		"user assigned ticket":  {data.UserAssignedTixIndex, rebuilt.UserAssignedTixIndex},
+	} {
+		if len(indexes[0]) != len(indexes[1]) {
+			t.Errorf("%s: %s index has %d entries, expected %d.\n", testName, name, len(indexes[0]), len(indexes[1]))
+		}
+		for key, tickets := range indexes[1] {
+			if !sameTicketIDs(indexes[0][key], tickets) {
+				t.Errorf("%s: %s index entry %d differs from rebuilt index.\n", testName, name, key)
+			}
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	data := loadTestDataset(t)
+
+	delta, err := ReadDeltaFile("testdata/delta.json")
+	if err != nil {
+		t.Fatalf("TestApplyDelta: cannot read delta file - %v\n", err)
+	}
+
+	orgResult, userResult, ticketResult := data.ApplyDelta(delta)
+
+	if orgResult != (DeltaResult{Inserted: 1, Deleted: 1}) || userResult != (DeltaResult{Updated: 1, Deleted: 1, Missing: 1}) || ticketResult != (DeltaResult{Inserted: 1, Updated: 1, Deleted: 1}) {
+		t.Errorf("TestApplyDelta: incorrect change counts: %+v %+v %+v\n", orgResult, userResult, ticketResult)
+	}
+
+	if len(data.OrgList) != 25 || len(data.UserList) != 74 || len(data.TicketList) != 200 {
+		t.Errorf("TestApplyDelta: incorrect record counts after delta: %d orgs, %d users, %d tickets\n", len(data.OrgList), len(data.UserList), len(data.TicketList))
+	}
+
+	ticket, found := data.GetTicket("1a227508-9f39-427c-8f57-1b72f3fab87c")
+	if !found || ticket.Status != "solved" || ticket.Org != 126 {
+		t.Errorf("TestApplyDelta: ticket not updated: %+v\n", ticket)
+	}
+
+	if _, found := data.GetTicket("436bf9b0-1147-4c0a-8439-6f79833bff5b"); found {
+		t.Error("TestApplyDelta: deleted ticket still found.\n")
+	}
+
+	// the updated user and ticket should have moved to the new org
+	orgs := getAssociatedUsersAndTickets([]Organization{data.OrgIndex[126]}, data.OrgUserIndex, data.OrgTicketIndex)
+	if len(orgs[0].AssociatedUsers) != 1 || len(orgs[0].AssociatedTickets) != 2 {
+		t.Errorf("TestApplyDelta: incorrect associations for new org: %d users, %d tickets\n", len(orgs[0].AssociatedUsers), len(orgs[0].AssociatedTickets))
+	}
+
+	checkIndexesMatchRebuild(t, "TestApplyDelta", data)
+}
+
+func TestDeleteDuplicateIDs(t *testing.T) {
+	data := loadTestDataset(t)
+
+	// duplicate a user and a ticket, the copies belonging to other orgs
+	user := data.UserList[0]
+	user.Org = 999
+	ticket := data.TicketList[0]
+	ticket.Org = 999
+	ticket.Submitter = 999
+	data = NewDataset(data.OrgList, append(data.UserList, user), append(data.TicketList, ticket))
+	userCount, ticketCount := len(data.UserList), len(data.TicketList)
+
+	if deleted := data.DeleteUsers(user.ID); deleted != 1 {
+		t.Errorf("TestDeleteDuplicateIDs: %d users deleted, expected 1\n", deleted)
+	}
+	if deleted := data.DeleteTickets(ticket.ID, data.TicketList[5].ID); deleted != 2 {
+		t.Errorf("TestDeleteDuplicateIDs: %d tickets deleted, expected 2\n", deleted)
+	}
+
+	if len(data.UserList) != userCount-2 || len(data.TicketList) != ticketCount-3 {
+		t.Errorf("TestDeleteDuplicateIDs: %d users and %d tickets left, expected %d and %d\n", len(data.UserList), len(data.TicketList), userCount-2, ticketCount-3)
+	}
+
+	if _, found := data.GetUser(user.ID); found {
+		t.Error("TestDeleteDuplicateIDs: deleted user still found.\n")
+	}
+	if len(data.OrgUserIndex[999]) > 0 || len(data.OrgTicketIndex[999]) > 0 || len(data.UserSubmittedTixIndex[999]) > 0 {
+		t.Error("TestDeleteDuplicateIDs: copies of deleted records still indexed.\n")
+	}
+
+	// records moved into the place of deleted ones should still be found
+	for _, user := range data.UserList {
+		if found, _ := data.GetUser(user.ID); !reflect.DeepEqual(found, user) {
+			t.Errorf("TestDeleteDuplicateIDs: user %d not found at its position\n", user.ID)
+		}
+	}
+	for _, ticket := range data.TicketList {
+		if found, _ := data.GetTicket(ticket.ID); !reflect.DeepEqual(found, ticket) {
+			t.Errorf("TestDeleteDuplicateIDs: ticket %s not found at its position\n", ticket.ID)
+		}
+	}
+
+	checkIndexesMatchRebuild(t, "TestDeleteDuplicateIDs", data)
+}
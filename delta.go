@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// -------------------- incremental updates from delta (change) files --------------------
+
+// Delta describes changes to apply to a loaded dataset. A delta file is a JSON object of the form:
+//
+//	{
+//		"organizations": {"upsert": [{"_id": 126, "name": "..."}], "delete": [101]},
+//		"users": {"upsert": [...], "delete": [...]},
+//		"tickets": {"upsert": [...], "delete": ["436bf9b0-1147-4c0a-8439-6f79833bff5b"]}
+//	}
+//
+// Upserted records are complete records in the same format as the data files, and replace any existing record with the same
+// _id. Deletes list the _id values of records to remove.
+type Delta struct {
+	Organizations OrgDelta    `json:"organizations"`
+	Users         UserDelta   `json:"users"`
+	Tickets       TicketDelta `json:"tickets"`
+}
+
+type OrgDelta struct {
+	Upsert []Organization `json:"upsert"`
+	Delete []int          `json:"delete"`
+}
+
+type UserDelta struct {
+	Upsert []User `json:"upsert"`
+	Delete []int  `json:"delete"`
+}
+
+type TicketDelta struct {
+	Upsert []Ticket `json:"upsert"`
+	Delete []string `json:"delete"`
+}
+
+// DeltaResult counts the changes made for one entity type when applying a delta
+type DeltaResult struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+	Missing  int // deletes of records that weren't loaded
+}
+
+// ReadDeltaFile reads a delta from a given file
+func ReadDeltaFile(fileName string) (Delta, error) {
+	delta := Delta{}
+
+	deltaData, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return delta, err
+	}
+
+	err = json.Unmarshal(deltaData, &delta)
+	if err != nil {
+		return delta, fmt.Errorf("Invalid delta file %s: %v", fileName, err)
+	}
+
+	return delta, nil
+}
+
+// ApplyDelta applies upserts and then deletes for each entity type to the dataset, returning counts of the changes made
+// (orgs, users, tickets)
+func (data *Dataset) ApplyDelta(delta Delta) (DeltaResult, DeltaResult, DeltaResult) {
+	orgResult := DeltaResult{}
+	for _, org := range delta.Organizations.Upsert {
+		if data.UpsertOrg(org) {
+			orgResult.Updated++
+		} else {
+			orgResult.Inserted++
+		}
+	}
+	orgResult.Deleted = data.DeleteOrgs(delta.Organizations.Delete...)
+	orgResult.Missing = len(delta.Organizations.Delete) - orgResult.Deleted
+
+	userResult := DeltaResult{}
+	for _, user := range delta.Users.Upsert {
+		if data.UpsertUser(user) {
+			userResult.Updated++
+		} else {
+			userResult.Inserted++
+		}
+	}
+	userResult.Deleted = data.DeleteUsers(delta.Users.Delete...)
+	userResult.Missing = len(delta.Users.Delete) - userResult.Deleted
+
+	ticketResult := DeltaResult{}
+	for _, ticket := range delta.Tickets.Upsert {
+		if data.UpsertTicket(ticket) {
+			ticketResult.Updated++
+		} else {
+			ticketResult.Inserted++
+		}
+	}
+	ticketResult.Deleted = data.DeleteTickets(delta.Tickets.Delete...)
+	ticketResult.Missing = len(delta.Tickets.Delete) - ticketResult.Deleted
+
+	return orgResult, userResult, ticketResult
+}
+
+// FormatDeltaResult outputs the changes made by applying a delta in a human-readable format
+func FormatDeltaResult(orgResult, userResult, ticketResult DeltaResult) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nCHANGES APPLIED\n---------------\n")
+
+	for _, entity := range []struct {
+		name   string
+		result DeltaResult
+	}{{"Organizations", orgResult}, {"Users", userResult}, {"Tickets", ticketResult}} {
+		formattedResult.WriteString(fmt.Sprintf("%s: %d inserted, %d updated, %d deleted", entity.name, entity.result.Inserted, entity.result.Updated, entity.result.Deleted))
+		if entity.result.Missing > 0 {
+			formattedResult.WriteString(fmt.Sprintf(" (%d not found)", entity.result.Missing))
+		}
+		formattedResult.WriteString("\n")
+	}
+
+	return formattedResult.String()
+}
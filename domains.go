@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -------------------- user-to-org inference from email domains --------------------
+
+// kinds of domain issue
+const (
+	domainMissingOrg = "missing org" // user has no (known) org, and one org lists their email domain
+	domainAmbiguous  = "ambiguous"   // user has no (known) org, and several orgs list their email domain
+	domainMismatch   = "org mismatch"
+)
+
+// DomainIssue is a user whose org doesn't agree with the orgs listing their email domain
+type DomainIssue struct {
+	User User
+	Kind string
+	Orgs []Organization // orgs listing the user's email domain
+}
+
+// emailDomain returns the (lower-cased) domain of an email address, or "" if it has none
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// OrgsForEmail returns the orgs listing the domain of an email address. If no org lists the domain itself, parent domains
+// are tried in turn, so that e.g. support.flotonic.com matches an org listing flotonic.com.
+func (data *Dataset) OrgsForEmail(email string) []Organization {
+	domain := emailDomain(email)
+
+	for domain != "" {
+		if orgs := data.OrgDomainIndex[domain]; len(orgs) > 0 {
+			return orgs
+		}
+
+		dot := strings.Index(domain, ".")
+		if dot < 0 || !strings.Contains(domain[dot+1:], ".") {
+			// don't match on top-level domains alone
+			break
+		}
+		domain = domain[dot+1:]
+	}
+
+	return nil
+}
+
+// CheckUserDomains returns users whose email domain is listed by orgs that they don't belong to: users with no (known) org
+// that could be linked to one, and users linked to an org other than the one(s) listing their email domain
+func CheckUserDomains(data *Dataset) []DomainIssue {
+	issues := []DomainIssue{}
+
+	for _, user := range data.UserList {
+		orgs := data.OrgsForEmail(user.Email)
+		if len(orgs) <= 0 {
+			continue
+		}
+
+		if _, knownOrg := data.GetOrg(user.Org); !knownOrg {
+			if len(orgs) == 1 {
+				issues = append(issues, DomainIssue{User: user, Kind: domainMissingOrg, Orgs: orgs})
+			} else {
+				issues = append(issues, DomainIssue{User: user, Kind: domainAmbiguous, Orgs: orgs})
+			}
+			continue
+		}
+
+		matched := false
+		for _, org := range orgs {
+			if org.ID == user.Org {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			issues = append(issues, DomainIssue{User: user, Kind: domainMismatch, Orgs: orgs})
+		}
+	}
+
+	return issues
+}
+
+// FillUserOrgsFromDomains links users with no (known) org to the org listing their email domain, where exactly one org does,
+// returning the number of users updated. Users linked to a different org are left for review.
+func FillUserOrgsFromDomains(data *Dataset) int {
+	filled := 0
+	for _, issue := range CheckUserDomains(data) {
+		if issue.Kind != domainMissingOrg {
+			continue
+		}
+
+		user := issue.User
+		user.Org = issue.Orgs[0].ID
+		data.UpsertUser(user)
+		filled++
+	}
+
+	return filled
+}
+
+// FormatDomainReport outputs domain issues in a human-readable format, grouped by kind
+func FormatDomainReport(issues []DomainIssue) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nEMAIL DOMAINS\n-------------\n")
+
+	if len(issues) <= 0 {
+		formattedResult.WriteString("<All users match the orgs listing their email domains>\n")
+		return formattedResult.String()
+	}
+
+	for _, kind := range []string{domainMissingOrg, domainAmbiguous, domainMismatch} {
+		count := 0
+		for _, issue := range issues {
+			if issue.Kind == kind {
+				count++
+			}
+		}
+		if count <= 0 {
+			continue
+		}
+
+		formattedResult.WriteString(fmt.Sprintf("\n[%s] %d user(s)\n", kind, count))
+		for _, issue := range issues {
+			if issue.Kind != kind {
+				continue
+			}
+
+			orgs := []string{}
+			for _, org := range issue.Orgs {
+				orgs = append(orgs, fmt.Sprintf("%d (%s)", org.ID, org.Name))
+			}
+
+			current := "none"
+			if issue.User.Org != 0 {
+				current = strconv.Itoa(issue.User.Org)
+			}
+
+			formattedResult.WriteString(fmt.Sprintf("\tuser %d (%s, %s): org %s, email domain listed by org %s\n", issue.User.ID, issue.User.Name, issue.User.Email, current, strings.Join(orgs, ", ")))
+		}
+	}
+
+	formattedResult.WriteString("\nRun 'domains fill' to link users with a missing org to the single org listing their email domain.\n")
+	return formattedResult.String()
+}
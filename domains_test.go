@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrgDomainIndex(t *testing.T) {
+	data := loadTestDataset(t)
+
+	org, _ := data.GetOrg(101)
+	if orgs := data.OrgDomainIndex[strings.ToLower(org.DomainNames[0])]; len(orgs) != 1 || orgs[0].ID != 101 {
+		t.Fatalf("TestOrgDomainIndex: domain %s not indexed to org 101\n", org.DomainNames[0])
+	}
+
+	if orgs := data.OrgsForEmail("someone@Support." + org.DomainNames[0]); len(orgs) != 1 || orgs[0].ID != 101 {
+		t.Error("TestOrgDomainIndex: subdomain email not matched to org.\n")
+	}
+
+	if orgs := data.OrgsForEmail("someone@example.com"); len(orgs) != 0 {
+		t.Error("TestOrgDomainIndex: unknown domain matched to an org.\n")
+	}
+
+	// changing an org's domains should update the index in place
+	oldDomain := org.DomainNames[0]
+	org.DomainNames = append([]string{"Example.com"}, org.DomainNames[1:]...)
+	data.UpsertOrg(org)
+	if len(data.OrgDomainIndex[strings.ToLower(oldDomain)]) != 0 || len(data.OrgsForEmail("someone@example.com")) != 1 {
+		t.Error("TestOrgDomainIndex: domain index not updated.\n")
+	}
+
+	data.DeleteOrgs(101)
+	if len(data.OrgsForEmail("someone@example.com")) != 0 {
+		t.Error("TestOrgDomainIndex: deleted org still indexed.\n")
+	}
+
+	checkIndexesMatchRebuild(t, "TestOrgDomainIndex", data)
+}
+
+func TestCheckUserDomains(t *testing.T) {
+	data := loadTestDataset(t)
+
+	org, _ := data.GetOrg(101)
+	data.UpsertUser(User{ID: 900, Name: "No Org", Email: "noorg@" + org.DomainNames[0]})
+	data.UpsertUser(User{ID: 901, Name: "Right Org", Email: "rightorg@" + org.DomainNames[0], Org: 101})
+	data.UpsertUser(User{ID: 902, Name: "Wrong Org", Email: "wrongorg@" + org.DomainNames[0], Org: 102})
+	data.UpsertUser(User{ID: 903, Name: "Unknown Domain", Email: "unknown@example.com"})
+
+	issues := map[int]string{}
+	for _, issue := range CheckUserDomains(data) {
+		issues[issue.User.ID] = issue.Kind
+	}
+
+	if issues[900] != domainMissingOrg || issues[902] != domainMismatch || issues[901] != "" || issues[903] != "" {
+		t.Errorf("TestCheckUserDomains: unexpected issues: %v\n", issues)
+	}
+
+	if !strings.Contains(FormatDomainReport(CheckUserDomains(data)), "user 900 (No Org") {
+		t.Error("TestCheckUserDomains: missing org not reported.\n")
+	}
+
+	data.TakeChanges()
+	if filled := FillUserOrgsFromDomains(data); filled < 1 {
+		t.Fatal("TestCheckUserDomains: no users linked to orgs.\n")
+	}
+
+	// only users without an org should have been changed
+	changes := data.TakeChanges()
+	for id := range changes.Users {
+		if user, _ := data.GetUser(id); issues[id] != domainMissingOrg || user.Org == 0 {
+			t.Errorf("TestCheckUserDomains: user %d changed when filling missing orgs\n", id)
+		}
+	}
+	if user, _ := data.GetUser(900); user.Org != 101 {
+		t.Error("TestCheckUserDomains: user 900 not linked to org 101.\n")
+	}
+	if user, _ := data.GetUser(902); user.Org != 102 {
+		t.Error("TestCheckUserDomains: mismatched user org changed.\n")
+	}
+}
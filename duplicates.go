@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -------------------- duplicate detection and merging --------------------
+
+// DuplicateGroup is a set of users or orgs that look like the same entity, because they share a value of one of their fields
+type DuplicateGroup struct {
+	EntityType string // user or org
+	Match      string // field the records share: email, external_id, name or domain
+	Value      string // shared (normalized) value
+	IDs        []int
+}
+
+// MergeResult counts the records changed by merging duplicates into a surviving record
+type MergeResult struct {
+	Merged         int // duplicates merged (and removed)
+	UsersUpdated   int // users moved to the surviving org
+	TicketsUpdated int // tickets referencing the surviving user/org instead of a duplicate
+}
+
+// normalizeName folds the case of a name and strips accents, removing punctuation and repeated whitespace, so that e.g.
+// "Francisca  Rasmussen." and "francisca rasmüssen" are treated as the same name
+func normalizeName(name string) string {
+	var normalized strings.Builder
+	for _, r := range looseMatchOptions.Normalize(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			normalized.WriteRune(r)
+		}
+	}
+
+	return strings.Join(strings.Fields(normalized.String()), " ")
+}
+
+// duplicateGrouper collects the IDs of records by the values they share
+type duplicateGrouper struct {
+	entityType string
+	values     map[string]map[string][]int // match -> value -> IDs, in the order the records were added
+}
+
+func newDuplicateGrouper(entityType string) *duplicateGrouper {
+	return &duplicateGrouper{entityType: entityType, values: map[string]map[string][]int{}}
+}
+
+func (grouper *duplicateGrouper) add(match, value string, id int) {
+	if value == "" {
+		return
+	}
+
+	if grouper.values[match] == nil {
+		grouper.values[match] = map[string][]int{}
+	}
+	grouper.values[match][value] = append(grouper.values[match][value], id)
+}
+
+// groups returns the values shared by more than one record
+func (grouper *duplicateGrouper) groups() []DuplicateGroup {
+	groups := []DuplicateGroup{}
+	for match, values := range grouper.values {
+		for value, ids := range values {
+			if len(ids) > 1 {
+				groups = append(groups, DuplicateGroup{EntityType: grouper.entityType, Match: match, Value: value, IDs: ids})
+			}
+		}
+	}
+
+	return groups
+}
+
+// FindDuplicates returns groups of users sharing an email address, external ID or (normalized) name, and groups of orgs
+// sharing an external ID, (normalized) name or domain name
+func FindDuplicates(data *Dataset) []DuplicateGroup {
+	users := newDuplicateGrouper("user")
+	for _, user := range data.UserList {
+		users.add("email", strings.ToLower(strings.TrimSpace(user.Email)), user.ID)
+		users.add("external_id", strings.TrimSpace(user.External_id), user.ID)
+		users.add("name", normalizeName(user.Name), user.ID)
+	}
+
+	orgs := newDuplicateGrouper("org")
+	for _, org := range data.OrgList {
+		orgs.add("external_id", strings.TrimSpace(org.External_id), org.ID)
+		orgs.add("name", normalizeName(org.Name), org.ID)
+
+		// an org listing the same domain twice shouldn't be reported as its own duplicate
+		domains := map[string]bool{}
+		for _, domain := range org.DomainNames {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if !domains[domain] {
+				domains[domain] = true
+				orgs.add("domain", domain, org.ID)
+			}
+		}
+	}
+
+	groups := append(users.groups(), orgs.groups()...)
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].EntityType != groups[j].EntityType {
+			return groups[i].EntityType < groups[j].EntityType
+		}
+		if groups[i].Match != groups[j].Match {
+			return groups[i].Match < groups[j].Match
+		}
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
+
+// MergeUsers merges duplicate users into a surviving user: tickets submitted by or assigned to a duplicate are moved to the
+// survivor, fields the survivor is missing are filled in from the duplicates (and tags combined), and the duplicates are removed
+func (data *Dataset) MergeUsers(survivorID int, duplicateIDs ...int) (MergeResult, error) {
+	result := MergeResult{}
+
+	survivor, found := data.GetUser(survivorID)
+	if !found {
+		return result, fmt.Errorf("No user found with ID %d", survivorID)
+	}
+
+	duplicates := map[int]bool{}
+	for _, id := range duplicateIDs {
+		duplicate, found := data.GetUser(id)
+		if !found {
+			return result, fmt.Errorf("No user found with ID %d", id)
+		}
+		if id == survivorID {
+			return result, errors.New("A user cannot be merged into itself")
+		}
+
+		survivor = mergeRecordFields(survivor, duplicate).(User)
+		duplicates[id] = true
+	}
+
+	// collect the tickets first, as updating them changes the indexes
+	ticketIDs := []string{}
+	for id := range duplicates {
+		for _, ticket := range data.UserSubmittedTixIndex[id] {
+			ticketIDs = append(ticketIDs, ticket.ID)
+		}
+		for _, ticket := range data.UserAssignedTixIndex[id] {
+			ticketIDs = append(ticketIDs, ticket.ID)
+		}
+	}
+
+	updated := map[string]bool{}
+	for _, id := range ticketIDs {
+		ticket, _ := data.GetTicket(id)
+		if duplicates[ticket.Submitter] {
+			ticket.Submitter = survivorID
+		}
+		if duplicates[ticket.Assignee] {
+			ticket.Assignee = survivorID
+		}
+
+		if !updated[id] {
+			updated[id] = true
+			result.TicketsUpdated++
+		}
+		data.UpsertTicket(ticket)
+	}
+
+	data.UpsertUser(survivor)
+	result.Merged = data.DeleteUsers(duplicateIDs...)
+
+	return result, nil
+}
+
+// MergeOrgs merges duplicate orgs into a surviving org: users and tickets of a duplicate are moved to the survivor, fields
+// the survivor is missing are filled in from the duplicates (and tags/domain names combined), and the duplicates are removed
+func (data *Dataset) MergeOrgs(survivorID int, duplicateIDs ...int) (MergeResult, error) {
+	result := MergeResult{}
+
+	survivor, found := data.GetOrg(survivorID)
+	if !found {
+		return result, fmt.Errorf("No org found with ID %d", survivorID)
+	}
+
+	for _, id := range duplicateIDs {
+		duplicate, found := data.GetOrg(id)
+		if !found {
+			return result, fmt.Errorf("No org found with ID %d", id)
+		}
+		if id == survivorID {
+			return result, errors.New("An org cannot be merged into itself")
+		}
+
+		survivor = mergeRecordFields(survivor, duplicate).(Organization)
+
+		// copy the index entries, as updating the records changes them
+		users := append([]User{}, data.OrgUserIndex[id]...)
+		for _, user := range users {
+			user.Org = survivorID
+			data.UpsertUser(user)
+			result.UsersUpdated++
+		}
+
+		tickets := append([]Ticket{}, data.OrgTicketIndex[id]...)
+		for _, ticket := range tickets {
+			ticket.Org = survivorID
+			data.UpsertTicket(ticket)
+			result.TicketsUpdated++
+		}
+	}
+
+	data.UpsertOrg(survivor)
+	result.Merged = data.DeleteOrgs(duplicateIDs...)
+
+	return result, nil
+}
+
+// mergeRecordFields returns a copy of a record with its empty string/int fields and custom attributes filled in from another
+// record, and list fields (tags, domain names) combined. Boolean fields are left as they are, as false isn't a missing value.
+func mergeRecordFields(record, other interface{}) interface{} {
+	merged := reflect.New(reflect.TypeOf(record)).Elem()
+	merged.Set(reflect.ValueOf(record))
+	otherValue := reflect.ValueOf(other)
+
+	for i := 0; i < merged.NumField(); i++ {
+		tag := merged.Type().Field(i).Tag.Get("json")
+		if tag == "" || tag == "-" || merged.Type().Field(i).Name == "ID" {
+			continue
+		}
+
+		field, otherField := merged.Field(i), otherValue.Field(i)
+		switch field.Kind() {
+		case reflect.String, reflect.Int:
+			if field.IsZero() {
+				field.Set(otherField)
+			}
+
+		case reflect.Slice:
+			values := append([]string{}, field.Interface().([]string)...)
+			for _, otherItem := range otherField.Interface().([]string) {
+				found := false
+				for _, item := range values {
+					if item == otherItem {
+						found = true
+						break
+					}
+				}
+				if !found {
+					values = append(values, otherItem)
+				}
+			}
+			if len(values) > 0 {
+				field.Set(reflect.ValueOf(values))
+			}
+		}
+	}
+
+	otherCustom := otherValue.FieldByName("Custom").Interface().(CustomAttributes)
+	if len(otherCustom) > 0 {
+		custom := CustomAttributes{}
+		for k, v := range otherCustom {
+			custom[k] = v
+		}
+		for k, v := range merged.FieldByName("Custom").Interface().(CustomAttributes) {
+			custom[k] = v
+		}
+		merged.FieldByName("Custom").Set(reflect.ValueOf(custom))
+	}
+
+	return merged.Interface()
+}
+
+// parseMergeCommand parses a merge command: merge <user|org> <surviving id> <duplicate id> [<duplicate id> ...], returning
+// false if the input isn't a merge command
+func parseMergeCommand(input string) (string, int, []int, bool, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 || strings.ToLower(fields[0]) != "merge" {
+		return "", 0, nil, false, nil
+	}
+
+	formatErr := errors.New("Invalid merge format. Format: $> merge <user|org> <surviving id> <duplicate id> [<duplicate id> ...]")
+	if len(fields) < 4 {
+		return "", 0, nil, true, formatErr
+	}
+
+	entityType := strings.ToLower(fields[1])
+	if entityType != "user" && entityType != "org" {
+		return "", 0, nil, true, fmt.Errorf("Only users and orgs can be merged, not %s", fields[1])
+	}
+
+	ids := []int{}
+	for _, field := range fields[2:] {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return "", 0, nil, true, fmt.Errorf("Invalid %s ID: %s", entityType, field)
+		}
+		ids = append(ids, id)
+	}
+
+	return entityType, ids[0], ids[1:], true, nil
+}
+
+// FormatDuplicates outputs groups of duplicates in a human-readable format, with the command to merge each group
+func FormatDuplicates(groups []DuplicateGroup) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nDUPLICATES\n----------\n")
+
+	if len(groups) <= 0 {
+		formattedResult.WriteString("<No duplicates found>\n")
+		return formattedResult.String()
+	}
+
+	for _, group := range groups {
+		ids := []string{}
+		for _, id := range group.IDs {
+			ids = append(ids, strconv.Itoa(id))
+		}
+
+		formattedResult.WriteString(fmt.Sprintf("\n[%s %s] %q: %s(s) %s\n", group.EntityType, group.Match, group.Value, group.EntityType, strings.Join(ids, ", ")))
+		formattedResult.WriteString(fmt.Sprintf("\tmerge with: merge %s %s\n", group.EntityType, strings.Join(ids, " ")))
+	}
+
+	return formattedResult.String()
+}
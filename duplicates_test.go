@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	data := loadTestDataset(t)
+
+	if groups := FindDuplicates(data); len(groups) != 0 {
+		t.Errorf("TestFindDuplicates: duplicates found in sample data: %+v\n", groups)
+	}
+
+	user, _ := data.GetUser(1)
+	data.UpsertUser(User{ID: 900, Name: "  francisca RASMUSSEN. ", Email: "CoffeyRasmussen@flotonic.com"})
+	data.UpsertUser(User{ID: 901, Name: "Someone Else", External_id: user.External_id})
+
+	org, _ := data.GetOrg(101)
+	data.UpsertOrg(Organization{ID: 902, Name: "Other", DomainNames: []string{"example.com", org.DomainNames[0], org.DomainNames[0]}})
+
+	expected := []DuplicateGroup{
+		{EntityType: "org", Match: "domain", Value: org.DomainNames[0], IDs: []int{101, 902}},
+		{EntityType: "user", Match: "email", Value: "coffeyrasmussen@flotonic.com", IDs: []int{1, 900}},
+		{EntityType: "user", Match: "external_id", Value: user.External_id, IDs: []int{1, 901}},
+		{EntityType: "user", Match: "name", Value: "francisca rasmussen", IDs: []int{1, 900}},
+	}
+
+	if groups := FindDuplicates(data); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("TestFindDuplicates: expected %+v, got %+v\n", expected, groups)
+	}
+}
+
+func TestMergeUsers(t *testing.T) {
+	data := loadTestDataset(t)
+
+	assigned := len(data.UserAssignedTixIndex[2])
+	submitted := len(data.UserSubmittedTixIndex[2])
+
+	// a duplicate of user 2 that has submitted and been assigned a ticket
+	data.UpsertUser(User{ID: 900, Name: "Cross Barlow", Phone: "555-0100", Tags: []string{"Foxworth", "Duplicate"}, Org: 106})
+	ticket, _ := data.GetTicket("1a227508-9f39-427c-8f57-1b72f3fab87c")
+	ticket.Submitter, ticket.Assignee = 900, 900
+	data.UpsertTicket(ticket)
+
+	result, err := data.MergeUsers(2, 900)
+	if err != nil || result.Merged != 1 || result.TicketsUpdated != 1 {
+		t.Fatalf("TestMergeUsers: unexpected merge result %+v (error %v)\n", result, err)
+	}
+
+	survivor, _ := data.GetUser(2)
+	if _, found := data.GetUser(900); found || survivor.Phone == "555-0100" || survivor.Org != 106 || !reflect.DeepEqual(survivor.Tags, []string{"Foxworth", "Woodlands", "Herlong", "Henrietta", "Duplicate"}) {
+		t.Errorf("TestMergeUsers: duplicate not merged into survivor: %+v\n", survivor)
+	}
+
+	if len(data.UserAssignedTixIndex[2]) != assigned+1 || len(data.UserSubmittedTixIndex[2]) != submitted+1 || len(data.UserSubmittedTixIndex[900]) != 0 {
+		t.Error("TestMergeUsers: ticket references not moved to survivor.\n")
+	}
+	checkIndexesMatchRebuild(t, "TestMergeUsers", data)
+
+	if _, err := data.MergeUsers(2, 2); err == nil {
+		t.Error("TestMergeUsers: merging a user into itself not rejected.\n")
+	}
+	if _, err := data.MergeUsers(2, 999); err == nil {
+		t.Error("TestMergeUsers: merging an unknown user not rejected.\n")
+	}
+}
+
+func TestMergeOrgs(t *testing.T) {
+	data := loadTestDataset(t)
+
+	users, tickets := len(data.OrgUserIndex[102]), len(data.OrgTicketIndex[102])
+	survivorUsers, survivorTickets := len(data.OrgUserIndex[101]), len(data.OrgTicketIndex[101])
+
+	result, err := data.MergeOrgs(101, 102)
+	if err != nil || result.Merged != 1 || result.UsersUpdated != users || result.TicketsUpdated != tickets {
+		t.Fatalf("TestMergeOrgs: unexpected merge result %+v (error %v)\n", result, err)
+	}
+
+	if len(data.OrgUserIndex[101]) != survivorUsers+users || len(data.OrgTicketIndex[101]) != survivorTickets+tickets || len(data.OrgUserIndex[102]) != 0 {
+		t.Error("TestMergeOrgs: users/tickets not moved to survivor.\n")
+	}
+
+	if org, _ := data.GetOrg(101); len(org.DomainNames) != 8 {
+		t.Errorf("TestMergeOrgs: domain names not combined: %v\n", org.DomainNames)
+	}
+	checkIndexesMatchRebuild(t, "TestMergeOrgs", data)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// -------------------- query explanation (explain <search>) --------------------
+
+// prefix of a search to explain how it is run, e.g. `explain ticket Status pending`
+const explainPrefix = "explain"
+
+// QueryStage describes one stage of running a search: finding the matching records (search), adding their associated
+// records (augment) or formatting them for output (format)
+type QueryStage struct {
+	Name       string
+	Method     string // how the stage was run, e.g. "full scan", "trigram index Ticket.Subject" or "template ticket.tmpl"
+	Index      bool   // whether indexes were used rather than scanning every record
+	Candidates int    // records examined by the stage
+	Output     int    // records (or for the format stage, bytes) produced by the stage
+	Duration   time.Duration
+}
+
+// QueryPlan describes how a search was parsed and run
+type QueryPlan struct {
+	SearchType  string
+	SearchField string
+	FieldType   string // type of the searched field, e.g. "string" or "[]string" (or "custom attribute")
+	SearchValue string
+	Matching    string // how values are compared, e.g. "exact", "ignore case" or "fuzzy (similarity >= 0.50)"
+	Stages      []QueryStage
+	Results     int
+	Associated  int // associated records added to the results
+}
+
+// parseExplainCommand returns the search following the explain prefix, and false if the input isn't an explain command
+func parseExplainCommand(input string) (string, bool) {
+	words, search := splitWords(input, 1)
+	if len(words) <= 0 || strings.ToLower(words[0]) != explainPrefix {
+		return "", false
+	}
+
+	return search, true
+}
+
+// describeSearch records the parsed search, and how the matching records will be found
+func (plan *QueryPlan) describeSearch(data *Dataset, searchType, searchField, searchValue string, opts MatchOptions) {
+	plan.SearchType, plan.SearchField, plan.SearchValue = searchType, searchField, searchValue
+	plan.Matching = opts.String()
+
+	structName := map[string]string{"org": "Organization", "user": "User", "ticket": "Ticket"}[searchType]
+	records := map[string]int{"org": len(data.OrgList), "user": len(data.UserList), "ticket": len(data.TicketList)}[searchType]
+
+	switch record := recordStructs[structName]; {
+	case record == nil:
+		plan.FieldType = "unknown"
+	case strings.HasPrefix(searchField, customFieldPrefix):
+		plan.FieldType = "custom attribute"
+	case structName == "Ticket" && strings.EqualFold(searchField, overdueField):
+		plan.FieldType = "bool (derived from Due_at and Status)"
+	default:
+		fieldType, err := GetFieldType(record, searchField)
+		if err != nil {
+			fieldType = "unknown"
+		}
+		plan.FieldType = fieldType
+	}
+
+	stage := QueryStage{Name: "search", Method: "full scan", Candidates: records}
+	value, fuzzy := parseFuzzyValue(searchValue)
+	plan.SearchValue = value
+	if fuzzy {
+		plan.Matching = fmt.Sprintf("fuzzy (similarity >= %.2f)", fuzzyMinSimilarity)
+
+		// only records sharing enough trigrams with the search value to match it are scored
+		if index, found := data.fuzzyIndexes[structName+"."+searchField]; found {
+			stage.Method = "trigram index " + structName + "." + searchField
+			stage.Index = true
+			stage.Candidates = len(index.Candidates(plan.SearchValue))
+		}
+	}
+
+	plan.Stages = append(plan.Stages, stage)
+}
+
+// recordSearch records the number of matching records, and the time taken to find them
+func (plan *QueryPlan) recordSearch(result SearchResult, duration time.Duration) {
+	plan.Results = result.Len()
+
+	stage := &plan.Stages[len(plan.Stages)-1]
+	stage.Output = result.Len()
+	stage.Duration = duration
+}
+
+// recordAugment records the associated records added to the search results, and the index lookups used to find them
+func (plan *QueryPlan) recordAugment(result SearchResult, duration time.Duration) {
+	stage := QueryStage{Name: "augment", Index: true, Candidates: result.Len(), Duration: duration}
+
+	switch result.SearchType {
+	case "org":
+		stage.Method = "OrgUserIndex, OrgTicketIndex lookups"
+		for _, org := range result.Orgs {
+			stage.Output += len(org.AssociatedUsers) + len(org.AssociatedTickets)
+		}
+
+	case "user":
+		stage.Method = "OrgIndex, UserSubmittedTixIndex, UserAssignedTixIndex lookups"
+		for _, user := range result.Users {
+			stage.Output += len(user.TicketsSubmitted) + len(user.TicketsAssigned)
+			if user.OrgObject.ID != 0 {
+				stage.Output++
+			}
+		}
+
+	case "ticket":
+		stage.Method = "UserIndex, OrgIndex lookups"
+		for _, ticket := range result.Tickets {
+			for _, id := range []int{ticket.SubmitterObj.ID, ticket.AssigneeObj.ID, ticket.OrgObj.ID} {
+				if id != 0 {
+					stage.Output++
+				}
+			}
+		}
+	}
+
+	plan.Associated = stage.Output
+	plan.Stages = append(plan.Stages, stage)
+}
+
+// Explain runs a search (including formatting its results the way search results are output, with the given templates and
+// style, discarding them), returning how it was run
+func Explain(data *Dataset, searchInput string, templates *OutputTemplates, style OutputStyle) (QueryPlan, error) {
+	plan := QueryPlan{}
+
+	result, err := data.Search(searchInput, &plan)
+	if err != nil {
+		return plan, err
+	}
+
+	start := time.Now()
+	formatted, err := FormatSearchOutput(result, templates, style)
+	duration := time.Since(start)
+	if err != nil {
+		return plan, err
+	}
+
+	method := fmt.Sprintf("built-in format (%s)", style.Name())
+	if name := templates.Name(result.SearchType); name != "" {
+		method = "template " + name
+	}
+	plan.Stages = append(plan.Stages, QueryStage{Name: "format", Method: method, Candidates: result.Len(), Output: len(formatted), Duration: duration})
+
+	return plan, nil
+}
+
+// FormatQueryPlan outputs a query plan in a human-readable format: the parsed query, each stage with the records going in
+// and out of it and its timing, and the result counts
+func FormatQueryPlan(plan QueryPlan) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nEXPLAIN\n-------\n")
+
+	formattedResult.WriteString(fmt.Sprintf("search %s\n", plan.SearchType))
+	formattedResult.WriteString(fmt.Sprintf("  ├─ field: %s (%s)\n", plan.SearchField, plan.FieldType))
+	formattedResult.WriteString(fmt.Sprintf("  ├─ value: %q\n", plan.SearchValue))
+	formattedResult.WriteString(fmt.Sprintf("  └─ matching: %s\n", plan.Matching))
+
+	var total time.Duration
+	for _, stage := range plan.Stages {
+		total += stage.Duration
+	}
+
+	formattedResult.WriteString("\nStages:\n")
+	for i, stage := range plan.Stages {
+		// formatting doesn't look records up, so only the search and augment stages show how records were accessed
+		access := ""
+		if stage.Name != "format" {
+			access = "[scan] "
+			if stage.Index {
+				access = "[index] "
+			}
+		}
+
+		unit := "record(s)"
+		if stage.Name == "format" {
+			unit = "byte(s)"
+		} else if stage.Name == "augment" {
+			unit = "associated record(s)"
+		}
+
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(stage.Duration) / float64(total)
+		}
+
+		formattedResult.WriteString(fmt.Sprintf("  %d. %-8s %s%s\n", i+1, stage.Name, access, stage.Method))
+		formattedResult.WriteString(fmt.Sprintf("       %d record(s) in, %d %s out, %v (%.0f%%)\n", stage.Candidates, stage.Output, unit, stage.Duration, share))
+	}
+
+	formattedResult.WriteString(fmt.Sprintf("\nResults: %d %s(s), %d associated record(s)\n", plan.Results, plan.SearchType, plan.Associated))
+	formattedResult.WriteString(fmt.Sprintf("Total time: %v\n", total))
+
+	return formattedResult.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	data := loadTestDataset(t)
+
+	plan, err := Explain(data, "ticket Status pending", nil, NewOutputStyle(false))
+	if err != nil {
+		t.Fatalf("TestExplain: unexpected error: %v\n", err)
+	}
+
+	tickets, _ := SearchTickets("Status", "pending", data.TicketList)
+	if plan.SearchType != "ticket" || plan.SearchField != "Status" || plan.FieldType != "string" || plan.SearchValue != "pending" || plan.Matching != "exact" {
+		t.Errorf("TestExplain: query not described correctly: %+v\n", plan)
+	}
+
+	if len(plan.Stages) != 3 || plan.Stages[0].Name != "search" || plan.Stages[1].Name != "augment" || plan.Stages[2].Name != "format" {
+		t.Fatalf("TestExplain: unexpected stages: %+v\n", plan.Stages)
+	}
+
+	// an exact search scans every ticket
+	if search := plan.Stages[0]; search.Index || search.Candidates != len(data.TicketList) || search.Output != len(tickets) || plan.Results != len(tickets) {
+		t.Errorf("TestExplain: unexpected search stage: %+v\n", search)
+	}
+
+	if augment := plan.Stages[1]; !augment.Index || augment.Candidates != len(tickets) || augment.Output != plan.Associated || augment.Output <= 0 {
+		t.Errorf("TestExplain: unexpected augment stage: %+v\n", augment)
+	}
+
+	if format := plan.Stages[2]; format.Method != "built-in format (plain)" || format.Output != len(FormatTicketResult(getAssociatedUsersAndOrgs(tickets, data.UserIndex, data.OrgIndex))) {
+		t.Errorf("TestExplain: unexpected format stage: %+v\n", format)
+	}
+
+	// the format stage formats results the way they're output, with any template or colors
+	templates, err := LoadOutputTemplates(map[string]string{"ticket": "templates/ticket-summary.tmpl"})
+	if err != nil {
+		t.Fatalf("TestExplain: cannot load template - %v\n", err)
+	}
+	result, _ := data.Search("ticket Status pending", nil)
+	templated, _ := FormatSearchOutput(result, templates, NewOutputStyle(true))
+
+	plan, _ = Explain(data, "ticket Status pending", templates, NewOutputStyle(true))
+	if format := plan.Stages[len(plan.Stages)-1]; format.Method != "template ticket-summary.tmpl" || format.Output != len(templated) {
+		t.Errorf("TestExplain: unexpected format stage with a template: %+v\n", format)
+	}
+
+	plan, _ = Explain(data, "user Name Francisca Rasmussen", templates, NewOutputStyle(true))
+	if format := plan.Stages[len(plan.Stages)-1]; format.Method != "built-in format (ANSI)" {
+		t.Errorf("TestExplain: unexpected format stage with colors: %+v\n", format)
+	}
+
+	// a fuzzy search only scores the tickets sharing enough trigrams with the search value to match it
+	plan, err = Explain(data, "ticket Subject ~korea", nil, NewOutputStyle(false))
+	if err != nil {
+		t.Fatalf("TestExplain: unexpected error: %v\n", err)
+	}
+
+	matches, _ := data.FuzzySearchTickets("Subject", "korea")
+	if search := plan.Stages[0]; !search.Index || search.Candidates <= len(matches) || search.Candidates >= len(data.TicketList) || search.Output != len(matches) {
+		t.Errorf("TestExplain: unexpected fuzzy search stage: %+v\n", search)
+	}
+	if !strings.HasPrefix(plan.Matching, "fuzzy") || plan.SearchValue != "korea" {
+		t.Errorf("TestExplain: fuzzy query not described correctly: %+v\n", plan)
+	}
+
+	plan, _ = Explain(data, "org:ia custom.notes.region emea", nil, NewOutputStyle(false))
+	if plan.FieldType != "custom attribute" || plan.Matching != "ignore case, strip accents" {
+		t.Errorf("TestExplain: unexpected plan for a custom attribute search: %+v\n", plan)
+	}
+
+	for _, input := range []string{"ticket", "bad Status pending", "ticket NoSuchField x"} {
+		if _, err := Explain(data, input, nil, NewOutputStyle(false)); err == nil {
+			t.Errorf("TestExplain: expected an error for %q\n", input)
+		}
+	}
+}
+
+func TestParseExplainCommand(t *testing.T) {
+	if search, isExplain := parseExplainCommand("EXPLAIN  ticket Status pending\n"); !isExplain || search != "ticket Status pending" {
+		t.Errorf("TestParseExplainCommand: unexpected result %q %v\n", search, isExplain)
+	}
+
+	if _, isExplain := parseExplainCommand("explained ticket Status pending"); isExplain {
+		t.Error("TestParseExplainCommand: search parsed as an explain command.\n")
+	}
+}
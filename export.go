@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------------------- exporting search results as reports --------------------
+
+// exportWriter writes a report to a file (or a file for each table, named after the given file), returning the files
+// written. A file of "-" writes the report to the standard output.
+type exportWriter func(file string, report ExportReport) ([]string, error)
+
+// formats search results can be exported to, with the function writing each
+var exportFormats = map[string]exportWriter{
+	"html": writeReportFile(WriteHTMLReport),
+	"md":   writeReportFile(WriteMarkdownReport),
+	"csv": func(file string, report ExportReport) ([]string, error) {
+		return WriteCSVReport(file, report, false)
+	},
+	// for spreadsheets that only read CSV files as UTF-8 if they start with a byte order mark
+	"csv-bom": func(file string, report ExportReport) ([]string, error) {
+		return WriteCSVReport(file, report, true)
+	},
+}
+
+// utf8ByteOrderMark marks a file as UTF-8
+const utf8ByteOrderMark = "\ufeff"
+
+// ExportCell is a value in a report table, optionally linking to another record in the report ("#<anchor>") or a URL
+type ExportCell struct {
+	Text string
+	Link string
+}
+
+// ExportRow is a record in a report table, with the anchor other records link to it by
+type ExportRow struct {
+	Anchor string
+	Cells  []ExportCell
+}
+
+// ExportTable is a table of records of one type
+type ExportTable struct {
+	ID      string
+	Title   string
+	Columns []string
+	Rows    []ExportRow
+}
+
+// ExportReport holds the records of a search result and their associated records, in a table for each type (the search
+// results first), with a summary of the search
+type ExportReport struct {
+	Search    string
+	Generated time.Time
+	Summary   []string
+	Tables    []ExportTable
+}
+
+// parseExportCommand parses an export command: export <format> <file> <searchtype> <searchfield> <search value>. Returns
+// false if the input isn't an export command.
+func parseExportCommand(input string) (string, string, string, bool, error) {
+	fields := strings.SplitN(strings.TrimSpace(input), " ", 4)
+	if strings.ToLower(fields[0]) != "export" {
+		return "", "", "", false, nil
+	}
+
+	if len(fields) < 4 {
+		return "", "", "", true, fmt.Errorf("Invalid export format. Format: $> export <%s> <file> <searchtype> <searchfield> <search value>", strings.Join(exportFormatNames(), "|"))
+	}
+
+	format := strings.ToLower(fields[1])
+	if _, found := exportFormats[format]; !found {
+		return "", "", "", true, fmt.Errorf("Unsupported export format: %s (use %s)", fields[1], strings.Join(exportFormatNames(), ", "))
+	}
+
+	return format, fields[2], strings.TrimSpace(fields[3]), true, nil
+}
+
+// exportFormatNames returns the names of the export formats, sorted
+func exportFormatNames() []string {
+	names := []string{}
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ExportSearch runs a search and writes its results, with their associated records, in an export format. Returns the
+// files written.
+func ExportSearch(data *Dataset, format, file, search string) (SearchResult, []string, error) {
+	result, err := data.Search(search, nil)
+	if err != nil {
+		return result, nil, err
+	}
+
+	files, err := exportFormats[format](file, NewExportReport(search, result, time.Now()))
+	return result, files, err
+}
+
+// writeReportFile returns an export writer writing a report to a single file (or the standard output)
+func writeReportFile(write func(io.Writer, ExportReport) error) exportWriter {
+	return func(file string, report ExportReport) ([]string, error) {
+		if file == "-" {
+			return nil, write(os.Stdout, report)
+		}
+
+		out, err := os.Create(file)
+		if err != nil {
+			return nil, err
+		}
+
+		err = write(out, report)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// don't leave a partly written report behind
+			os.Remove(file)
+			return nil, err
+		}
+		return []string{file}, nil
+	}
+}
+
+// NewExportReport builds the report of a search result: a table of the matching records, then tables of the orgs, users
+// and tickets associated with them (each record is listed once)
+func NewExportReport(search string, result SearchResult, generated time.Time) ExportReport {
+	orgs, users, tickets := map[int]Organization{}, map[int]User{}, map[string]Ticket{}
+	orgIDs, userIDs, ticketIDs := []int{}, []int{}, []string{}
+
+	addOrg := func(org Organization) {
+		if _, found := orgs[org.ID]; !found && org.ID != 0 {
+			orgs[org.ID] = org
+			orgIDs = append(orgIDs, org.ID)
+		}
+	}
+	addUser := func(user User) {
+		if _, found := users[user.ID]; !found && user.ID != 0 {
+			users[user.ID] = user
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+	addTicket := func(ticket Ticket) {
+		if _, found := tickets[ticket.ID]; !found && ticket.ID != "" {
+			tickets[ticket.ID] = ticket
+			ticketIDs = append(ticketIDs, ticket.ID)
+		}
+	}
+
+	// the search results first, then their associated records
+	for _, org := range result.Orgs {
+		addOrg(org)
+	}
+	for _, user := range result.Users {
+		addUser(user)
+	}
+	for _, ticket := range result.Tickets {
+		addTicket(ticket)
+	}
+	for _, org := range result.Orgs {
+		for _, user := range org.AssociatedUsers {
+			addUser(user)
+		}
+		for _, ticket := range org.AssociatedTickets {
+			addTicket(ticket)
+		}
+	}
+	for _, user := range result.Users {
+		addOrg(user.OrgObject)
+		for _, ticket := range append(append([]Ticket{}, user.TicketsSubmitted...), user.TicketsAssigned...) {
+			addTicket(ticket)
+		}
+	}
+	for _, ticket := range result.Tickets {
+		addOrg(ticket.OrgObj)
+		addUser(ticket.SubmitterObj)
+		addUser(ticket.AssigneeObj)
+	}
+
+	// links to records in the report go to their anchors
+	orgLink := func(id int) ExportCell {
+		if _, found := orgs[id]; found {
+			return ExportCell{Text: orgs[id].Name, Link: fmt.Sprintf("#org-%d", id)}
+		}
+		return ExportCell{Text: unresolvedText("org", id)}
+	}
+	userLink := func(id int) ExportCell {
+		if _, found := users[id]; found {
+			return ExportCell{Text: users[id].Name, Link: fmt.Sprintf("#user-%d", id)}
+		}
+		return ExportCell{Text: unresolvedText("user", id)}
+	}
+
+	orgTable := ExportTable{ID: "orgs", Columns: []string{"ID", "Name", "Domain names", "Details", "Shared tickets", "Tags", "Created at"}}
+	for _, id := range orgIDs {
+		org := orgs[id]
+		orgTable.Rows = append(orgTable.Rows, ExportRow{Anchor: fmt.Sprintf("org-%d", id), Cells: []ExportCell{
+			{Text: strconv.Itoa(id), Link: org.URL}, {Text: org.Name}, {Text: strings.Join(org.DomainNames, ", ")}, {Text: org.Details},
+			{Text: strconv.FormatBool(org.Shared_tickets)}, {Text: strings.Join(org.Tags, ", ")}, {Text: org.Created_at},
+		}})
+	}
+
+	userTable := ExportTable{ID: "users", Columns: []string{"ID", "Name", "Alias", "Email", "Role", "Organization", "Active", "Suspended", "Created at", "Last login at"}}
+	for _, id := range userIDs {
+		user := users[id]
+		userTable.Rows = append(userTable.Rows, ExportRow{Anchor: fmt.Sprintf("user-%d", id), Cells: []ExportCell{
+			{Text: strconv.Itoa(id), Link: user.URL}, {Text: user.Name}, {Text: user.Alias}, {Text: user.Email}, {Text: user.Role},
+			orgLink(user.Org), {Text: strconv.FormatBool(user.Active)}, {Text: strconv.FormatBool(user.Suspended)},
+			{Text: user.Created_at}, {Text: user.Last_login_at},
+		}})
+	}
+
+	ticketTable := ExportTable{ID: "tickets", Columns: []string{"ID", "Subject", "Status", "Priority", "Type", "Organization", "Submitter", "Assignee", "Created at", "Due at", "Tags"}}
+	for _, id := range ticketIDs {
+		ticket := tickets[id]
+		ticketTable.Rows = append(ticketTable.Rows, ExportRow{Anchor: "ticket-" + id, Cells: []ExportCell{
+			{Text: id, Link: ticket.URL}, {Text: ticket.Subject}, {Text: ticket.Status}, {Text: ticket.Priority}, {Text: ticket.Type},
+			orgLink(ticket.Org), userLink(ticket.Submitter), userLink(ticket.Assignee), {Text: ticket.Created_at}, {Text: ticket.Due_at},
+			{Text: strings.Join(ticket.Tags, ", ")},
+		}})
+	}
+
+	// the search results' table first, titled with the number of results
+	tables := map[string]*ExportTable{"org": &orgTable, "user": &userTable, "ticket": &ticketTable}
+	names := map[string]string{"org": "Organizations", "user": "Users", "ticket": "Tickets"}
+	report := ExportReport{Search: search, Generated: generated}
+	report.Summary = append(report.Summary, fmt.Sprintf("%d %s matching %s (%s matching)", result.Len(), strings.ToLower(names[result.SearchType]), search, result.MatchOptions))
+
+	related := []string{}
+	order := []string{result.SearchType}
+	for _, searchType := range entityTypes {
+		if searchType != result.SearchType {
+			order = append(order, searchType)
+		}
+	}
+	for i, searchType := range order {
+		table := tables[searchType]
+		if i == 0 {
+			table.Title = fmt.Sprintf("%s matching the search (%d)", names[searchType], len(table.Rows))
+		} else {
+			if len(table.Rows) <= 0 {
+				continue
+			}
+			table.Title = fmt.Sprintf("Related %s (%d)", strings.ToLower(names[searchType]), len(table.Rows))
+			related = append(related, fmt.Sprintf("%d %s", len(table.Rows), strings.ToLower(names[searchType])))
+		}
+
+		report.Tables = append(report.Tables, *table)
+	}
+
+	if len(related) > 0 {
+		report.Summary = append(report.Summary, "Related records: "+strings.Join(related, ", "))
+	}
+
+	return report
+}
+
+// unresolvedText describes a reference to a record that isn't in the data (or no record)
+func unresolvedText(entityName string, id int) string {
+	return strings.TrimSpace(formatUnresolvedReference(entityName, id))
+}
+
+// page of an HTML report, self-contained (styles and the script sorting tables are inline)
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Search results: {{.Search}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+.summary { color: #555; margin-top: 0; }
+table { border-collapse: collapse; margin-bottom: 2em; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; cursor: pointer; user-select: none; white-space: nowrap; }
+th[data-order="asc"]::after { content: " \25B2"; }
+th[data-order="desc"]::after { content: " \25BC"; }
+tr:target { background: #fff3c4; }
+a { color: #0645ad; }
+</style>
+</head>
+<body>
+<h1>Search results: {{.Search}}</h1>
+{{range .Summary}}<p class="summary">{{.}}</p>
+{{end}}<p class="summary">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}. Click a column heading to sort by it.</p>
+{{range .Tables}}
+<h2 id="{{.ID}}">{{.Title}}</h2>
+<table class="sortable">
+<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr id="{{.Anchor}}">{{range .Cells}}<td>{{if .Link}}<a href="{{.Link}}">{{.Text}}</a>{{else}}{{.Text}}{{end}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (heading, column) {
+    heading.addEventListener("click", function () {
+      var ascending = heading.getAttribute("data-order") !== "asc";
+      table.querySelectorAll("th").forEach(function (other) { other.removeAttribute("data-order"); });
+      heading.setAttribute("data-order", ascending ? "asc" : "desc");
+
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column].textContent, y = b.cells[column].textContent;
+        var order = (x !== "" && y !== "" && !isNaN(x) && !isNaN(y)) ? x - y : x.localeCompare(y);
+        return ascending ? order : -order;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// WriteHTMLReport writes a report as a self-contained HTML page, with a sortable table of each type of record. Records
+// link to each other within the page, and their IDs link to their URLs.
+func WriteHTMLReport(out io.Writer, report ExportReport) error {
+	return htmlReportTemplate.Execute(out, report)
+}
+
+// markdownEscaper escapes the characters with a meaning in Markdown, and newlines (which would end a table row)
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "<", "\\<", ">", "\\>", "|", "\\|", "\r\n", " ", "\n", " ")
+
+// markdownLinkEscaper percent-encodes the characters that would end a link destination written in angle brackets (which
+// can hold spaces and parentheses), or the table row it is in
+var markdownLinkEscaper = strings.NewReplacer("<", "%3C", ">", "%3E", "|", "%7C", "\\", "%5C", "\r", "%0D", "\n", "%0A")
+
+// WriteMarkdownReport writes a report as Markdown, with a table of each type of record. Record IDs link to their URLs
+// (links within the report aren't kept, as wikis don't give table rows anchors).
+func WriteMarkdownReport(out io.Writer, report ExportReport) error {
+	var markdown strings.Builder
+	markdown.WriteString(fmt.Sprintf("# Search results: %s\n\n", markdownEscaper.Replace(report.Search)))
+	for _, line := range report.Summary {
+		markdown.WriteString(markdownEscaper.Replace(line) + "  \n")
+	}
+	markdown.WriteString(fmt.Sprintf("Generated %s\n", report.Generated.Format("2006-01-02 15:04:05 MST")))
+
+	for _, table := range report.Tables {
+		markdown.WriteString(fmt.Sprintf("\n## %s\n\n", markdownEscaper.Replace(table.Title)))
+		markdown.WriteString("| " + strings.Join(table.Columns, " | ") + " |\n")
+		markdown.WriteString(strings.Repeat("| --- ", len(table.Columns)) + "|\n")
+
+		for _, row := range table.Rows {
+			cells := []string{}
+			for _, cell := range row.Cells {
+				text := markdownEscaper.Replace(cell.Text)
+				if cell.Link != "" && !strings.HasPrefix(cell.Link, "#") {
+					text = fmt.Sprintf("[%s](<%s>)", text, markdownLinkEscaper.Replace(cell.Link))
+				}
+				cells = append(cells, text)
+			}
+			markdown.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+	}
+
+	_, err := io.WriteString(out, markdown.String())
+	return err
+}
+
+// WriteCSVReport writes each table of a report to a CSV file named after the given file and the table (e.g. report.csv
+// gives report-tickets.csv, report-orgs.csv and report-users.csv), for opening as spreadsheets. The URL a record's ID
+// links to gets a column of its own, as do the IDs of the records other columns link to (e.g. a ticket's submitter).
+func WriteCSVReport(file string, report ExportReport, byteOrderMark bool) ([]string, error) {
+	if file == "-" {
+		return nil, fmt.Errorf("CSV exports are written to a file for each record type, not the standard output")
+	}
+
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	files := []string{}
+	for _, table := range report.Tables {
+		tableFile := fmt.Sprintf("%s-%s.csv", base, table.ID)
+		if err := writeCSVTable(tableFile, table, byteOrderMark); err != nil {
+			// remove the tables already written, so a failed export leaves no partial report behind
+			for _, written := range files {
+				os.Remove(written)
+			}
+			return nil, fmt.Errorf("Cannot write %s: %v", tableFile, err)
+		}
+		files = append(files, tableFile)
+	}
+
+	return files, nil
+}
+
+// csvFormulaPrefixes start cell values that spreadsheets would evaluate as formulas
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell returns a value to write to a CSV cell, prefixing values that a spreadsheet would evaluate as a formula (e.g.
+// =HYPERLINK(...) in a ticket subject) with ' so they are shown as text
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+// writeCSVTable writes a report table to a CSV file, removing the file if it can't be written in full
+func writeCSVTable(file string, table ExportTable, byteOrderMark bool) (err error) {
+	// columns linking to URLs or other records get a column for the URL or the record's ID
+	urlColumns, idColumns := map[int]bool{}, map[int]bool{}
+	for _, row := range table.Rows {
+		for i, cell := range row.Cells {
+			urlColumns[i] = urlColumns[i] || (cell.Link != "" && !strings.HasPrefix(cell.Link, "#"))
+			idColumns[i] = idColumns[i] || strings.HasPrefix(cell.Link, "#")
+		}
+	}
+
+	header := []string{}
+	for i, column := range table.Columns {
+		if idColumns[i] {
+			header = append(header, column+" ID")
+		}
+		header = append(header, column)
+		if urlColumns[i] {
+			header = append(header, "URL")
+		}
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(file)
+		}
+	}()
+
+	if byteOrderMark {
+		if _, err := io.WriteString(out, utf8ByteOrderMark); err != nil {
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(out)
+	writer.UseCRLF = true
+	writer.Write(header)
+	for _, row := range table.Rows {
+		record := []string{}
+		for i, cell := range row.Cells {
+			if idColumns[i] {
+				// the ID of the linked record, from its anchor (e.g. #user-38)
+				id := ""
+				if parts := strings.SplitN(strings.TrimPrefix(cell.Link, "#"), "-", 2); strings.HasPrefix(cell.Link, "#") && len(parts) == 2 {
+					id = parts[1]
+				}
+				record = append(record, csvCell(id))
+			}
+			record = append(record, csvCell(cell.Text))
+			if urlColumns[i] {
+				url := cell.Link
+				if strings.HasPrefix(url, "#") {
+					url = ""
+				}
+				record = append(record, csvCell(url))
+			}
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return out.Close()
+}
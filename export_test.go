@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExportCommand(t *testing.T) {
+	format, file, search, isExportCommand, err := parseExportCommand("export HTML report.html ticket Subject A Problem in Oman")
+	if !isExportCommand || err != nil || format != "html" || file != "report.html" || search != "ticket Subject A Problem in Oman" {
+		t.Errorf("TestParseExportCommand: unexpected parse: %q %q %q (error %v)\n", format, file, search, err)
+	}
+
+	for _, input := range []string{"export", "export html report.html", "export pdf report.pdf ticket Status open"} {
+		if _, _, _, isExportCommand, err := parseExportCommand(input); !isExportCommand || err == nil {
+			t.Errorf("TestParseExportCommand: expected an error for %q\n", input)
+		}
+	}
+
+	if _, _, _, isExportCommand, _ := parseExportCommand("ticket Subject export"); isExportCommand {
+		t.Errorf("TestParseExportCommand: search taken for an export command\n")
+	}
+}
+
+func TestNewExportReport(t *testing.T) {
+	data := loadTestDataset(t)
+
+	result, _ := data.Search("ticket Status hold", nil)
+	report := NewExportReport("ticket Status hold", result, time.Now())
+
+	if len(report.Tables) != 3 || report.Tables[0].ID != "tickets" || len(report.Tables[0].Rows) != len(result.Tickets) {
+		t.Fatalf("TestNewExportReport: expected the tickets first, then related orgs and users: %d table(s)\n", len(report.Tables))
+	}
+	if report.Tables[1].ID != "orgs" || report.Tables[2].ID != "users" || !strings.HasPrefix(report.Tables[1].Title, "Related organizations") {
+		t.Errorf("TestNewExportReport: unexpected related tables: %s, %s\n", report.Tables[1].Title, report.Tables[2].Title)
+	}
+	if !strings.HasPrefix(report.Summary[0], "37 tickets matching ticket Status hold") {
+		t.Errorf("TestNewExportReport: unexpected summary: %v\n", report.Summary)
+	}
+
+	// every record is listed once, and every link within the report goes to a record in it
+	anchors := map[string]bool{}
+	for _, table := range report.Tables {
+		for _, row := range table.Rows {
+			if anchors[row.Anchor] {
+				t.Errorf("TestNewExportReport: %s listed more than once\n", row.Anchor)
+			}
+			anchors[row.Anchor] = true
+		}
+	}
+	for _, table := range report.Tables {
+		for _, row := range table.Rows {
+			if !strings.HasPrefix(row.Cells[0].Link, "http") {
+				t.Errorf("TestNewExportReport: %s doesn't link to its URL\n", row.Anchor)
+			}
+			for _, cell := range row.Cells {
+				if strings.HasPrefix(cell.Link, "#") && !anchors[cell.Link[1:]] {
+					t.Errorf("TestNewExportReport: %s links to %s, which isn't in the report\n", row.Anchor, cell.Link)
+				}
+			}
+		}
+	}
+
+	// an org's users and tickets are related records
+	result, _ = data.Search("org ID 101", nil)
+	report = NewExportReport("org ID 101", result, time.Now())
+	if len(report.Tables) != 3 || len(report.Tables[1].Rows) != len(data.OrgUserIndex[101]) || len(report.Tables[2].Rows) != len(data.OrgTicketIndex[101]) {
+		t.Errorf("TestNewExportReport: unexpected tables for an org\n")
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	result := SearchResult{SearchType: "ticket", SearchField: "Subject", SearchValue: "<script>", Tickets: []Ticket{{ID: "t1", Subject: "<script>alert(1)</script>", Org: 999}}}
+
+	out := &bytes.Buffer{}
+	if err := WriteHTMLReport(out, NewExportReport("ticket Subject <script>", result, time.Now())); err != nil {
+		t.Fatalf("TestWriteHTMLReport: unexpected error: %v\n", err)
+	}
+
+	page := out.String()
+	if strings.Contains(page, "<script>alert") || !strings.Contains(page, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("TestWriteHTMLReport: values not escaped\n")
+	}
+	if !strings.Contains(page, `<tr id="ticket-t1">`) || !strings.Contains(page, "&lt;unknown org 999&gt;") || !strings.Contains(page, `class="sortable"`) {
+		t.Errorf("TestWriteHTMLReport: unexpected page: %s\n", page)
+	}
+}
+
+func TestExportSearch(t *testing.T) {
+	data := loadTestDataset(t)
+
+	dir, err := ioutil.TempDir("", "TestExportSearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "report.html")
+	result, files, err := ExportSearch(data, "html", file, "user Role admin")
+	if err != nil || len(files) != 1 || files[0] != file {
+		t.Fatalf("TestExportSearch: unexpected error: %v\n", err)
+	}
+
+	page, _ := ioutil.ReadFile(file)
+	if !bytes.Contains(page, []byte("<h2 id=\"users\">Users matching the search")) || bytes.Count(page, []byte(`<tr id="user-`)) != len(result.Users) {
+		t.Errorf("TestExportSearch: unexpected report\n")
+	}
+
+	if _, _, err := ExportSearch(data, "html", file, "thing Name x"); err == nil {
+		t.Errorf("TestExportSearch: expected an error for an invalid search\n")
+	}
+}
+
+func TestWriteMarkdownReport(t *testing.T) {
+	data := loadTestDataset(t)
+	result, _ := data.Search("ticket Subject A Problem in Oman", nil)
+
+	var out strings.Builder
+	if err := WriteMarkdownReport(&out, NewExportReport("ticket Subject A Problem in Oman", result, time.Now())); err != nil {
+		t.Fatalf("TestWriteMarkdownReport: unexpected error: %v\n", err)
+	}
+
+	markdown := out.String()
+	for _, expected := range []string{"# Search results: ticket Subject A Problem in Oman\n", "\n| ID | ", "\n| --- |", "| [" + result.Tickets[0].ID + "](<" + result.Tickets[0].URL + ">) | A Problem in Oman |"} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("TestWriteMarkdownReport: expected %q in: %s\n", expected, markdown)
+		}
+	}
+
+	if escaped := markdownEscaper.Replace("a|b_c\nd"); escaped != "a\\|b\\_c d" {
+		t.Errorf("TestWriteMarkdownReport: unexpected escaping: %q\n", escaped)
+	}
+
+	// link URLs with spaces, parentheses or pipes don't break the link or the table row
+	report := ExportReport{Tables: []ExportTable{{Title: "Tickets", Columns: []string{"ID"}, Rows: []ExportRow{{Cells: []ExportCell{{Text: "1", Link: "http://example.com/a b)|c"}}}}}}}
+	out.Reset()
+	if err := WriteMarkdownReport(&out, report); err != nil || !strings.Contains(out.String(), "| [1](<http://example.com/a b)%7Cc>) |\n") {
+		t.Errorf("TestWriteMarkdownReport: unexpected link (error %v): %s\n", err, out.String())
+	}
+}
+
+func TestWriteCSVReport(t *testing.T) {
+	data := loadTestDataset(t)
+	result, _ := data.Search("ticket Subject A Problem in Oman", nil)
+	report := NewExportReport("ticket Subject A Problem in Oman", result, time.Now())
+
+	dir, err := ioutil.TempDir("", "TestWriteCSVReport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := WriteCSVReport(filepath.Join(dir, "report.csv"), report, true)
+	if err != nil {
+		t.Fatalf("TestWriteCSVReport: unexpected error: %v\n", err)
+	}
+	if len(files) != len(report.Tables) || files[0] != filepath.Join(dir, "report-tickets.csv") {
+		t.Fatalf("TestWriteCSVReport: unexpected files: %v\n", files)
+	}
+
+	contents, _ := ioutil.ReadFile(files[0])
+	if !bytes.HasPrefix(contents, []byte(utf8ByteOrderMark)) {
+		t.Errorf("TestWriteCSVReport: expected a byte order mark\n")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(contents, []byte(utf8ByteOrderMark)))).ReadAll()
+	if err != nil || len(records) != len(result.Tickets)+1 {
+		t.Fatalf("TestWriteCSVReport: unexpected CSV (error %v): %s\n", err, contents)
+	}
+	header, row := strings.Join(records[0], ","), records[1]
+	if !strings.HasPrefix(header, "ID,URL,") || !strings.Contains(header, "Organization ID,Organization") {
+		t.Errorf("TestWriteCSVReport: unexpected header: %s\n", header)
+	}
+	if row[0] != result.Tickets[0].ID || row[1] != result.Tickets[0].URL {
+		t.Errorf("TestWriteCSVReport: unexpected row: %v\n", row)
+	}
+
+	if _, err := WriteCSVReport("-", report, false); err == nil {
+		t.Errorf("TestWriteCSVReport: expected an error writing to the standard output\n")
+	}
+
+	// a failed export leaves no files behind
+	failing := filepath.Join(dir, "failing.csv")
+	os.Mkdir(filepath.Join(dir, "failing-"+report.Tables[len(report.Tables)-1].ID+".csv"), 0755)
+	if files, err := WriteCSVReport(failing, report, false); err == nil || len(files) != 0 {
+		t.Errorf("TestWriteCSVReport: expected an error writing over a directory (files %v)\n", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "failing-"+report.Tables[0].ID+".csv")); !os.IsNotExist(err) {
+		t.Errorf("TestWriteCSVReport: partial export not removed\n")
+	}
+}
+
+func TestWriteCSVFormulaCells(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteCSVFormulaCells")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	values := []string{"=HYPERLINK(\"http://example.com\")", "+1", "-1+2", "@SUM(A1)", "\tx", "plain", "a=b"}
+	table := ExportTable{ID: "tickets", Columns: []string{"Subject"}}
+	for _, value := range values {
+		table.Rows = append(table.Rows, ExportRow{Cells: []ExportCell{{Text: value}}})
+	}
+
+	file := filepath.Join(dir, "report-tickets.csv")
+	if err := writeCSVTable(file, table, false); err != nil {
+		t.Fatalf("TestWriteCSVFormulaCells: unexpected error: %v\n", err)
+	}
+
+	contents, _ := ioutil.ReadFile(file)
+	records, err := csv.NewReader(bytes.NewReader(contents)).ReadAll()
+	if err != nil || len(records) != len(values)+1 {
+		t.Fatalf("TestWriteCSVFormulaCells: unexpected CSV (error %v): %s\n", err, contents)
+	}
+
+	expected := []string{"'=HYPERLINK(\"http://example.com\")", "'+1", "'-1+2", "'@SUM(A1)", "'\tx", "plain", "a=b"}
+	for i, want := range expected {
+		if got := records[i+1][0]; got != want {
+			t.Errorf("TestWriteCSVFormulaCells: expected %q, got %q\n", want, got)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -------------------- fuzzy (typo-tolerant) matching --------------------
+
+// prefix of a search value for a fuzzy match, e.g. `user Name ~Fransisca Rasmusen`
+const fuzzyMatchPrefix = "~"
+
+// escaped prefix of a search value starting with a literal ~, e.g. `ticket Subject \~test`
+const fuzzyMatchEscape = "\\" + fuzzyMatchPrefix
+
+// parseFuzzyValue returns the value a search value matches, and whether it is a fuzzy match: values starting with ~ are
+// matched fuzzily, and values starting with \~ are matched as they are, starting with ~
+func parseFuzzyValue(searchValue string) (string, bool) {
+	if strings.HasPrefix(searchValue, fuzzyMatchEscape) {
+		return strings.TrimPrefix(searchValue, "\\"), false
+	}
+	if strings.HasPrefix(searchValue, fuzzyMatchPrefix) {
+		return strings.TrimPrefix(searchValue, fuzzyMatchPrefix), true
+	}
+
+	return searchValue, false
+}
+
+// minimum similarity (0-1) for a fuzzy match
+const fuzzyMinSimilarity = 0.5
+
+// fields that can be fuzzy matched, by struct name
+var fuzzyFields = map[string][]string{
+	"Organization": {"Name"},
+	"User":         {"Name", "Alias"},
+	"Ticket":       {"Subject"},
+}
+
+// FuzzyMatch is a record ID matched by a fuzzy search, with its similarity to the search value
+type FuzzyMatch struct {
+	ID         string
+	Similarity float64
+}
+
+// FuzzyIndex is a trigram index over the values of one field, so that fuzzy searches only score records sharing trigrams
+// with the search value rather than every record
+type FuzzyIndex struct {
+	postings map[string]map[string]bool // trigram -> IDs of records whose value contains it
+	values   map[string]string          // record ID -> normalized value
+	order    map[string]int             // record ID -> order the record was indexed in, to rank equal matches stably
+	next     int
+}
+
+func newFuzzyIndex() *FuzzyIndex {
+	return &FuzzyIndex{postings: map[string]map[string]bool{}, values: map[string]string{}, order: map[string]int{}}
+}
+
+// normalizeFuzzyText folds case, strips accents and replaces punctuation with spaces, collapsing repeated whitespace, so that
+// indexed values and search values are compared the same way
+func normalizeFuzzyText(text string) string {
+	return strings.Join(strings.FieldsFunc(looseMatchOptions.Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// trigrams returns the distinct trigrams of each word of a normalized text, with the words padded ("$word$") so that short
+// words and word boundaries are represented
+func trigrams(text string) map[string]bool {
+	grams := map[string]bool{}
+	for _, word := range strings.Fields(text) {
+		runes := []rune("$" + word + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams[string(runes[i:i+3])] = true
+		}
+	}
+
+	return grams
+}
+
+// similarity returns the Dice coefficient of two trigram sets (1 for identical sets, 0 for no trigrams in common)
+func similarity(a, b map[string]bool) float64 {
+	if len(a) <= 0 || len(b) <= 0 {
+		return 0
+	}
+
+	shared := 0
+	for gram := range a {
+		if b[gram] {
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// fuzzySimilarity scores how closely a value matches a search value: the best similarity of the whole value, or any run of
+// words in it as long as the search value (so that "Fransisca" matches "Francisca Rasmussen" well)
+func fuzzySimilarity(value, search string) float64 {
+	searchGrams := trigrams(search)
+	best := similarity(trigrams(value), searchGrams)
+
+	words := strings.Fields(value)
+	searchWords := len(strings.Fields(search))
+	for i := 0; searchWords > 0 && i+searchWords <= len(words); i++ {
+		if score := similarity(trigrams(strings.Join(words[i:i+searchWords], " ")), searchGrams); score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+// Add indexes a record's value, replacing any value indexed for it before
+func (index *FuzzyIndex) Add(id, value string) {
+	index.Remove(id)
+
+	value = normalizeFuzzyText(value)
+	if value == "" {
+		return
+	}
+
+	index.values[id] = value
+	index.order[id] = index.next
+	index.next++
+
+	for gram := range trigrams(value) {
+		if index.postings[gram] == nil {
+			index.postings[gram] = map[string]bool{}
+		}
+		index.postings[gram][id] = true
+	}
+}
+
+// Remove removes a record from the index
+func (index *FuzzyIndex) Remove(id string) {
+	value, indexed := index.values[id]
+	if !indexed {
+		return
+	}
+
+	for gram := range trigrams(value) {
+		delete(index.postings[gram], id)
+		if len(index.postings[gram]) <= 0 {
+			delete(index.postings, gram)
+		}
+	}
+	delete(index.values, id)
+	delete(index.order, id)
+}
+
+// Candidates returns the IDs of the records that can match a search value with at least fuzzyMinSimilarity. Records sharing
+// no trigram with the search value can't match it, and nor can records sharing too few: a value (or run of words in it)
+// sharing n of the search value's q trigrams has a similarity of at most 2n/(q+n), as it has at least n trigrams of its own.
+func (index *FuzzyIndex) Candidates(search string) map[string]bool {
+	searchGrams := trigrams(normalizeFuzzyText(search))
+
+	shared := map[string]int{}
+	for gram := range searchGrams {
+		for id := range index.postings[gram] {
+			shared[id]++
+		}
+	}
+
+	candidates := map[string]bool{}
+	for id, count := range shared {
+		if 2*float64(count)/float64(len(searchGrams)+count) >= fuzzyMinSimilarity {
+			candidates[id] = true
+		}
+	}
+
+	return candidates
+}
+
+// Search returns the records whose value matches a search value with at least fuzzyMinSimilarity, most similar first
+func (index *FuzzyIndex) Search(search string) []FuzzyMatch {
+	candidates := index.Candidates(search)
+	search = normalizeFuzzyText(search)
+
+	matches := []FuzzyMatch{}
+	for id := range candidates {
+		if score := fuzzySimilarity(index.values[id], search); score >= fuzzyMinSimilarity {
+			matches = append(matches, FuzzyMatch{ID: id, Similarity: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return index.order[matches[i].ID] < index.order[matches[j].ID]
+	})
+
+	return matches
+}
+
+// buildFuzzyIndexes indexes the fuzzy-matchable fields of all records, keyed by <struct name>.<field name>
+func buildFuzzyIndexes(OrgList []Organization, UserList []User, TicketList []Ticket) map[string]*FuzzyIndex {
+	indexes := map[string]*FuzzyIndex{}
+	for structName, fields := range fuzzyFields {
+		for _, field := range fields {
+			indexes[structName+"."+field] = newFuzzyIndex()
+		}
+	}
+
+	for _, org := range OrgList {
+		updateFuzzyIndexes(indexes, org)
+	}
+	for _, user := range UserList {
+		updateFuzzyIndexes(indexes, user)
+	}
+	for _, ticket := range TicketList {
+		updateFuzzyIndexes(indexes, ticket)
+	}
+
+	return indexes
+}
+
+// updateFuzzyIndexes (re)indexes the fuzzy-matchable fields of a record
+func updateFuzzyIndexes(indexes map[string]*FuzzyIndex, record interface{}) {
+	structName := recordStructName(record)
+	_, id := recordType(record)
+
+	for _, field := range fuzzyFields[structName] {
+		indexes[structName+"."+field].Add(id, reflect.ValueOf(record).FieldByName(field).String())
+	}
+}
+
+// removeFromFuzzyIndexes removes a record from the fuzzy indexes of a record type
+func removeFromFuzzyIndexes(indexes map[string]*FuzzyIndex, structName, id string) {
+	for _, field := range fuzzyFields[structName] {
+		indexes[structName+"."+field].Remove(id)
+	}
+}
+
+// FuzzySearch returns the IDs of orgs, users or tickets whose field value is similar to a search value, most similar first
+func (data *Dataset) FuzzySearch(searchType, searchField, searchValue string) ([]FuzzyMatch, error) {
+	structName := map[string]string{"org": "Organization", "user": "User", "ticket": "Ticket"}[strings.ToLower(searchType)]
+	if structName == "" {
+		return nil, fmt.Errorf("Invalid search type: %s (must be one of %s)", searchType, strings.Join(entityTypes, ", "))
+	}
+
+	index, found := data.fuzzyIndexes[structName+"."+searchField]
+	if !found {
+		return nil, fmt.Errorf("Fuzzy matching (%s) is only supported on fields: %s", fuzzyMatchPrefix, strings.Join(fuzzyFieldNames(structName), ", "))
+	}
+
+	return index.Search(searchValue), nil
+}
+
+func fuzzyFieldNames(structName string) []string {
+	names := []string{}
+	for _, field := range fuzzyFields[structName] {
+		names = append(names, structName+"."+field)
+	}
+
+	return names
+}
+
+// FuzzySearchOrgs returns the orgs whose field value is similar to a search value, most similar first
+func (data *Dataset) FuzzySearchOrgs(searchField, searchValue string) ([]Organization, error) {
+	matches, err := data.FuzzySearch("org", searchField, searchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := []Organization{}
+	for _, match := range matches {
+		id, _ := strconv.Atoi(match.ID)
+		if org, found := data.GetOrg(id); found {
+			orgs = append(orgs, org)
+		}
+	}
+
+	return orgs, nil
+}
+
+// FuzzySearchUsers returns the users whose field value is similar to a search value, most similar first
+func (data *Dataset) FuzzySearchUsers(searchField, searchValue string) ([]User, error) {
+	matches, err := data.FuzzySearch("user", searchField, searchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	for _, match := range matches {
+		id, _ := strconv.Atoi(match.ID)
+		if user, found := data.GetUser(id); found {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// FuzzySearchTickets returns the tickets whose field value is similar to a search value, most similar first
+func (data *Dataset) FuzzySearchTickets(searchField, searchValue string) ([]Ticket, error) {
+	matches, err := data.FuzzySearch("ticket", searchField, searchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := []Ticket{}
+	for _, match := range matches {
+		if ticket, found := data.GetTicket(match.ID); found {
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	return tickets, nil
+}
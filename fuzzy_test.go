@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFuzzySearch(t *testing.T) {
+	data := loadTestDataset(t)
+
+	users, err := data.FindUsers("Name", "~Fransisca Rasmusen", MatchOptions{})
+	if err != nil || len(users) <= 0 || users[0].ID != 1 {
+		t.Fatalf("TestFuzzySearch: misspelt user name not matched (%d results, error %v)\n", len(users), err)
+	}
+
+	// a single misspelt word should match names containing a similar word
+	users, _ = data.FindUsers("Name", "~rasmusen", MatchOptions{})
+	if len(users) <= 0 || users[0].ID != 1 {
+		t.Error("TestFuzzySearch: misspelt surname not matched.\n")
+	}
+
+	orgs, _ := data.FindOrgs("Name", "~Entaze", MatchOptions{})
+	if len(orgs) <= 0 || orgs[0].ID != 101 {
+		t.Error("TestFuzzySearch: misspelt org name not matched.\n")
+	}
+
+	// results should be ranked by similarity, with the exact match first
+	tickets, _ := data.FindTickets("Subject", "~A Catastrophe in Hungary", MatchOptions{})
+	if len(tickets) < 2 || tickets[0].Subject != "A Catastrophe in Hungary" {
+		t.Errorf("TestFuzzySearch: expected exact subject first, got %d results\n", len(tickets))
+	}
+	for i := 1; i < len(tickets); i++ {
+		previous := fuzzySimilarity(normalizeFuzzyText(tickets[i-1].Subject), normalizeFuzzyText("A Catastrophe in Hungary"))
+		if fuzzySimilarity(normalizeFuzzyText(tickets[i].Subject), normalizeFuzzyText("A Catastrophe in Hungary")) > previous {
+			t.Error("TestFuzzySearch: results not ranked by similarity.\n")
+			break
+		}
+	}
+
+	if users, _ := data.FindUsers("Name", "~Zzyzx Qwerty", MatchOptions{}); len(users) != 0 {
+		t.Errorf("TestFuzzySearch: dissimilar name matched %d users\n", len(users))
+	}
+
+	if _, err := data.FindUsers("Email", "~coffeyrasmussen", MatchOptions{}); err == nil {
+		t.Error("TestFuzzySearch: fuzzy search of unsupported field not rejected.\n")
+	}
+
+	// \~ searches for values starting with a literal ~, on any field
+	ticket := data.TicketList[0]
+	ticket.Subject, ticket.Type = "~Tilde subject", "~task"
+	data.UpsertTicket(ticket)
+	if tickets, err := data.FindTickets("Subject", `\~Tilde subject`, MatchOptions{}); err != nil || len(tickets) != 1 || tickets[0].ID != ticket.ID {
+		t.Errorf("TestFuzzySearch: escaped ~ not matched literally (error %v)\n", err)
+	}
+	if tickets, err := data.FindTickets("Type", `\~task`, MatchOptions{}); err != nil || len(tickets) != 1 {
+		t.Errorf("TestFuzzySearch: escaped ~ not matched on a field without fuzzy matching (error %v)\n", err)
+	}
+}
+
+func TestFuzzyIndexUpdates(t *testing.T) {
+	data := loadTestDataset(t)
+
+	user, _ := data.GetUser(1)
+	user.Name = "Wilhelmina Oyelaran"
+	data.UpsertUser(user)
+
+	if users, _ := data.FindUsers("Name", "~Francisca Rasmussen", MatchOptions{}); len(users) > 0 && users[0].ID == 1 {
+		t.Error("TestFuzzyIndexUpdates: old name still indexed.\n")
+	}
+	if users, _ := data.FindUsers("Name", "~Wilhemina Oyelaran", MatchOptions{}); len(users) != 1 || users[0].ID != 1 {
+		t.Error("TestFuzzyIndexUpdates: new name not indexed.\n")
+	}
+
+	data.DeleteUsers(1)
+	if users, _ := data.FindUsers("Name", "~Wilhemina Oyelaran", MatchOptions{}); len(users) != 0 {
+		t.Error("TestFuzzyIndexUpdates: deleted user still indexed.\n")
+	}
+
+	// the index should only score records sharing trigrams with the search value
+	index := data.fuzzyIndexes["User.Name"]
+	if len(index.postings["$zz"]) != 0 || len(index.values) != len(data.UserList) {
+		t.Errorf("TestFuzzyIndexUpdates: index holds %d values for %d users\n", len(index.values), len(data.UserList))
+	}
+}
+
+func TestFuzzyCandidates(t *testing.T) {
+	data := loadTestDataset(t)
+	index := data.fuzzyIndexes["User.Name"]
+
+	for _, search := range []string{"Fransisca Rasmusen", "rasmusen", "Cross Barlow"} {
+		// records sharing only a few common trigrams with the search value shouldn't be scored
+		sharing := map[string]bool{}
+		for gram := range trigrams(normalizeFuzzyText(search)) {
+			for id := range index.postings[gram] {
+				sharing[id] = true
+			}
+		}
+
+		candidates := index.Candidates(search)
+		if len(sharing) > 1 && len(candidates) >= len(sharing) {
+			t.Errorf("TestFuzzyCandidates: all %d records sharing a trigram with %q are candidates\n", len(sharing), search)
+		}
+
+		// but every record that matches should be a candidate
+		for id, value := range index.values {
+			if fuzzySimilarity(value, normalizeFuzzyText(search)) >= fuzzyMinSimilarity && !candidates[id] {
+				t.Errorf("TestFuzzyCandidates: user %s matches %q but isn't a candidate\n", id, search)
+			}
+		}
+	}
+}
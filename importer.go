@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------------------- importer for Zendesk API (incremental export) paginated responses --------------------
+
+// entity types that can be imported, named as in the Zendesk API (and the keys records are wrapped in on each page)
+var apiExportEntities = []string{"organizations", "users", "tickets"}
+
+// upper bound on the number of pages followed for one entity type, guarding against cursors that never end
+const maxAPIExportPages = 10000
+
+// rate limited requests (429 Too Many Requests) are retried up to maxAPIRetries times, after the wait given by the response's
+// Retry-After header (or defaultAPIRetryWait if it has none). Waits longer than maxAPIRetryWait fail the export instead.
+const (
+	maxAPIRetries       = 3
+	defaultAPIRetryWait = 10 * time.Second
+	maxAPIRetryWait     = 5 * time.Minute
+)
+
+// apiExportPage is a single page of an incremental export API response
+type apiExportPage struct {
+	Organizations []json.RawMessage `json:"organizations"`
+	Users         []json.RawMessage `json:"users"`
+	Tickets       []json.RawMessage `json:"tickets"`
+	NextPage      string            `json:"next_page"`
+	AfterURL      string            `json:"after_url"` // cursor-based exports use after_url instead of next_page
+	EndOfStream   bool              `json:"end_of_stream"`
+}
+
+// fields of API records renamed to the data file field names, for each entity type
+var apiFieldNames = map[string]map[string]string{
+	"organizations": {"id": "_id"},
+	"users":         {"id": "_id", "time_zone": "timezone"},
+	"tickets":       {"id": "_id"},
+}
+
+// characters replaced when naming the file a page is saved as after its URL
+var apiPageFileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// records returns the records on this page for an entity type
+func (page apiExportPage) records(entity string) []json.RawMessage {
+	switch entity {
+	case "organizations":
+		return page.Organizations
+	case "users":
+		return page.Users
+	case "tickets":
+		return page.Tickets
+	}
+
+	return nil
+}
+
+// nextURL returns the cursor to the next page, or an empty string if this is the last page
+func (page apiExportPage) nextURL() string {
+	if page.EndOfStream {
+		return ""
+	}
+
+	if page.NextPage != "" {
+		return page.NextPage
+	}
+
+	return page.AfterURL
+}
+
+// APIExport collects the raw records of each entity type across all imported pages. Incremental exports can return the same
+// record more than once as it changes, so only the latest version of each record (by _id) is kept.
+type APIExport struct {
+	records map[string][]json.RawMessage // entity type -> records, in first-seen order
+	ids     map[string]map[string]int    // entity type -> record _id -> position in records
+}
+
+func newAPIExport() *APIExport {
+	return &APIExport{records: map[string][]json.RawMessage{}, ids: map[string]map[string]int{}}
+}
+
+// mapAPIRecord converts a record as the API returns it to the format of the data files: fields are renamed (e.g. id to
+// _id), ticket IDs (integers in the API) become strings, and a ticket's via object is replaced by its channel. Records
+// already in the data file format are returned unchanged.
+func mapAPIRecord(entity string, record json.RawMessage) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, err
+	}
+
+	mapped := false
+	for apiName, name := range apiFieldNames[entity] {
+		if value, found := fields[apiName]; found {
+			if _, exists := fields[name]; !exists {
+				fields[name] = value
+				delete(fields, apiName)
+				mapped = true
+			}
+		}
+	}
+
+	if entity == "tickets" {
+		var id json.Number
+		if err := json.Unmarshal(fields["_id"], &id); err == nil && id != "" {
+			fields["_id"], _ = json.Marshal(id.String())
+			mapped = true
+		}
+
+		var via struct {
+			Channel string `json:"channel"`
+		}
+		if value := bytes.TrimSpace(fields["via"]); len(value) > 0 && value[0] == '{' {
+			if err := json.Unmarshal(value, &via); err != nil {
+				return nil, err
+			}
+			fields["via"], _ = json.Marshal(via.Channel)
+			mapped = true
+		}
+	}
+
+	if !mapped {
+		return record, nil
+	}
+	return json.Marshal(fields)
+}
+
+// add stores the records of an entity type from one page, replacing earlier versions of the same records
+func (export *APIExport) add(entity string, records []json.RawMessage) error {
+	if export.ids[entity] == nil {
+		export.ids[entity] = map[string]int{}
+	}
+
+	for _, record := range records {
+		record, err := mapAPIRecord(entity, record)
+		if err != nil {
+			return err
+		}
+
+		var recordID struct {
+			ID interface{} `json:"_id"`
+		}
+		err = json.Unmarshal(record, &recordID)
+		if err != nil {
+			return err
+		}
+
+		// records without an _id can't be deduplicated, and are kept as-is
+		if recordID.ID == nil {
+			export.records[entity] = append(export.records[entity], record)
+			continue
+		}
+
+		key := fmt.Sprintf("%v", recordID.ID)
+		if pos, seen := export.ids[entity][key]; seen {
+			export.records[entity][pos] = record
+			continue
+		}
+
+		export.ids[entity][key] = len(export.records[entity])
+		export.records[entity] = append(export.records[entity], record)
+	}
+
+	return nil
+}
+
+// JSON returns the records of an entity type as a flat JSON array, in the same format as the data files
+func (export *APIExport) JSON(entity string) []byte {
+	var data bytes.Buffer
+	data.WriteString("[")
+	for i, record := range export.records[entity] {
+		if i > 0 {
+			data.WriteString(",")
+		}
+		data.Write(record)
+	}
+	data.WriteString("]")
+
+	return data.Bytes()
+}
+
+// ImportAPIPageDirectory reads a directory of saved API response pages, following the pages of each entity type as they
+// were fetched. The first page of an entity type is saved as <entity>.json (e.g. tickets.json), and each following page
+// under the name apiPageFileName gives its URL (the previous page's next_page or after_url), until the end of the stream.
+func ImportAPIPageDirectory(dirName string) (*APIExport, error) {
+	export := newAPIExport()
+	found := false
+
+	for _, entity := range apiExportEntities {
+		fileName := filepath.Join(dirName, entity+".json")
+		if _, err := os.Stat(fileName); os.IsNotExist(err) {
+			continue
+		}
+		found = true
+
+		visited := map[string]bool{}
+		for fileName != "" {
+			if visited[fileName] || len(visited) >= maxAPIExportPages {
+				return nil, fmt.Errorf("Export of %s did not end after %d page(s) (last page: %s)", entity, len(visited), fileName)
+			}
+			visited[fileName] = true
+
+			pageData, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				return nil, err
+			}
+
+			page := apiExportPage{}
+			err = json.Unmarshal(pageData, &page)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid API response page %s: %v", fileName, err)
+			}
+
+			err = export.add(entity, page.records(entity))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid record in API response page %s: %v", fileName, err)
+			}
+
+			pageFileName := fileName
+			fileName = ""
+			if nextURL := page.nextURL(); nextURL != "" {
+				nextFileName, err := apiPageFileName(nextURL)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid next page URL in %s: %v", pageFileName, err)
+				}
+				fileName = filepath.Join(dirName, nextFileName)
+				if _, err := os.Stat(fileName); err != nil {
+					return nil, fmt.Errorf("Page %s of the %s export not saved as %s", nextURL, entity, fileName)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("No API response pages found in %s (the first page of each export is saved as organizations.json, users.json or tickets.json)", dirName)
+	}
+
+	return export, nil
+}
+
+// apiPageFileName returns the name a page is saved under in a page directory, from its URL: its path after
+// /incremental/ and its query, with characters other than letters, digits, . and - replaced by _ (e.g.
+// .../api/v2/incremental/tickets.json?start_time=1467000000 is saved as tickets.json_start_time_1467000000.json)
+func apiPageFileName(pageURL string) (string, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := parsed.Path
+	if i := strings.Index(name, "/incremental/"); i >= 0 {
+		name = name[i+len("/incremental/"):]
+	}
+	if parsed.RawQuery != "" {
+		name += "?" + parsed.RawQuery
+	}
+
+	return apiPageFileNameUnsafe.ReplaceAllString(strings.Trim(name, "/"), "_") + ".json", nil
+}
+
+// FetchAPIExport downloads all entity types from a Zendesk instance (or a compatible server) via the incremental export API,
+// following next_page cursors until the end of each stream. If apiToken isn't empty, it is sent as a bearer token.
+func FetchAPIExport(client *http.Client, baseURL, apiToken string) (*APIExport, error) {
+	export := newAPIExport()
+
+	for _, entity := range apiExportEntities {
+		pageURL := fmt.Sprintf("%s/api/v2/incremental/%s.json?start_time=0", strings.TrimRight(baseURL, "/"), entity)
+		visited := map[string]bool{}
+
+		for pageURL != "" {
+			if visited[pageURL] || len(visited) >= maxAPIExportPages {
+				return nil, fmt.Errorf("Export of %s did not end after %d page(s) (last page: %s)", entity, len(visited), pageURL)
+			}
+			visited[pageURL] = true
+
+			page, err := fetchAPIExportPage(client, pageURL, apiToken)
+			if err != nil {
+				return nil, err
+			}
+
+			err = export.add(entity, page.records(entity))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid record in API response %s: %v", pageURL, err)
+			}
+
+			pageURL = page.nextURL()
+		}
+	}
+
+	return export, nil
+}
+
+// fetchAPIExportPage requests and decodes a single page of an export
+func fetchAPIExportPage(client *http.Client, pageURL, apiToken string) (apiExportPage, error) {
+	page := apiExportPage{}
+
+	request, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return page, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+	if apiToken != "" {
+		request.Header.Set("Authorization", "Bearer "+apiToken)
+	}
+
+	for retries := 0; ; retries++ {
+		response, err := client.Do(request)
+		if err != nil {
+			return page, err
+		}
+
+		if response.StatusCode == http.StatusTooManyRequests && retries < maxAPIRetries {
+			response.Body.Close()
+
+			wait := apiRetryWait(response.Header.Get("Retry-After"))
+			if wait > maxAPIRetryWait {
+				return page, fmt.Errorf("API request %s failed: %s (retry after %v)", pageURL, response.Status, wait)
+			}
+			time.Sleep(wait)
+			continue
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return page, fmt.Errorf("API request %s failed: %s", pageURL, response.Status)
+		}
+
+		err = json.NewDecoder(response.Body).Decode(&page)
+		if err != nil {
+			return page, fmt.Errorf("Invalid API response %s: %v", pageURL, err)
+		}
+
+		return page, nil
+	}
+}
+
+// apiRetryWait returns how long to wait before retrying a rate limited request, from its Retry-After header: a number of
+// seconds or an HTTP date
+func apiRetryWait(retryAfter string) time.Duration {
+	retryAfter = strings.TrimSpace(retryAfter)
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	return defaultAPIRetryWait
+}
+
+// importAPIExport imports data from the API page directory or base URL set in the app config
+func importAPIExport(config AppConfig) (*APIExport, error) {
+	if config.ImportDirectory != "" {
+		return ImportAPIPageDirectory(config.ImportDirectory)
+	}
+
+	if config.ImportBaseURL != "" {
+		return FetchAPIExport(&http.Client{Timeout: 60 * time.Second}, config.ImportBaseURL, config.ImportAPIToken)
+	}
+
+	return nil, errors.New("No API import source (ImportDirectory or ImportBaseURL) configured")
+}
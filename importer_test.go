@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportAPIPageDirectory(t *testing.T) {
+	export, err := ImportAPIPageDirectory("testdata/api_pages")
+	if err != nil {
+		t.Fatalf("TestImportAPIPageDirectory: error importing pages - %v\n", err)
+	}
+
+	orgs, _, err := ParseOrganizationData("organizations", export.JSON("organizations"), nil)
+	if err != nil || len(orgs) != 1 || orgs[0].ID != 101 || orgs[0].Name != "Enthaze" || !orgs[0].Custom.Matches("organization_fields.region", "apac") {
+		t.Errorf("TestImportAPIPageDirectory: orgs not imported correctly: %v (error %v)\n", orgs, err)
+	}
+
+	// users are on two pages of a cursor-based export, linked by after_url
+	users, _, err := ParseUserData("users", export.JSON("users"), nil)
+	if err != nil || len(users) != 2 || users[0].ID != 1 || users[1].ID != 2 || users[0].Timezone != "Sri Lanka" || users[1].Org != 101 {
+		t.Errorf("TestImportAPIPageDirectory: users not imported correctly: %v (error %v)\n", users, err)
+	}
+
+	// tickets are on two pages of a time-based export, linked by next_page. Ticket 436 appears on both pages, and only its
+	// latest version should be kept.
+	tickets, _, err := ParseTicketData("tickets", export.JSON("tickets"), nil)
+	if err != nil || len(tickets) != 3 {
+		t.Fatalf("TestImportAPIPageDirectory: tickets not imported correctly: %v (error %v)\n", tickets, err)
+	}
+
+	if tickets[0].ID != "436" || tickets[0].Status != "solved" || tickets[0].Via != "web" || tickets[0].Submitter != 1 || tickets[0].Assignee != 2 || tickets[0].Org != 101 {
+		t.Errorf("TestImportAPIPageDirectory: incorrect ticket data imported: %+v\n", tickets[0])
+	}
+	if tickets[1].ID != "437" || tickets[1].Via != "email" || tickets[1].Assignee != 0 || tickets[2].ID != "438" || !tickets[2].Custom.Matches("satisfaction_rating.score", "offered") {
+		t.Errorf("TestImportAPIPageDirectory: incorrect ticket data imported: %v\n", tickets)
+	}
+}
+
+func TestImportAPIPageDirectoryMissingPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestImportAPIPageDirectoryMissingPage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := ImportAPIPageDirectory(dir); err == nil {
+		t.Errorf("TestImportAPIPageDirectoryMissingPage: expected an error for a directory with no pages\n")
+	}
+
+	// the first page of tickets links to a page that wasn't saved
+	page, _ := ioutil.ReadFile("testdata/api_pages/tickets.json")
+	ioutil.WriteFile(filepath.Join(dir, "tickets.json"), page, 0644)
+	if _, err := ImportAPIPageDirectory(dir); err == nil || !strings.Contains(err.Error(), "tickets.json_start_time_1465572127.json") {
+		t.Errorf("TestImportAPIPageDirectoryMissingPage: expected an error naming the missing page, got %v\n", err)
+	}
+}
+
+func TestAPIPageFileName(t *testing.T) {
+	tests := map[string]string{
+		"https://initech.zendesk.com/api/v2/incremental/tickets.json?start_time=1465572127":                    "tickets.json_start_time_1465572127.json",
+		"https://initech.zendesk.com/api/v2/incremental/users/cursor.json?cursor=MTQ2NDc2NzczMS4wfHwxfA%3D%3D": "users_cursor.json_cursor_MTQ2NDc2NzczMS4wfHwxfA_3D_3D.json",
+	}
+
+	for pageURL, expected := range tests {
+		if name, err := apiPageFileName(pageURL); err != nil || name != expected {
+			t.Errorf("TestAPIPageFileName: %s: expected %s, got %s (error %v)\n", pageURL, expected, name, err)
+		}
+	}
+}
+
+func TestMapAPIRecord(t *testing.T) {
+	mapped, err := mapAPIRecord("tickets", json.RawMessage(`{"id": 35436, "via": {"channel": "mobile", "source": {}}, "submitter_id": 1}`))
+	if err != nil || string(mapped) != `{"_id":"35436","submitter_id":1,"via":"mobile"}` {
+		t.Errorf("TestMapAPIRecord: unexpected ticket mapping: %s (error %v)\n", mapped, err)
+	}
+
+	mapped, err = mapAPIRecord("users", json.RawMessage(`{"id": 5, "time_zone": "Armenia"}`))
+	if err != nil || string(mapped) != `{"_id":5,"timezone":"Armenia"}` {
+		t.Errorf("TestMapAPIRecord: unexpected user mapping: %s (error %v)\n", mapped, err)
+	}
+
+	// records in the data file format are unchanged
+	record := json.RawMessage(`{"_id": "t-1", "via": "web"}`)
+	if mapped, err := mapAPIRecord("tickets", record); err != nil || string(mapped) != string(record) {
+		t.Errorf("TestMapAPIRecord: data file record changed: %s (error %v)\n", mapped, err)
+	}
+}
+
+func TestFetchAPIExport(t *testing.T) {
+	// stub server serving two pages of tickets and a single page each of orgs and users
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		page := map[string]interface{}{"end_of_stream": true}
+		switch r.URL.Path {
+		case "/api/v2/incremental/organizations.json":
+			page["organizations"] = []map[string]interface{}{{"id": 101, "name": "Enthaze"}}
+		case "/api/v2/incremental/users.json":
+			page["users"] = []map[string]interface{}{{"id": 1, "name": "Francisca Rasmussen", "organization_id": 101}}
+		case "/api/v2/incremental/tickets.json":
+			page["tickets"] = []map[string]interface{}{{"id": 1, "status": "open", "via": map[string]interface{}{"channel": "web"}}}
+			page["after_url"] = fmt.Sprintf("%s/api/v2/incremental/tickets/cursor.json?cursor=abc", server.URL)
+			page["end_of_stream"] = false
+		case "/api/v2/incremental/tickets/cursor.json":
+			page["tickets"] = []map[string]interface{}{{"id": 2, "status": "open"}, {"id": 1, "status": "closed", "via": map[string]interface{}{"channel": "api"}}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	export, err := FetchAPIExport(server.Client(), server.URL, "secret")
+	if err != nil {
+		t.Fatalf("TestFetchAPIExport: error fetching export - %v\n", err)
+	}
+
+	if requests != 4 {
+		t.Errorf("TestFetchAPIExport: expected 4 page requests, got %d\n", requests)
+	}
+
+	tickets, _, err := ParseTicketData("tickets", export.JSON("tickets"), nil)
+	if err != nil || len(tickets) != 2 || tickets[0].ID != "1" || tickets[0].Status != "closed" || tickets[0].Via != "api" {
+		t.Errorf("TestFetchAPIExport: tickets not imported correctly: %v (error %v)\n", tickets, err)
+	}
+
+	_, err = FetchAPIExport(server.Client(), server.URL, "wrong")
+	if err == nil {
+		t.Error("TestFetchAPIExport: failed request not reported as an error.\n")
+	}
+}
+
+func TestFetchAPIExportRetriesRateLimited(t *testing.T) {
+	// stub server rate limiting the first request, then serving a single page of each entity type
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		page := map[string]interface{}{"end_of_stream": true}
+		if r.URL.Path == "/api/v2/incremental/organizations.json" {
+			page["organizations"] = []map[string]interface{}{{"id": 101, "name": "Enthaze"}}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	export, err := FetchAPIExport(server.Client(), server.URL, "")
+	if err != nil {
+		t.Fatalf("TestFetchAPIExportRetriesRateLimited: error fetching export - %v\n", err)
+	}
+
+	if requests != 4 {
+		t.Errorf("TestFetchAPIExportRetriesRateLimited: expected 4 requests (one retried), got %d\n", requests)
+	}
+
+	orgs, _, err := ParseOrganizationData("organizations", export.JSON("organizations"), nil)
+	if err != nil || len(orgs) != 1 || orgs[0].ID != 101 {
+		t.Errorf("TestFetchAPIExportRetriesRateLimited: orgs not imported correctly: %v (error %v)\n", orgs, err)
+	}
+
+	// a server that keeps rate limiting fails the export once the retries run out
+	requests = 0
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	_, err = FetchAPIExport(limited.Client(), limited.URL, "")
+	if err == nil || requests != maxAPIRetries+1 {
+		t.Errorf("TestFetchAPIExportRetriesRateLimited: expected an error after %d requests, got %d (error %v)\n", maxAPIRetries+1, requests, err)
+	}
+
+	if wait := apiRetryWait("120"); wait != 2*time.Minute {
+		t.Errorf("TestFetchAPIExportRetriesRateLimited: Retry-After 120 gave a wait of %v\n", wait)
+	}
+	if wait := apiRetryWait(""); wait != defaultAPIRetryWait {
+		t.Errorf("TestFetchAPIExportRetriesRateLimited: missing Retry-After gave a wait of %v\n", wait)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -------------------- change journal (undo, history and crash recovery) --------------------
+
+// kinds of journal entry
+const (
+	journalChange = "change" // records were changed by a command, delta file etc.
+	journalUndo   = "undo"   // an earlier change was reverted
+	journalSaved  = "saved"  // all changes journaled so far have been saved to the data store
+)
+
+// number of journal entries listed by the history command
+const journalHistoryLength = 20
+
+const (
+	// number of the most recent change and undo entries that can be undone
+	journalUndoHorizon = 100
+	// compact once more saved entries than this are past the undo horizon, and more than are kept
+	journalCompactionThreshold = 100
+)
+
+// JournalEntry is a single line of the change journal. Change and undo entries hold the before/after version of every record
+// changed, so that they can be reverted (undo) or re-applied (crash recovery).
+type JournalEntry struct {
+	Seq         int            `json:"seq"`
+	Time        time.Time      `json:"time"`
+	Kind        string         `json:"kind"`
+	Description string         `json:"description,omitempty"`
+	Undoes      int            `json:"undoes,omitempty"` // seq of the change reverted by an undo entry
+	Saves       []int          `json:"saves,omitempty"`  // seqs of the changes saved by a saved entry (all earlier changes if empty)
+	Changes     []RecordChange `json:"changes,omitempty"`
+}
+
+// RecordChange holds a record (in the data file format) before and after a change, keyed as in the key/value store
+// ("org/101", "user/1", "ticket/<id>"). Before is null for an added record, and After is null for a deleted record.
+type RecordChange struct {
+	Key    string          `json:"key"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Journal is an append-only file of changes made to the data. Each change is journaled (and synced to disk) before it is
+// saved to the data store, and a "saved" entry is added once it has been. Changes journaled after the last "saved" entry
+// were interrupted (e.g. by a crash) and are re-applied on startup. Saved entries past the undo horizon stay in the file
+// until it is compacted, which rewrites it without them.
+type Journal struct {
+	path    string
+	file    *os.File
+	entries []JournalEntry
+}
+
+// OpenJournal opens (or creates) a journal file, reading its entries. A partially written last entry (from a crash while
+// journaling) is discarded.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{path: path, file: file}
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) <= 0 {
+			break
+		}
+
+		if err == io.EOF {
+			// last line was not completely written - drop it
+			log.Printf("Discarding incomplete last entry of journal %s", path)
+			err = file.Truncate(offset)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		entry := JournalEntry{}
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Invalid journal entry in %s at offset %d: %v", path, offset, err)
+		}
+
+		journal.entries = append(journal.entries, entry)
+		offset += int64(len(line))
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// append writes an entry to the end of the journal, syncing it to disk
+func (journal *Journal) append(entry JournalEntry) (JournalEntry, error) {
+	entry.Seq = 1
+	if len(journal.entries) > 0 {
+		entry.Seq = journal.entries[len(journal.entries)-1].Seq + 1
+	}
+	entry.Time = time.Now()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+
+	_, err = journal.file.Write(append(line, '\n'))
+	if err == nil {
+		err = journal.file.Sync()
+	}
+	if err != nil {
+		return entry, fmt.Errorf("Cannot write to journal: %v", err)
+	}
+
+	journal.entries = append(journal.entries, entry)
+	return entry, nil
+}
+
+// Record journals a set of changes made to the dataset, with the current version of each changed record
+func (journal *Journal) Record(data *Dataset, kind, description string, undoes int, changes ChangeSet) (JournalEntry, error) {
+	keys := []string{}
+	for key := range changes.Originals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entry := JournalEntry{Kind: kind, Description: description, Undoes: undoes}
+	for _, key := range keys {
+		entityType, id := splitRecordKey(key)
+
+		var current interface{}
+		if record, err := data.GetRecord(entityType, id); err == nil {
+			current = record
+		}
+
+		before, err := json.Marshal(changes.Originals[key])
+		if err != nil {
+			return entry, err
+		}
+
+		after, err := json.Marshal(current)
+		if err != nil {
+			return entry, err
+		}
+
+		entry.Changes = append(entry.Changes, RecordChange{Key: key, Before: before, After: after})
+	}
+
+	return journal.append(entry)
+}
+
+// MarkSaved journals that the changes with the given seqs have been saved to the data store (or all changes so far, if no
+// seqs are given), compacting the journal if needed
+func (journal *Journal) MarkSaved(seqs ...int) error {
+	_, err := journal.append(JournalEntry{Kind: journalSaved, Saves: seqs})
+	if err != nil {
+		return err
+	}
+
+	if horizon := journal.horizon(); horizon > journalCompactionThreshold && horizon > len(journal.entries)-horizon {
+		return journal.compact(horizon)
+	}
+
+	return nil
+}
+
+// horizon returns the index of the oldest entry that has to be kept in the journal: the oldest change or undo that can still
+// be undone, or the oldest unsaved change if that is older. Every entry before it has been saved and can't be undone.
+func (journal *Journal) horizon() int {
+	unsaved := map[int]bool{}
+	for _, entry := range journal.Unsaved() {
+		unsaved[entry.Seq] = true
+	}
+
+	horizon, changes := len(journal.entries), 0
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+		if unsaved[entry.Seq] {
+			horizon = i
+		} else if entry.Kind != journalSaved && changes < journalUndoHorizon {
+			horizon = i
+			changes++
+		}
+	}
+
+	return horizon
+}
+
+// compact rewrites the journal with only its entries from the given index on, replacing the old file once the new one is
+// completely written. The saved entries and undos after the index refer only to changes from the index on, so which changes
+// are unsaved or undone is unaffected.
+func (journal *Journal) compact(from int) error {
+	var buffer bytes.Buffer
+	for _, entry := range journal.entries[from:] {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buffer.Write(append(line, '\n'))
+	}
+
+	tempPath := journal.path + ".compact"
+	os.Remove(tempPath)
+	compacted, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = compacted.Write(buffer.Bytes())
+	if err == nil {
+		err = compacted.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tempPath, journal.path)
+	}
+	if err != nil {
+		compacted.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("Cannot compact journal: %v", err)
+	}
+
+	journal.file.Close()
+	journal.file = compacted
+	journal.entries = append([]JournalEntry{}, journal.entries[from:]...)
+
+	return nil
+}
+
+// Unsaved returns the journaled changes that haven't been marked as saved, leaving out changes reverted by an undo that
+// has been saved
+func (journal *Journal) Unsaved() []JournalEntry {
+	unsaved := []JournalEntry{}
+	for _, entry := range journal.entries {
+		if entry.Kind != journalSaved {
+			unsaved = append(unsaved, entry)
+			continue
+		}
+		if len(entry.Saves) <= 0 {
+			unsaved = []JournalEntry{}
+			continue
+		}
+
+		saved := map[int]bool{}
+		for _, seq := range entry.Saves {
+			saved[seq] = true
+		}
+		remaining := []JournalEntry{}
+		for _, unsavedEntry := range unsaved {
+			if !saved[unsavedEntry.Seq] {
+				remaining = append(remaining, unsavedEntry)
+			}
+		}
+		unsaved = remaining
+	}
+
+	pendingUndos := map[int]bool{}
+	for _, entry := range unsaved {
+		if entry.Kind == journalUndo {
+			pendingUndos[entry.Undoes] = true
+		}
+	}
+	undone := journal.undone()
+	remaining := []JournalEntry{}
+	for _, entry := range unsaved {
+		if !undone[entry.Seq] || pendingUndos[entry.Seq] {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return remaining
+}
+
+// Recover re-applies unsaved journaled changes to the dataset (as loaded from the data store), returning the number of
+// journal entries applied. The changes are then tracked by the dataset, to be saved to the data store.
+func (journal *Journal) Recover(data *Dataset) (int, error) {
+	unsaved := journal.Unsaved()
+	isUnsaved := map[int]bool{}
+	for _, entry := range unsaved {
+		isUnsaved[entry.Seq] = true
+	}
+
+	// records changed again by a later change that was saved are already up to date in the data store
+	savedAfter := map[string]int{}
+	for _, entry := range journal.entries {
+		if entry.Kind == journalSaved || isUnsaved[entry.Seq] {
+			continue
+		}
+		for _, change := range entry.Changes {
+			savedAfter[change.Key] = entry.Seq
+		}
+	}
+
+	for _, entry := range unsaved {
+		for _, change := range entry.Changes {
+			if savedAfter[change.Key] > entry.Seq {
+				continue
+			}
+
+			err := applyRecordImage(data, change.Key, change.After)
+			if err != nil {
+				return 0, fmt.Errorf("Cannot recover journal entry %d: %v", entry.Seq, err)
+			}
+		}
+	}
+
+	return len(unsaved), nil
+}
+
+// undone returns the seqs of changes that have been reverted
+func (journal *Journal) undone() map[int]bool {
+	undone := map[int]bool{}
+	for _, entry := range journal.entries {
+		if entry.Kind == journalUndo {
+			undone[entry.Undoes] = true
+		}
+	}
+
+	return undone
+}
+
+// Undo reverts the most recent change that has not already been undone, within the undo horizon (the most recent change
+// and undo entries), returning its journal entry. The reverted records are tracked by the dataset, to be journaled (as an
+// undo entry) and saved.
+func (journal *Journal) Undo(data *Dataset) (JournalEntry, error) {
+	undone := journal.undone()
+	changes := 0
+
+	for i := len(journal.entries) - 1; i >= 0 && changes < journalUndoHorizon; i-- {
+		entry := journal.entries[i]
+		if entry.Kind != journalSaved {
+			changes++
+		}
+		if entry.Kind != journalChange || undone[entry.Seq] {
+			continue
+		}
+
+		for _, change := range entry.Changes {
+			err := applyRecordImage(data, change.Key, change.Before)
+			if err != nil {
+				return entry, fmt.Errorf("Cannot undo change %d: %v", entry.Seq, err)
+			}
+		}
+
+		return entry, nil
+	}
+
+	return JournalEntry{}, errors.New("Nothing to undo")
+}
+
+// History returns up to the given number of the most recent change and undo entries, most recent first
+func (journal *Journal) History(limit int) []JournalEntry {
+	history := []JournalEntry{}
+	for i := len(journal.entries) - 1; i >= 0 && len(history) < limit; i-- {
+		if journal.entries[i].Kind != journalSaved {
+			history = append(history, journal.entries[i])
+		}
+	}
+
+	return history
+}
+
+func (journal *Journal) Close() error {
+	return journal.file.Close()
+}
+
+// splitRecordKey splits a record key ("ticket/<id>") into its record type and ID
+func splitRecordKey(key string) (string, string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) < 2 {
+		return key, ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// applyRecordImage sets a record to a journaled version of it, deleting the record if the version is null
+func applyRecordImage(data *Dataset, key string, image json.RawMessage) error {
+	entityType, id := splitRecordKey(key)
+
+	if len(image) <= 0 || bytes.Equal(image, []byte("null")) {
+		if _, err := data.GetRecord(entityType, id); err != nil {
+			return nil // already deleted
+		}
+		return data.DeleteRecord(entityType, id)
+	}
+
+	var record interface{}
+	var err error
+
+	switch entityType {
+	case "org":
+		org := Organization{}
+		err = json.Unmarshal(image, &org)
+		record = org
+	case "user":
+		user := User{}
+		err = json.Unmarshal(image, &user)
+		record = user
+	case "ticket":
+		ticket := Ticket{}
+		err = json.Unmarshal(image, &ticket)
+		record = ticket
+	default:
+		return fmt.Errorf("Invalid record key: %s", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Invalid record %s: %v", key, err)
+	}
+
+	data.PutRecord(record)
+	return nil
+}
+
+// SaveChanges journals the changes made to the dataset since they were last taken (if journaling is enabled), then saves
+// them to the data store
+func SaveChanges(store Store, journal *Journal, data *Dataset, kind, description string, undoes int) error {
+	changes := data.TakeChanges()
+	if changes.Empty() {
+		return nil
+	}
+
+	var entry JournalEntry
+	if journal != nil {
+		var err error
+		entry, err = journal.Record(data, kind, description, undoes, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := store.Commit(data, changes)
+	if err != nil && err != errReadOnlyStore {
+		// left unsaved in the journal, to be recovered on the next startup
+		return err
+	}
+
+	if journal != nil {
+		// changes to a read-only (API imported) store are marked as saved too, as they aren't meant to outlast the session
+		saveErr := journal.MarkSaved(entry.Seq)
+		if saveErr != nil {
+			return saveErr
+		}
+	}
+
+	return err
+}
+
+// FormatJournalHistory outputs journal entries in a human-readable format, marking changes that have been undone
+func FormatJournalHistory(journal *Journal) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nHISTORY\n-------\n")
+
+	history := journal.History(journalHistoryLength)
+	if len(history) <= 0 {
+		formattedResult.WriteString("<No changes>\n")
+		return formattedResult.String()
+	}
+
+	undone := journal.undone()
+	for _, entry := range history {
+		status := ""
+		if undone[entry.Seq] {
+			status = " [undone]"
+		}
+
+		formattedResult.WriteString(fmt.Sprintf("#%d  %s  %s (%d record(s))%s\n", entry.Seq, entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Description, len(entry.Changes), status))
+	}
+
+	return formattedResult.String()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openTestJournal opens a dataset (loaded from copies of the data files), its store and a journal
+func openTestJournal(t *testing.T, config AppConfig) (*Dataset, Store, *Journal) {
+	store, err := OpenStore(config)
+	if err != nil {
+		t.Fatalf("%s: cannot open store - %v\n", t.Name(), err)
+	}
+
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		t.Fatalf("%s: error loading data - %v\n", t.Name(), err)
+	}
+
+	journal, err := OpenJournal(config.JournalFileLocation)
+	if err != nil {
+		t.Fatalf("%s: cannot open journal - %v\n", t.Name(), err)
+	}
+
+	return NewDataset(OrgList, UserList, TicketList), store, journal
+}
+
+func TestJournalUndo(t *testing.T) {
+	config := tempDataConfig(t, t.TempDir())
+	data, store, journal := openTestJournal(t, config)
+	defer journal.Close()
+
+	ticketID := "1a227508-9f39-427c-8f57-1b72f3fab87c"
+	original, _ := data.GetTicket(ticketID)
+	originalUser, _ := data.GetUser(1)
+
+	commands := []WriteCommand{
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Status", Value: "solved"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Assignee", Value: "49"},
+		{Action: "delete", EntityType: "user", ID: "1"},
+	}
+	for _, command := range commands {
+		description, err := RunWriteCommand(data, command)
+		if err == nil {
+			err = SaveChanges(store, journal, data, journalChange, description, 0)
+		}
+		if err != nil {
+			t.Fatalf("TestJournalUndo: error running %+v - %v\n", command, err)
+		}
+	}
+
+	history := journal.History(journalHistoryLength)
+	if len(history) != 3 || history[0].Description != "Deleted user 1" || len(journal.Unsaved()) != 0 {
+		t.Errorf("TestJournalUndo: unexpected history: %+v\n", history)
+	}
+
+	// undo all three changes, most recent first
+	for i := 0; i < 3; i++ {
+		entry, err := journal.Undo(data)
+		if err == nil {
+			err = SaveChanges(store, journal, data, journalUndo, "Undid "+entry.Description, entry.Seq)
+		}
+		if err != nil {
+			t.Fatalf("TestJournalUndo: error undoing change - %v\n", err)
+		}
+	}
+
+	if _, err := journal.Undo(data); err == nil {
+		t.Error("TestJournalUndo: undo succeeded with nothing left to undo.\n")
+	}
+
+	ticket, _ := data.GetTicket(ticketID)
+	user, found := data.GetUser(1)
+	if !reflect.DeepEqual(ticket, original) || !found || !reflect.DeepEqual(user, originalUser) {
+		t.Errorf("TestJournalUndo: records not restored: %+v\n", ticket)
+	}
+	checkIndexesMatchRebuild(t, "TestJournalUndo", data)
+
+	// the reverted records should have been saved too
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestJournalUndo: error reloading data - %v\n", err)
+	}
+	reloaded := NewDataset(OrgList, UserList, TicketList)
+	if ticket, _ := reloaded.GetTicket(ticketID); ticket.Status != original.Status || len(reloaded.UserList) != 75 {
+		t.Error("TestJournalUndo: undone changes not saved.\n")
+	}
+
+	if formatted := FormatJournalHistory(journal); strings.Count(formatted, "[undone]") != 3 {
+		t.Errorf("TestJournalUndo: history doesn't show undone changes:\n%s\n", formatted)
+	}
+}
+
+func TestJournalRecovery(t *testing.T) {
+	config := tempDataConfig(t, t.TempDir())
+	data, _, journal := openTestJournal(t, config)
+
+	// journal a change without saving it, as if the app crashed before the data store was updated
+	ticketID := "1a227508-9f39-427c-8f57-1b72f3fab87c"
+	_, err := RunWriteCommand(data, WriteCommand{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Status", Value: "solved"})
+	if err == nil {
+		_, err = journal.Record(data, journalChange, "Updated ticket", 0, data.TakeChanges())
+	}
+	if err != nil {
+		t.Fatalf("TestJournalRecovery: error journaling change - %v\n", err)
+	}
+	journal.Close()
+
+	// a partially written entry at the end of the journal should be ignored
+	journalFile, _ := os.OpenFile(config.JournalFileLocation, os.O_APPEND|os.O_WRONLY, 0644)
+	journalFile.WriteString(`{"seq":2,"kind":"change","changes":[{"key":"ticket/`)
+	journalFile.Close()
+
+	data, _, journal = openTestJournal(t, config)
+	defer journal.Close()
+
+	if ticket, _ := data.GetTicket(ticketID); ticket.Status == "solved" {
+		t.Fatal("TestJournalRecovery: unsaved change found in data files.\n")
+	}
+
+	recovered, err := journal.Recover(data)
+	if err != nil || recovered != 1 {
+		t.Fatalf("TestJournalRecovery: expected 1 recovered change, got %d (error %v)\n", recovered, err)
+	}
+
+	if ticket, _ := data.GetTicket(ticketID); ticket.Status != "solved" || !data.TakeChanges().Tickets[ticketID] {
+		t.Error("TestJournalRecovery: unsaved change not recovered.\n")
+	}
+
+	journalData, _ := ioutil.ReadFile(config.JournalFileLocation)
+	if strings.Count(string(journalData), "\n") != 1 || !strings.HasSuffix(string(journalData), "\n") {
+		t.Error("TestJournalRecovery: incomplete journal entry not discarded.\n")
+	}
+}
+
+func TestJournalMarkSaved(t *testing.T) {
+	config := tempDataConfig(t, t.TempDir())
+	data, store, journal := openTestJournal(t, config)
+	defer journal.Close()
+
+	ticketID := "1a227508-9f39-427c-8f57-1b72f3fab87c"
+	seqs := []int{}
+	for _, status := range []string{"solved", "closed"} {
+		_, err := RunWriteCommand(data, WriteCommand{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Status", Value: status})
+		var entry JournalEntry
+		if err == nil {
+			entry, err = journal.Record(data, journalChange, "Updated ticket", 0, data.TakeChanges())
+		}
+		if err != nil {
+			t.Fatalf("TestJournalMarkSaved: error journaling change - %v\n", err)
+		}
+		seqs = append(seqs, entry.Seq)
+	}
+
+	// only the entries marked as saved stop being unsaved
+	if err := journal.MarkSaved(seqs[1]); err != nil {
+		t.Fatalf("TestJournalMarkSaved: error marking change saved - %v\n", err)
+	}
+	if unsaved := journal.Unsaved(); len(unsaved) != 1 || unsaved[0].Seq != seqs[0] {
+		t.Errorf("TestJournalMarkSaved: unexpected unsaved changes: %+v\n", unsaved)
+	}
+
+	// the unsaved change isn't recovered over the later change to the same ticket, which was saved
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestJournalMarkSaved: error reloading data - %v\n", err)
+	}
+	reloaded := NewDataset(OrgList, UserList, TicketList)
+	if _, err := journal.Recover(reloaded); err != nil {
+		t.Fatalf("TestJournalMarkSaved: error recovering changes - %v\n", err)
+	}
+	if ticket, _ := reloaded.GetTicket(ticketID); ticket.Status == "solved" {
+		t.Error("TestJournalMarkSaved: recovered change replaced a later saved change.\n")
+	}
+
+	if err := journal.MarkSaved(); err != nil || len(journal.Unsaved()) != 0 {
+		t.Errorf("TestJournalMarkSaved: changes left unsaved after marking all saved (error %v)\n", err)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("TestJournalCompaction: cannot open journal - %v\n", err)
+	}
+
+	// journal 250 changes, saving all but the first
+	for i := 1; i <= 250; i++ {
+		entry, err := journal.append(JournalEntry{Kind: journalChange, Description: fmt.Sprintf("Change %d", i)})
+		if err == nil && i > 1 {
+			err = journal.MarkSaved(entry.Seq)
+		}
+		if err != nil {
+			t.Fatalf("TestJournalCompaction: error journaling change %d - %v\n", i, err)
+		}
+	}
+
+	// the unsaved first change keeps the journal from being compacted
+	if len(journal.entries) != 499 || journal.entries[0].Seq != 1 {
+		t.Errorf("TestJournalCompaction: journal with an unsaved change compacted to %d entries\n", len(journal.entries))
+	}
+
+	// once it is saved, the journal is rewritten with only the changes within the undo horizon (and their saved entries)
+	history := journal.History(journalHistoryLength)
+	if err := journal.MarkSaved(); err != nil {
+		t.Fatalf("TestJournalCompaction: error marking changes saved - %v\n", err)
+	}
+	if len(journal.entries) != 2*journalUndoHorizon+1 || journal.entries[0].Description != "Change 151" {
+		t.Errorf("TestJournalCompaction: expected %d entries from change 151, got %d from %q\n", 2*journalUndoHorizon+1, len(journal.entries), journal.entries[0].Description)
+	}
+
+	// further entries are appended to the compacted file
+	if _, err := journal.append(JournalEntry{Kind: journalChange, Description: "Change 251"}); err != nil {
+		t.Fatalf("TestJournalCompaction: error journaling change after compaction - %v\n", err)
+	}
+	journal.Close()
+
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("TestJournalCompaction: temporary file left behind (error %v)\n", err)
+	}
+
+	reopened, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("TestJournalCompaction: cannot reopen journal - %v\n", err)
+	}
+	defer reopened.Close()
+
+	unsaved := reopened.Unsaved()
+	if len(reopened.entries) != 2*journalUndoHorizon+2 || len(unsaved) != 1 || unsaved[0].Description != "Change 251" {
+		t.Errorf("TestJournalCompaction: compacted journal reopened with %d entries, unsaved %+v\n", len(reopened.entries), unsaved)
+	}
+	if reopened.entries[len(reopened.entries)-1].Seq != 501 {
+		t.Errorf("TestJournalCompaction: seqs not continued after compaction: %+v\n", reopened.entries[len(reopened.entries)-1])
+	}
+	if reopenedHistory := reopened.History(journalHistoryLength); !reflect.DeepEqual(descriptions(reopenedHistory[1:]), descriptions(history[:len(history)-1])) {
+		t.Errorf("TestJournalCompaction: history changed by compaction: %v\n", descriptions(reopenedHistory))
+	}
+}
+
+// descriptions returns the descriptions of journal entries
+func descriptions(entries []JournalEntry) []string {
+	result := []string{}
+	for _, entry := range entries {
+		result = append(result, entry.Description)
+	}
+
+	return result
+}
@@ -0,0 +1,935 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -------------------- embedded key/value store --------------------
+
+// The key/value store is a single append-only log file. Each entry is a header followed by the key and value:
+//
+//	checksum (4 bytes, CRC-32 of the rest of the entry) | operation (1 byte) | key length (4 bytes) | value length (4 bytes)
+//
+// Opening the file reads every entry to build an in-memory map from keys to value locations, so lookups need a single read.
+// Replaced and deleted values stay in the file until it is compacted, which rewrites it with only the live entries. An entry
+// left incomplete by a crash fails its checksum (or has lengths running past the end of the file), and the file is truncated
+// back to the last complete entry. Any other corrupt entry stops the file from being opened, rather than losing the entries
+// after it.
+
+const (
+	kvOpPut    byte = 1
+	kvOpDelete byte = 2
+
+	kvHeaderSize = 13
+
+	// compact once replaced/deleted entries take up more space than this and more than the live entries
+	kvCompactionThreshold = 1 << 20
+
+	// largest key and value an entry can hold. Longer lengths in an entry header can only come from a corrupt entry.
+	kvMaxKeySize   = 1 << 16
+	kvMaxValueSize = 1 << 26
+)
+
+// kvLocation is the position of a live value in the log file
+type kvLocation struct {
+	offset int64 // offset of the value
+	length int
+	seq    int // order in which the key was first written, so keys can be listed in insertion order
+}
+
+// KVWrite is a single put (or delete, if Delete is set) to apply to a key/value file
+type KVWrite struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// KVFile is an append-only key/value log file
+type KVFile struct {
+	path      string
+	file      *os.File
+	locations map[string]kvLocation
+	size      int64 // size of the file
+	liveBytes int64 // space taken up by entries holding live values
+	nextSeq   int
+}
+
+// OpenKVFile opens (or creates) a key/value file, reading its entries and recovering from any incomplete final entry
+func OpenKVFile(path string) (*KVFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := &KVFile{path: path, file: file, locations: map[string]kvLocation{}}
+	err = kv.readEntries()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// readEntries reads every entry in the file, building the map of live values. An entry left incomplete at the end of the
+// file by an interrupted write is discarded, but a corrupt entry anywhere before that is an error, as truncating the file
+// there would also discard every valid entry after it.
+func (kv *KVFile) readEntries() error {
+	fileInfo, err := kv.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(kv.file)
+	offset := int64(0)
+	header := make([]byte, kvHeaderSize)
+
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// incomplete header at the end of the file
+			return kv.truncate(offset)
+		}
+
+		op := header[4]
+		keyLength := binary.BigEndian.Uint32(header[5:9])
+		valueLength := binary.BigEndian.Uint32(header[9:13])
+
+		// check the lengths before allocating for them, as the header isn't covered by the checksum until the body is read
+		remaining := fileInfo.Size() - offset - kvHeaderSize
+		if int64(keyLength)+int64(valueLength) > remaining {
+			// the entry runs past the end of the file
+			return kv.truncate(offset)
+		}
+		if keyLength > kvMaxKeySize || valueLength > kvMaxValueSize {
+			return kv.corruptEntry(offset)
+		}
+
+		body := make([]byte, int(keyLength)+int(valueLength))
+		_, err = io.ReadFull(reader, body)
+		if err != nil {
+			return err
+		}
+
+		entrySize := int64(kvHeaderSize + len(body))
+		checksum := crc32.NewIEEE()
+		checksum.Write(header[4:])
+		checksum.Write(body)
+		if checksum.Sum32() != binary.BigEndian.Uint32(header[0:4]) || (op != kvOpPut && op != kvOpDelete) {
+			if offset+entrySize == fileInfo.Size() {
+				// the last entry in the file wasn't completely written
+				return kv.truncate(offset)
+			}
+			return kv.corruptEntry(offset)
+		}
+
+		kv.apply(string(body[:keyLength]), op, offset+kvHeaderSize+int64(keyLength), int(valueLength), entrySize)
+		offset += entrySize
+	}
+
+	kv.size = offset
+	return nil
+}
+
+// truncate discards an incomplete entry at the end of the file
+func (kv *KVFile) truncate(offset int64) error {
+	log.Printf("Discarding incomplete last entry of key/value file %s (at offset %d)", kv.path, offset)
+
+	err := kv.file.Truncate(offset)
+	if err != nil {
+		return fmt.Errorf("Cannot recover key/value file %s: %v", kv.path, err)
+	}
+
+	kv.size = offset
+	return nil
+}
+
+// corruptEntry returns the error for a corrupt entry that isn't the last one in the file, leaving the file as it is
+func (kv *KVFile) corruptEntry(offset int64) error {
+	return fmt.Errorf("Corrupt entry at offset %d in key/value file %s", offset, kv.path)
+}
+
+// apply updates the map of live values for an entry written to the file
+func (kv *KVFile) apply(key string, op byte, valueOffset int64, valueLength int, entrySize int64) {
+	old, exists := kv.locations[key]
+	if exists {
+		kv.liveBytes -= int64(kvHeaderSize + len(key) + old.length)
+	}
+
+	if op == kvOpDelete {
+		delete(kv.locations, key)
+		return
+	}
+
+	seq := old.seq
+	if !exists {
+		seq = kv.nextSeq
+		kv.nextSeq++
+	}
+
+	kv.locations[key] = kvLocation{offset: valueOffset, length: valueLength, seq: seq}
+	kv.liveBytes += entrySize
+}
+
+// Get returns the value stored for a key, and whether the key was found
+func (kv *KVFile) Get(key string) ([]byte, bool, error) {
+	location, found := kv.locations[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	value := make([]byte, location.length)
+	_, err := kv.file.ReadAt(value, location.offset)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Keys returns the keys with a given prefix, in the order they were first written
+func (kv *KVFile) Keys(prefix string) []string {
+	keys := []string{}
+	for key := range kv.locations {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return kv.locations[keys[i]].seq < kv.locations[keys[j]].seq
+	})
+
+	return keys
+}
+
+// Len returns the number of live keys
+func (kv *KVFile) Len() int {
+	return len(kv.locations)
+}
+
+// Write appends a batch of writes to the file, syncing it to disk once all have been written
+func (kv *KVFile) Write(writes []KVWrite) error {
+	if len(writes) <= 0 {
+		return nil
+	}
+
+	var buffer []byte
+	type pending struct {
+		op          byte
+		valueOffset int64
+		entrySize   int64
+	}
+	applied := []pending{}
+
+	for _, write := range writes {
+		op := kvOpPut
+		value := write.Value
+		if write.Delete {
+			op = kvOpDelete
+			value = nil
+		}
+
+		if len(write.Key) > kvMaxKeySize || len(value) > kvMaxValueSize {
+			return fmt.Errorf("Cannot write %s to key/value file %s: entry too large", write.Key, kv.path)
+		}
+
+		header := make([]byte, kvHeaderSize)
+		header[4] = op
+		binary.BigEndian.PutUint32(header[5:9], uint32(len(write.Key)))
+		binary.BigEndian.PutUint32(header[9:13], uint32(len(value)))
+
+		checksum := crc32.NewIEEE()
+		checksum.Write(header[4:])
+		checksum.Write([]byte(write.Key))
+		checksum.Write(value)
+		binary.BigEndian.PutUint32(header[0:4], checksum.Sum32())
+
+		entryOffset := kv.size + int64(len(buffer))
+		buffer = append(buffer, header...)
+		buffer = append(buffer, write.Key...)
+		buffer = append(buffer, value...)
+
+		entrySize := int64(kvHeaderSize + len(write.Key) + len(value))
+		applied = append(applied, pending{op: op, valueOffset: entryOffset + kvHeaderSize + int64(len(write.Key)), entrySize: entrySize})
+	}
+
+	_, err := kv.file.WriteAt(buffer, kv.size)
+	if err == nil {
+		err = kv.file.Sync()
+	}
+	if err != nil {
+		// leave the file as it was before the batch
+		kv.file.Truncate(kv.size)
+		return err
+	}
+
+	for i, write := range writes {
+		valueLength := len(write.Value)
+		if write.Delete {
+			valueLength = 0
+		}
+		kv.apply(write.Key, applied[i].op, applied[i].valueOffset, valueLength, applied[i].entrySize)
+	}
+	kv.size += int64(len(buffer))
+
+	return nil
+}
+
+// NeedsCompaction reports whether replaced and deleted entries are taking up enough space to be worth compacting
+func (kv *KVFile) NeedsCompaction() bool {
+	deadBytes := kv.size - kv.liveBytes
+	return deadBytes > kvCompactionThreshold && deadBytes > kv.liveBytes
+}
+
+// Compact rewrites the file with only its live entries (in insertion order), replacing the old file once the new one is
+// completely written
+func (kv *KVFile) Compact() error {
+	keys := kv.Keys("")
+	writes := []KVWrite{}
+	for _, key := range keys {
+		value, _, err := kv.Get(key)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, KVWrite{Key: key, Value: value})
+	}
+
+	tempPath := kv.path + ".compact"
+	os.Remove(tempPath)
+	compacted, err := OpenKVFile(tempPath)
+	if err != nil {
+		return err
+	}
+
+	err = compacted.Write(writes)
+	if err != nil {
+		compacted.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Rename(tempPath, kv.path)
+	if err != nil {
+		compacted.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	kv.file.Close()
+	compacted.path = kv.path
+	*kv = *compacted
+
+	return nil
+}
+
+func (kv *KVFile) Close() error {
+	return kv.file.Close()
+}
+
+// KVStore stores orgs, users and tickets in a key/value file, one record per key ("org/101", "user/1", "ticket/<id>"), so
+// changes are persisted record-by-record. The relationship indexes are persisted alongside them, one key per index entry
+// holding the IDs of its records (e.g. "index/org-users/101"), and are updated by each commit, so loading the store doesn't
+// rebuild them.
+type KVStore struct {
+	kv *KVFile
+}
+
+// key prefixes of the persisted relationship indexes
+const (
+	kvOrgUsersPrefix         = "index/org-users/"         // org ID -> IDs of its users
+	kvOrgTicketsPrefix       = "index/org-tickets/"       // org ID -> IDs of its tickets
+	kvSubmittedTicketsPrefix = "index/submitted-tickets/" // user ID -> IDs of the tickets they submitted
+	kvAssignedTicketsPrefix  = "index/assigned-tickets/"  // user ID -> IDs of the tickets assigned to them
+	kvOrgDomainsPrefix       = "index/org-domains/"       // domain name -> IDs of the orgs listing it
+
+	// present once the relationship indexes are persisted, so that stores written before they were are indexed on load
+	kvIndexedKey = "index/indexed"
+)
+
+// OpenKVStore opens (or creates) a key/value store file
+func OpenKVStore(path string) (*KVStore, error) {
+	if path == "" {
+		return nil, errors.New("No StoreFileLocation configured for the kv storage backend")
+	}
+
+	kv, err := OpenKVFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVStore{kv: kv}, nil
+}
+
+func orgKey(id int) string {
+	return fmt.Sprintf("org/%d", id)
+}
+
+func userKey(id int) string {
+	return fmt.Sprintf("user/%d", id)
+}
+
+func ticketKey(id string) string {
+	return "ticket/" + id
+}
+
+// Empty reports whether the store holds no records
+func (store *KVStore) Empty() bool {
+	return store.kv.Len() <= 0
+}
+
+// indexed reports whether the store holds the relationship indexes of its records
+func (store *KVStore) indexed() bool {
+	_, found := store.kv.locations[kvIndexedKey]
+	return found
+}
+
+// Import writes a complete set of orgs, users and tickets to the store
+func (store *KVStore) Import(OrgList []Organization, UserList []User, TicketList []Ticket) error {
+	return store.Commit(NewDataset(OrgList, UserList, TicketList), allRecords(OrgList, UserList, TicketList))
+}
+
+// allRecords returns a change set including every given record
+func allRecords(OrgList []Organization, UserList []User, TicketList []Ticket) ChangeSet {
+	changes := newChangeSet()
+	for _, org := range OrgList {
+		changes.Orgs[org.ID] = true
+	}
+	for _, user := range UserList {
+		changes.Users[user.ID] = true
+	}
+	for _, ticket := range TicketList {
+		changes.Tickets[ticket.ID] = true
+	}
+
+	return changes
+}
+
+// Load reads all records from the store, in the order they were first stored
+func (store *KVStore) Load() ([]Organization, []User, []Ticket, error) {
+	OrgList := []Organization{}
+	for _, key := range store.kv.Keys("org/") {
+		org := Organization{}
+		err := store.getRecord(key, &org)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		OrgList = append(OrgList, org)
+	}
+
+	UserList := []User{}
+	for _, key := range store.kv.Keys("user/") {
+		user := User{}
+		err := store.getRecord(key, &user)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		UserList = append(UserList, user)
+	}
+
+	TicketList := []Ticket{}
+	for _, key := range store.kv.Keys("ticket/") {
+		ticket := Ticket{}
+		err := store.getRecord(key, &ticket)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		TicketList = append(TicketList, ticket)
+	}
+
+	return OrgList, UserList, TicketList, nil
+}
+
+// LoadDataset reads all records from the store along with their persisted relationship indexes. A store written before the
+// indexes were persisted has them built from its records once, and written to it.
+func (store *KVStore) LoadDataset() (*Dataset, error) {
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if !store.indexed() {
+		data := NewDataset(OrgList, UserList, TicketList)
+		writes, err := store.indexWrites(data, allRecords(OrgList, UserList, TicketList))
+		if err == nil {
+			err = store.kv.Write(writes)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return data, nil
+	}
+
+	indexes := RelationshipIndexes{
+		OrgUsers:         map[int][]int{},
+		OrgTickets:       map[int][]string{},
+		SubmittedTickets: map[int][]string{},
+		AssignedTickets:  map[int][]string{},
+		OrgDomains:       map[string][]int{},
+	}
+
+	err = store.readIndex(kvOrgUsersPrefix, func(key string, ids []string) error {
+		return addIntIndexEntry(indexes.OrgUsers, key, ids)
+	})
+	if err == nil {
+		err = store.readIndex(kvOrgTicketsPrefix, func(key string, ids []string) error {
+			return addTicketIndexEntry(indexes.OrgTickets, key, ids)
+		})
+	}
+	if err == nil {
+		err = store.readIndex(kvSubmittedTicketsPrefix, func(key string, ids []string) error {
+			return addTicketIndexEntry(indexes.SubmittedTickets, key, ids)
+		})
+	}
+	if err == nil {
+		err = store.readIndex(kvAssignedTicketsPrefix, func(key string, ids []string) error {
+			return addTicketIndexEntry(indexes.AssignedTickets, key, ids)
+		})
+	}
+	if err == nil {
+		err = store.readIndex(kvOrgDomainsPrefix, func(domain string, ids []string) error {
+			for _, id := range ids {
+				orgID, err := strconv.Atoi(id)
+				if err != nil {
+					return fmt.Errorf("Invalid org ID %q in the %s domain index", id, domain)
+				}
+				indexes.OrgDomains[domain] = append(indexes.OrgDomains[domain], orgID)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid index in %s: %v", store.kv.path, err)
+	}
+
+	return NewDatasetWithIndexes(OrgList, UserList, TicketList, indexes), nil
+}
+
+// readIndex calls add with the key (without the prefix) and IDs of each entry of a persisted index
+func (store *KVStore) readIndex(prefix string, add func(key string, ids []string) error) error {
+	for _, key := range store.kv.Keys(prefix) {
+		ids, err := store.indexEntry(key)
+		if err != nil {
+			return err
+		}
+
+		err = add(strings.TrimPrefix(key, prefix), ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexEntry reads the IDs of a persisted index entry (none if there is no entry)
+func (store *KVStore) indexEntry(key string) ([]string, error) {
+	value, found, err := store.kv.Get(key)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	ids := []string{}
+	err = json.Unmarshal(value, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid index entry %s: %v", key, err)
+	}
+
+	return ids, nil
+}
+
+// addIntIndexEntry adds the IDs of a persisted index entry keyed by user or org ID, with the IDs being user or org IDs
+func addIntIndexEntry(index map[int][]int, key string, ids []string) error {
+	intKey, err := strconv.Atoi(key)
+	if err != nil {
+		return fmt.Errorf("Invalid index key %q", key)
+	}
+
+	for _, id := range ids {
+		intID, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("Invalid ID %q in index entry %s", id, key)
+		}
+		index[intKey] = append(index[intKey], intID)
+	}
+
+	return nil
+}
+
+// addTicketIndexEntry adds the ticket IDs of a persisted index entry keyed by user or org ID
+func addTicketIndexEntry(index map[int][]string, key string, ids []string) error {
+	intKey, err := strconv.Atoi(key)
+	if err != nil {
+		return fmt.Errorf("Invalid index key %q", key)
+	}
+
+	index[intKey] = append(index[intKey], ids...)
+	return nil
+}
+
+// getRecord reads and decodes the record stored for a key
+func (store *KVStore) getRecord(key string, record interface{}) error {
+	value, _, err := store.kv.Get(key)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(value, record)
+	if err != nil {
+		return fmt.Errorf("Invalid record %s in %s: %v", key, store.kv.path, err)
+	}
+
+	return nil
+}
+
+// storedRecord reads and decodes the record stored for a key, returning false if the store doesn't hold it
+func (store *KVStore) storedRecord(key string, record interface{}) (bool, error) {
+	if _, found := store.kv.locations[key]; !found {
+		return false, nil
+	}
+
+	return true, store.getRecord(key, record)
+}
+
+// Commit writes each changed record as it now is in the dataset (or deletes it, if no longer in the dataset), along with the
+// index entries the changes affect, in a single batch, compacting the store file if needed. As in the dataset, the first
+// record is used where IDs are duplicated.
+func (store *KVStore) Commit(data *Dataset, changes ChangeSet) error {
+	writes := []KVWrite{}
+
+	addWrite := func(key string, record interface{}, exists bool) error {
+		if !exists {
+			writes = append(writes, KVWrite{Key: key, Delete: true})
+			return nil
+		}
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, KVWrite{Key: key, Value: value})
+		return nil
+	}
+
+	// the index entries are updated from the records as they are stored, so they are read before being replaced. A store
+	// holding records but no indexes yet is indexed when it's next loaded.
+	var indexWrites []KVWrite
+	var err error
+	if store.indexed() || store.Empty() {
+		indexWrites, err = store.indexWrites(data, changes)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write records in dataset order, so that new records are loaded back in the same order
+	written := map[string]bool{}
+	for _, org := range data.OrgList {
+		if changes.Orgs[org.ID] && !written[orgKey(org.ID)] {
+			written[orgKey(org.ID)] = true
+			err := addWrite(orgKey(org.ID), org, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id := range changes.Orgs {
+		if _, exists := data.GetOrg(id); !exists {
+			addWrite(orgKey(id), nil, false)
+		}
+	}
+
+	for _, user := range data.UserList {
+		if changes.Users[user.ID] && !written[userKey(user.ID)] {
+			written[userKey(user.ID)] = true
+			err := addWrite(userKey(user.ID), user, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id := range changes.Users {
+		if _, exists := data.GetUser(id); !exists {
+			addWrite(userKey(id), nil, false)
+		}
+	}
+
+	for _, ticket := range data.TicketList {
+		if changes.Tickets[ticket.ID] && !written[ticketKey(ticket.ID)] {
+			written[ticketKey(ticket.ID)] = true
+			err := addWrite(ticketKey(ticket.ID), ticket, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id := range changes.Tickets {
+		if _, exists := data.GetTicket(id); !exists {
+			addWrite(ticketKey(id), nil, false)
+		}
+	}
+
+	err = store.kv.Write(append(writes, indexWrites...))
+	if err != nil {
+		return err
+	}
+
+	if store.kv.NeedsCompaction() {
+		return store.kv.Compact()
+	}
+
+	return nil
+}
+
+// indexWrites returns the writes updating the persisted index entries affected by changes to records: each changed record is
+// moved from the entries of its stored version to those of its version in the dataset. Records are taken in dataset order,
+// so that new records are added to the end of an entry, as the dataset does. If the store isn't indexed yet, it's treated as
+// holding no records, so the entries are built from scratch.
+func (store *KVStore) indexWrites(data *Dataset, changes ChangeSet) ([]KVWrite, error) {
+	update := &kvIndexUpdate{store: store, entries: map[string][]string{}, rebuild: !store.indexed()}
+
+	updated := map[string]bool{}
+	for _, org := range data.OrgList {
+		if changes.Orgs[org.ID] && !updated[orgKey(org.ID)] {
+			updated[orgKey(org.ID)] = true
+			if err := update.org(org.ID, orgDomains(org)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for id := range changes.Orgs {
+		if _, exists := data.GetOrg(id); !exists {
+			if err := update.org(id, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, user := range data.UserList {
+		if changes.Users[user.ID] && !updated[userKey(user.ID)] {
+			updated[userKey(user.ID)] = true
+			if err := update.user(user.ID, []string{strconv.Itoa(user.Org)}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for id := range changes.Users {
+		if _, exists := data.GetUser(id); !exists {
+			if err := update.user(id, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, ticket := range data.TicketList {
+		if changes.Tickets[ticket.ID] && !updated[ticketKey(ticket.ID)] {
+			updated[ticketKey(ticket.ID)] = true
+			if err := update.ticket(ticket.ID, &ticket); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for id := range changes.Tickets {
+		if _, exists := data.GetTicket(id); !exists {
+			if err := update.ticket(id, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return update.writes(), nil
+}
+
+// kvIndexUpdate collects the persisted index entries changed by a commit
+type kvIndexUpdate struct {
+	store   *KVStore
+	entries map[string][]string // index key -> IDs, for the entries read (and possibly changed) so far
+	changed map[string]bool
+	rebuild bool // if set, stored records and index entries are ignored
+}
+
+// org moves an org to the domain index entries of its new domains (none if deleted)
+func (update *kvIndexUpdate) org(id int, domains []string) error {
+	stored := Organization{}
+	found, err := update.stored(orgKey(id), &stored)
+	if err != nil {
+		return err
+	}
+
+	var storedDomains []string
+	if found {
+		storedDomains = orgDomains(stored)
+	}
+
+	return update.move(kvOrgDomainsPrefix, storedDomains, domains, strconv.Itoa(id))
+}
+
+// user moves a user to the org index entry of its new org (none if deleted)
+func (update *kvIndexUpdate) user(id int, orgs []string) error {
+	stored := User{}
+	found, err := update.stored(userKey(id), &stored)
+	if err != nil {
+		return err
+	}
+
+	var storedOrgs []string
+	if found {
+		storedOrgs = []string{strconv.Itoa(stored.Org)}
+	}
+
+	return update.move(kvOrgUsersPrefix, storedOrgs, orgs, strconv.Itoa(id))
+}
+
+// ticket moves a ticket to the org, submitter and assignee index entries of its new version (none if deleted)
+func (update *kvIndexUpdate) ticket(id string, ticket *Ticket) error {
+	stored := Ticket{}
+	found, err := update.stored(ticketKey(id), &stored)
+	if err != nil {
+		return err
+	}
+
+	var storedOrg, storedSubmitter, storedAssignee, org, submitter, assignee []string
+	if found {
+		storedOrg, storedSubmitter, storedAssignee = []string{strconv.Itoa(stored.Org)}, []string{strconv.Itoa(stored.Submitter)}, []string{strconv.Itoa(stored.Assignee)}
+	}
+	if ticket != nil {
+		org, submitter, assignee = []string{strconv.Itoa(ticket.Org)}, []string{strconv.Itoa(ticket.Submitter)}, []string{strconv.Itoa(ticket.Assignee)}
+	}
+
+	err = update.move(kvOrgTicketsPrefix, storedOrg, org, id)
+	if err == nil {
+		err = update.move(kvSubmittedTicketsPrefix, storedSubmitter, submitter, id)
+	}
+	if err == nil {
+		err = update.move(kvAssignedTicketsPrefix, storedAssignee, assignee, id)
+	}
+
+	return err
+}
+
+// stored reads the stored version of a record, unless rebuilding the indexes
+func (update *kvIndexUpdate) stored(key string, record interface{}) (bool, error) {
+	if update.rebuild {
+		return false, nil
+	}
+
+	return update.store.storedRecord(key, record)
+}
+
+// move removes an ID from the index entries for keys it no longer has, and adds it to the end of the entries for new keys.
+// Entries for keys it keeps are left as they are, so it keeps its position in them.
+func (update *kvIndexUpdate) move(prefix string, oldKeys, newKeys []string, id string) error {
+	kept := map[string]bool{}
+	for _, key := range newKeys {
+		kept[key] = true
+	}
+	removed := map[string]bool{}
+	for _, key := range oldKeys {
+		removed[key] = !kept[key]
+		delete(kept, key)
+	}
+
+	for _, key := range oldKeys {
+		if !removed[key] {
+			continue
+		}
+
+		ids, err := update.entry(prefix + key)
+		if err != nil {
+			return err
+		}
+
+		remaining := []string{}
+		for _, entryID := range ids {
+			if entryID != id {
+				remaining = append(remaining, entryID)
+			}
+		}
+		update.set(prefix+key, remaining)
+	}
+
+	for _, key := range newKeys {
+		if !kept[key] {
+			continue
+		}
+
+		ids, err := update.entry(prefix + key)
+		if err != nil {
+			return err
+		}
+		update.set(prefix+key, append(ids, id))
+	}
+
+	return nil
+}
+
+// entry returns the IDs of an index entry, as changed so far by the update
+func (update *kvIndexUpdate) entry(key string) ([]string, error) {
+	if ids, read := update.entries[key]; read || update.rebuild {
+		return ids, nil
+	}
+
+	ids, err := update.store.indexEntry(key)
+	if err != nil {
+		return nil, err
+	}
+
+	update.entries[key] = ids
+	return ids, nil
+}
+
+func (update *kvIndexUpdate) set(key string, ids []string) {
+	update.entries[key] = ids
+	if update.changed == nil {
+		update.changed = map[string]bool{}
+	}
+	update.changed[key] = true
+}
+
+// writes returns the writes for the changed index entries (in key order), deleting entries left empty
+func (update *kvIndexUpdate) writes() []KVWrite {
+	keys := []string{}
+	for key := range update.changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writes := []KVWrite{}
+	for _, key := range keys {
+		ids := update.entries[key]
+		if len(ids) <= 0 {
+			if _, stored := update.store.kv.locations[key]; stored {
+				writes = append(writes, KVWrite{Key: key, Delete: true})
+			}
+			continue
+		}
+
+		value, _ := json.Marshal(ids)
+		writes = append(writes, KVWrite{Key: key, Value: value})
+	}
+
+	if update.rebuild {
+		writes = append(writes, KVWrite{Key: kvIndexedKey, Value: []byte("true")})
+	}
+
+	return writes
+}
+
+func (store *KVStore) Close() error {
+	return store.kv.Close()
+}
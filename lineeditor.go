@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// -------------------- line editor (editing keys, history, reverse search, tab completion) --------------------
+
+// maximum number of lines kept in the history (and the history file)
+const maxHistoryLength = 1000
+
+// errInterrupted is returned when a line is interrupted with Ctrl-C
+var errInterrupted = errors.New("Interrupted")
+
+// control keys handled by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// terminal settings while a line is edited: characters are read as they are typed, without echoing them, and control keys
+// (e.g. Ctrl-C) are passed to the line editor rather than handled by the terminal
+var rawModeSettings = []string{"-icanon", "-echo", "-isig", "-iexten", "-ixon", "min", "1", "time", "0"}
+
+// Completer returns the possible completions of a partially typed word, given the words before it
+type Completer func(words []string, partial string) []string
+
+// LineEditor reads lines from a terminal with editing keys (arrows, Home/End, Ctrl-A/E/K/U/W), history (up/down arrows,
+// Ctrl-P/N, and Ctrl-R reverse search) and tab completion. If the input isn't a terminal, lines are read as they are.
+type LineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	terminal    *os.File // input terminal, or nil if the input isn't a terminal
+	savedState  string   // terminal settings to restore after reading a line
+	complete    Completer
+	history     []string
+	historyFile string
+
+	// line being edited
+	prompt   string
+	line     []rune
+	cursor   int
+	position int    // position in the history while browsing it (len(history) for the line being edited)
+	draft    []rune // line being edited, kept while browsing the history
+}
+
+// NewLineEditor returns a line editor reading from the given input, loading the history from historyFile (if not empty)
+func NewLineEditor(input *os.File, out io.Writer, historyFile string, complete Completer) (*LineEditor, error) {
+	editor := newLineEditor(input, out, complete)
+
+	// the terminal settings can only be read if the input is a terminal
+	if state, err := stty(input, "-g"); err == nil {
+		editor.terminal = input
+		editor.savedState = strings.TrimSpace(state)
+	}
+
+	editor.historyFile = historyFile
+	return editor, editor.loadHistory()
+}
+
+func newLineEditor(input io.Reader, out io.Writer, complete Completer) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(input), out: out, complete: complete}
+}
+
+// stty runs stty on a terminal, returning its output
+func stty(terminal *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = terminal
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// ReadLine shows a prompt and reads a line, without the trailing newline. Returns io.EOF at the end of the input (or on
+// Ctrl-D on an empty line), and errInterrupted on Ctrl-C.
+func (editor *LineEditor) ReadLine(prompt string) (string, error) {
+	if editor.terminal == nil {
+		fmt.Fprint(editor.out, prompt)
+		line, err := editor.in.ReadString('\n')
+		if err != nil && line == "" {
+			// end the prompt's line, as a terminal does when Ctrl-D is pressed
+			fmt.Fprintln(editor.out)
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	restore, err := editor.rawMode()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return editor.edit(prompt)
+}
+
+// rawMode puts the terminal in raw mode to read keys as they are typed, returning a function restoring its settings
+func (editor *LineEditor) rawMode() (func(), error) {
+	if editor.terminal == nil {
+		return func() {}, nil
+	}
+
+	if _, err := stty(editor.terminal, rawModeSettings...); err != nil {
+		return nil, err
+	}
+	return func() { stty(editor.terminal, editor.savedState) }, nil
+}
+
+// readKey reads a key (in raw mode): a character, or the name of a special key ("enter", "esc", "backspace", "ctrl-c",
+// "up", "down", "left", "right", "home", "end", "pgup", "pgdn" or "delete")
+func (editor *LineEditor) readKey() (string, error) {
+	r, _, err := editor.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case keyCtrlC:
+		return "ctrl-c", nil
+	case keyBackspace, keyCtrlH:
+		return "backspace", nil
+	case keyEscape:
+		// a lone escape, or the start of an escape sequence
+		if editor.in.Buffered() <= 0 {
+			return "esc", nil
+		}
+		if next, _ := editor.in.Peek(1); next[0] != '[' && next[0] != 'O' {
+			return "esc", nil
+		}
+		editor.in.ReadRune()
+
+		params := []rune{}
+		for {
+			r, _, err = editor.in.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			if r >= '@' && r <= '~' {
+				break
+			}
+			params = append(params, r)
+		}
+
+		names := map[string]string{"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end",
+			"1~": "home", "7~": "home", "4~": "end", "8~": "end", "3~": "delete", "5~": "pgup", "6~": "pgdn"}
+		return names[string(params)+string(r)], nil
+	}
+
+	return string(r), nil
+}
+
+// AddHistory adds a line to the history (unless it is empty or repeats the previous line), appending it to the history file
+func (editor *LineEditor) AddHistory(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(editor.history) > 0 && editor.history[len(editor.history)-1] == line) {
+		return nil
+	}
+
+	editor.history = append(editor.history, line)
+	if len(editor.history) > maxHistoryLength {
+		editor.history = editor.history[len(editor.history)-maxHistoryLength:]
+	}
+
+	if editor.historyFile == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(editor.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(line + "\n")
+	return err
+}
+
+// loadHistory reads the history file, keeping its last maxHistoryLength lines (and rewriting the file if it was longer)
+func (editor *LineEditor) loadHistory() error {
+	if editor.historyFile == "" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(editor.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			editor.history = append(editor.history, line)
+		}
+	}
+
+	if len(editor.history) > maxHistoryLength {
+		editor.history = editor.history[len(editor.history)-maxHistoryLength:]
+		return ioutil.WriteFile(editor.historyFile, []byte(strings.Join(editor.history, "\n")+"\n"), 0600)
+	}
+
+	return nil
+}
+
+// edit reads keys until a line is entered, updating the line shown after each key
+func (editor *LineEditor) edit(prompt string) (string, error) {
+	editor.prompt, editor.line, editor.cursor = prompt, []rune{}, 0
+	editor.position, editor.draft = len(editor.history), nil
+	editor.refresh()
+
+	for {
+		r, _, err := editor.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(editor.out, "\r\n")
+			return string(editor.line), nil
+
+		case keyCtrlC:
+			fmt.Fprint(editor.out, "^C\r\n")
+			return "", errInterrupted
+
+		case keyCtrlD:
+			if len(editor.line) <= 0 {
+				fmt.Fprint(editor.out, "\r\n")
+				return "", io.EOF
+			}
+			editor.deleteAt(editor.cursor)
+
+		case keyBackspace, keyCtrlH:
+			if editor.cursor > 0 {
+				editor.cursor--
+				editor.deleteAt(editor.cursor)
+			}
+
+		case keyTab:
+			editor.completeWord()
+
+		case keyCtrlA:
+			editor.cursor = 0
+		case keyCtrlE:
+			editor.cursor = len(editor.line)
+		case keyCtrlB:
+			editor.moveCursor(-1)
+		case keyCtrlF:
+			editor.moveCursor(1)
+
+		case keyCtrlK:
+			editor.line = editor.line[:editor.cursor]
+		case keyCtrlU:
+			editor.line = append([]rune{}, editor.line[editor.cursor:]...)
+			editor.cursor = 0
+		case keyCtrlW:
+			editor.deleteWord()
+
+		case keyCtrlP:
+			editor.browseHistory(-1)
+		case keyCtrlN:
+			editor.browseHistory(1)
+
+		case keyCtrlR:
+			submit, err := editor.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if submit {
+				fmt.Fprint(editor.out, "\r\n")
+				return string(editor.line), nil
+			}
+
+		case keyCtrlL:
+			// clear the screen
+			fmt.Fprint(editor.out, "\x1b[H\x1b[2J")
+
+		case keyEscape:
+			if err := editor.escapeSequence(); err != nil {
+				return "", err
+			}
+
+		default:
+			if unicode.IsPrint(r) {
+				editor.insert(r)
+			}
+		}
+
+		editor.refresh()
+	}
+}
+
+// escapeSequence handles the keys sending escape sequences (arrows, Home/End, Delete)
+func (editor *LineEditor) escapeSequence() error {
+	r, _, err := editor.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		// a lone escape, or alt with another key
+		return err
+	}
+
+	// read the parameters up to the final character of the sequence
+	params := []rune{}
+	for {
+		r, _, err = editor.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		if r >= '@' && r <= '~' {
+			break
+		}
+		params = append(params, r)
+	}
+
+	switch r {
+	case 'A':
+		editor.browseHistory(-1)
+	case 'B':
+		editor.browseHistory(1)
+	case 'C':
+		editor.moveCursor(1)
+	case 'D':
+		editor.moveCursor(-1)
+	case 'H':
+		editor.cursor = 0
+	case 'F':
+		editor.cursor = len(editor.line)
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			editor.cursor = 0
+		case "4", "8":
+			editor.cursor = len(editor.line)
+		case "3":
+			editor.deleteAt(editor.cursor)
+		}
+	}
+
+	return nil
+}
+
+// refresh redraws the prompt and line, and puts the cursor back in place
+func (editor *LineEditor) refresh() {
+	fmt.Fprintf(editor.out, "\r%s%s\x1b[K", editor.prompt, string(editor.line))
+	if back := len(editor.line) - editor.cursor; back > 0 {
+		fmt.Fprintf(editor.out, "\x1b[%dD", back)
+	}
+}
+
+func (editor *LineEditor) insert(r rune) {
+	editor.line = append(editor.line[:editor.cursor], append([]rune{r}, editor.line[editor.cursor:]...)...)
+	editor.cursor++
+}
+
+func (editor *LineEditor) deleteAt(position int) {
+	if position < len(editor.line) {
+		editor.line = append(editor.line[:position], editor.line[position+1:]...)
+	}
+}
+
+func (editor *LineEditor) moveCursor(offset int) {
+	if cursor := editor.cursor + offset; cursor >= 0 && cursor <= len(editor.line) {
+		editor.cursor = cursor
+	}
+}
+
+// deleteWord deletes the word before the cursor, along with any spaces after it
+func (editor *LineEditor) deleteWord() {
+	start := editor.cursor
+	for start > 0 && unicode.IsSpace(editor.line[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(editor.line[start-1]) {
+		start--
+	}
+
+	editor.line = append(editor.line[:start], editor.line[editor.cursor:]...)
+	editor.cursor = start
+}
+
+// browseHistory replaces the line with an older (-1) or newer (1) line from the history, keeping the line being edited
+// to come back to after the newest history line
+func (editor *LineEditor) browseHistory(direction int) {
+	position := editor.position + direction
+	if position < 0 || position > len(editor.history) {
+		return
+	}
+
+	if editor.position == len(editor.history) {
+		editor.draft = editor.line
+	}
+
+	editor.position = position
+	if position == len(editor.history) {
+		editor.line = editor.draft
+	} else {
+		editor.line = []rune(editor.history[position])
+	}
+	editor.cursor = len(editor.line)
+}
+
+// reverseSearch searches the history for lines containing the characters typed, newest first (Ctrl-R). Ctrl-R again
+// finds the next older match, Enter runs the match (returning true), Ctrl-G cancels the search, and any other key takes the
+// match as the line to edit, and is then handled as usual.
+func (editor *LineEditor) reverseSearch() (bool, error) {
+	query := []rune{}
+	match := len(editor.history) // position of the matching history line
+	found := true
+
+	// find searches the history for the query, from a position back
+	find := func(from int) {
+		if len(query) <= 0 {
+			match, found = len(editor.history), true
+			return
+		}
+
+		for i := from; i >= 0; i-- {
+			if i < len(editor.history) && strings.Contains(editor.history[i], string(query)) {
+				match, found = i, true
+				return
+			}
+		}
+		found = false
+	}
+
+	for {
+		matched, status := "", "reverse-i-search"
+		if match < len(editor.history) {
+			matched = editor.history[match]
+		}
+		if !found {
+			status = "failed reverse-i-search"
+		}
+		fmt.Fprintf(editor.out, "\r(%s)`%s': %s\x1b[K", status, string(query), matched)
+
+		r, _, err := editor.in.ReadRune()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case r == keyCtrlR:
+			find(match - 1)
+
+		case r == keyBackspace || r == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(editor.history) - 1)
+			}
+
+		case r == keyCtrlG:
+			return false, nil
+
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			find(match)
+
+		default:
+			if match < len(editor.history) {
+				editor.line = []rune(editor.history[match])
+				editor.cursor = len(editor.line)
+				editor.position = match
+			}
+
+			if r == '\r' || r == '\n' {
+				return true, nil
+			}
+
+			// the key is handled as usual once the search is left
+			return false, editor.in.UnreadRune()
+		}
+	}
+}
+
+// completeWord completes the word before the cursor: to the only possible completion, or as far as all the possible
+// completions agree, listing them if they don't
+func (editor *LineEditor) completeWord() {
+	if editor.complete == nil {
+		return
+	}
+
+	before := string(editor.line[:editor.cursor])
+	start := strings.LastIndexAny(before, " \t") + 1
+	partial := before[start:]
+
+	candidates := editor.complete(strings.Fields(before[:start]), partial)
+	if len(candidates) <= 0 {
+		// ring the bell
+		fmt.Fprint(editor.out, "\a")
+		return
+	}
+
+	// a single completion is followed by a space, unless one follows already
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 && (editor.cursor >= len(editor.line) || !unicode.IsSpace(editor.line[editor.cursor])) {
+		completion += " "
+	}
+
+	if len([]rune(completion)) > len([]rune(partial)) {
+		completed := []rune(before[:start] + completion)
+		editor.line = append(completed, editor.line[editor.cursor:]...)
+		editor.cursor = len(completed)
+		return
+	}
+
+	fmt.Fprintf(editor.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+// commonPrefix returns the longest prefix shared by all the values
+func commonPrefix(values []string) string {
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		runes := []rune(value)
+		i := 0
+		for i < len(prefix) && i < len(runes) && prefix[i] == runes[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+
+	return string(prefix)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// editLine runs the line editor on the given keys, as if typed at a terminal
+func editLine(t *testing.T, history []string, complete Completer, keys string) (string, error) {
+	t.Helper()
+
+	editor := newLineEditor(strings.NewReader(keys), &bytes.Buffer{}, complete)
+	editor.history = history
+	return editor.edit("search >>")
+}
+
+func TestLineEditor(t *testing.T) {
+	history := []string{"org Name Enthaze", "user Role admin", "ticket Status pending"}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"ticket\r", "ticket"},
+		{"helo\x1b[Dl\r", "hello"},                                   // left arrow, insert
+		{"world\x01hello \r", "hello world"},                         // Ctrl-A
+		{"hello world\x17\x17there\r", "there"},                      // Ctrl-W
+		{"hello\x1b[D\x1b[D\x0b\x05p\r", "help"},                     // Ctrl-K, Ctrl-E
+		{"hello world\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x15\r", "world"}, // Ctrl-U
+		{"ab\x7f\x7fcd\x1b[H\x1b[3~\r", "d"},                         // backspace, Home, Delete
+		{"\x1b[A\r", "ticket Status pending"},                        // up arrow
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "org Name Enthaze"},           // up arrow past the oldest line
+		{"draft\x10\x10\x0e\x0e\r", "draft"},                         // Ctrl-P, Ctrl-N back to the line being edited
+		{"\x12Role\r", "user Role admin"},                            // reverse search
+		{"\x12e\x12\x12\r", "org Name Enthaze"},                      // reverse search for older matches
+		{"\x12admin\x05 x\r", "user Role admin x"},                   // reverse search, then edit the match
+		{"typed\x12nothing\x07\r", "typed"},                          // cancelled reverse search
+	}
+
+	for _, test := range tests {
+		line, err := editLine(t, history, nil, test.keys)
+		if err != nil || line != test.expected {
+			t.Errorf("TestLineEditor: keys %q: expected %q, got %q (error %v)\n", test.keys, test.expected, line, err)
+		}
+	}
+
+	if _, err := editLine(t, history, nil, "\x04"); err != io.EOF {
+		t.Errorf("TestLineEditor: expected EOF on Ctrl-D, got %v\n", err)
+	}
+	if _, err := editLine(t, history, nil, "abc\x03"); err != errInterrupted {
+		t.Errorf("TestLineEditor: expected an interrupt on Ctrl-C, got %v\n", err)
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	data := loadTestDataset(t)
+	complete := newPromptCompleter(data, &SavedQueries{Queries: map[string]string{}})
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"tic\tSta\tpen\t\r", "ticket Status pending "},
+		{"explain us\tRo\tad\t\r", "explain user Role admin "},
+		{"ticket S\t\r", "ticket S"}, // Status, Subject and Submitter: nothing to complete
+		{"tic Name\x01\x1b[C\x1b[C\x1b[C\t\r", "ticket Name"},
+	}
+
+	for _, test := range tests {
+		line, err := editLine(t, nil, complete, test.keys)
+		if err != nil || line != test.expected {
+			t.Errorf("TestLineEditorCompletion: keys %q: expected %q, got %q (error %v)\n", test.keys, test.expected, line, err)
+		}
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLineEditorHistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	historyFile := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(historyFile, []byte(strings.Repeat("org Name Enthaze\n", maxHistoryLength+5)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// input that isn't a terminal is read line by line
+	input, err := os.Open(filepath.Join("testdata", "delta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+
+	editor, err := NewLineEditor(input, ioutil.Discard, historyFile, nil)
+	if err != nil || editor.terminal != nil {
+		t.Fatalf("TestLineEditorHistory: unexpected editor state (error %v)\n", err)
+	}
+	if len(editor.history) != maxHistoryLength {
+		t.Errorf("TestLineEditorHistory: expected history trimmed to %d lines, got %d\n", maxHistoryLength, len(editor.history))
+	}
+
+	line, err := editor.ReadLine("search >>")
+	if err != nil || line != "{" {
+		t.Errorf("TestLineEditorHistory: expected the first line of the input, got %q (error %v)\n", line, err)
+	}
+
+	editor.AddHistory("ticket Status pending\n")
+	editor.AddHistory("ticket Status pending")
+	editor.AddHistory("  ")
+
+	reloaded, _ := NewLineEditor(input, ioutil.Discard, historyFile, nil)
+	if len(reloaded.history) != maxHistoryLength || reloaded.history[maxHistoryLength-1] != "ticket Status pending" || reloaded.history[maxHistoryLength-2] != "org Name Enthaze" {
+		t.Errorf("TestLineEditorHistory: history not saved: %v\n", reloaded.history[maxHistoryLength-2:])
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// -------------------- meta-commands (:help, :fields, :describe, :stats, :quit) --------------------
+
+// prefix of the commands about the app and the data, rather than searches or changes to the data
+const metaCommandPrefix = ":"
+
+// maximum number of values listed by :describe
+const maxDescribedValues = 10
+
+// commandHelp is the usage and description of a command, for :help
+type commandHelp struct {
+	Usage       string
+	Description string
+}
+
+var metaCommands = []commandHelp{
+	{":help", "show this help"},
+	{":fields <type>", "list the searchable fields of orgs, users or tickets"},
+	{":describe <type> <field>", "show how a field's values are distributed"},
+	{":stats", "show record counts, index sizes and associations"},
+	{":save <name> <query>", "save a query or command, with parameters $1, $2, ... (or $* for all the arguments)"},
+	{":run <name> [<argument> ...]", "run a saved query"},
+	{":queries", "list the saved queries"},
+	{":unsave <name>", "delete a saved query"},
+	{":quit", "exit (also :q, :exit or Ctrl-D)"},
+}
+
+var promptCommandHelp = []commandHelp{
+	{"<type>[:<flags>] <field> <value>", "search orgs, users or tickets (flags: i, c, k, a, w, x; ~value for a fuzzy match, \\~value for a value starting with ~)"},
+	{"explain <search>", "show how a search is run"},
+	{"browse <search>", "step through the results of a search, following links to orgs, users and tickets"},
+	{"export <format> <file> <search>", "write the results of a search and their associated records to a report (html, md, csv or csv-bom)"},
+	{"tui [<search>]", "open the full-screen UI: a query bar, results list and detail pane with links"},
+	{"similar ticket <id> [<n>]", "list the tickets most similar to a ticket"},
+	{"sla [<ticket search>]", "count overdue, due soon and on track tickets by org, assignee, priority and status"},
+	{"validate", "check the data for orphaned references, duplicate IDs and invalid values"},
+	{"duplicates", "list users and orgs that look like duplicates"},
+	{"merge <user|org> <id> <duplicate id> ...", "merge duplicates into a surviving record"},
+	{"domains [fill]", "report users whose org doesn't match their email domain (fill: link users with no org)"},
+	{"apply <delta file>", "apply a delta file"},
+	{"save", "save the changes made on startup (recovered from the journal or applied from delta files)"},
+	{"update <type> <id> <field> <value>", "change a field of a record"},
+	{"add tag|remove tag <type> <id> <tag>", "add or remove a tag"},
+	{"create <type> <JSON record>", "add a record"},
+	{"delete <type> <id>", "delete a record"},
+	{"bulk [preview] <operation> where <search>", "change every record matching a search"},
+	{"undo", "revert the last change"},
+	{"history", "list recent changes"},
+}
+
+// ValueCount is a value of a field and the number of records having it
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// FieldDescription summarizes the values of a field across the records of a type
+type FieldDescription struct {
+	StructName string
+	Field      string
+	FieldType  string
+	Records    int
+	Empty      int          // records without a value
+	Values     []ValueCount // distinct values, most common first
+}
+
+// isMetaCommand reports whether the input is a meta-command
+func isMetaCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), metaCommandPrefix)
+}
+
+// RunMetaCommand runs a meta-command, returning its output, and true if the app should exit
+func RunMetaCommand(data *Dataset, input string) (string, bool, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 {
+		return "", false, fmt.Errorf("Invalid command (enter %shelp for a list of commands)", metaCommandPrefix)
+	}
+
+	switch name := strings.ToLower(strings.TrimPrefix(fields[0], metaCommandPrefix)); name {
+	case "help", "h", "?":
+		return FormatHelp(), false, nil
+
+	case "fields":
+		if len(fields) != 2 {
+			return "", false, fmt.Errorf("Invalid fields format. Format: $> %sfields <type>", metaCommandPrefix)
+		}
+		output, err := FormatFields(data, fields[1])
+		return output, false, err
+
+	case "describe":
+		if len(fields) != 3 {
+			return "", false, fmt.Errorf("Invalid describe format. Format: $> %sdescribe <type> <field>", metaCommandPrefix)
+		}
+		description, err := DescribeField(data, fields[1], fields[2])
+		if err != nil {
+			return "", false, err
+		}
+		return FormatFieldDescription(description), false, nil
+
+	case "stats":
+		return FormatDatasetStats(data), false, nil
+
+	case "quit", "q", "exit":
+		return "", true, nil
+
+	default:
+		return "", false, fmt.Errorf("Unknown command: %s%s (enter %shelp for a list of commands)", metaCommandPrefix, name, metaCommandPrefix)
+	}
+}
+
+// FormatHelp lists the commands that can be entered at the prompt
+func FormatHelp() string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nCOMMANDS\n--------\n")
+
+	for _, command := range promptCommandHelp {
+		formattedResult.WriteString(fmt.Sprintf("%-44s %s\n", command.Usage, command.Description))
+	}
+
+	formattedResult.WriteString("\n")
+	for _, command := range metaCommands {
+		formattedResult.WriteString(fmt.Sprintf("%-44s %s\n", command.Usage, command.Description))
+	}
+
+	formattedResult.WriteString("\nTypes: org, user, ticket. Press Tab to complete commands, fields and values.\n")
+	return formattedResult.String()
+}
+
+// FormatFields lists the searchable fields of a record type with their types, and the custom attributes found in the data
+func FormatFields(data *Dataset, searchType string) (string, error) {
+	structName, _ := typeRecords(data, searchType)
+	if structName == "" {
+		return "", fmt.Errorf("Invalid type: %s (must be one of %s)", searchType, strings.Join(entityTypes, ", "))
+	}
+
+	fuzzy := map[string]bool{}
+	for _, field := range fuzzyFields[structName] {
+		fuzzy[field] = true
+	}
+
+	var formattedResult strings.Builder
+	heading := strings.ToUpper(strings.SplitN(searchType, ":", 2)[0]) + " FIELDS"
+	formattedResult.WriteString(fmt.Sprintf("\n%s\n%s\n", heading, strings.Repeat("-", len(heading))))
+
+	for _, field := range uniqueStrings(recordFieldNames(data, searchType)) {
+		fieldType := fieldTypeName(structName, field)
+		if fuzzy[field] {
+			fieldType += " (~ fuzzy matching)"
+		}
+		formattedResult.WriteString(fmt.Sprintf("%-24s %s\n", field, fieldType))
+	}
+	if structName == "Ticket" {
+		formattedResult.WriteString(fmt.Sprintf("%-24s %s\n", overdueField, "bool (derived from Due_at and Status)"))
+	}
+
+	return formattedResult.String(), nil
+}
+
+// fieldTypeName returns the type of a field of a record struct, or "custom attribute"
+func fieldTypeName(structName, field string) string {
+	if strings.HasPrefix(field, customFieldPrefix) {
+		return "custom attribute"
+	}
+
+	fieldType, err := GetFieldType(recordStructs[structName], field)
+	if err != nil {
+		return ""
+	}
+
+	return fieldType
+}
+
+// uniqueStrings returns values without duplicates, keeping their order
+func uniqueStrings(values []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// recordFieldValues returns the values of a record's field (or custom attribute) as strings: each element of a list field,
+// and no values if the field is empty (or a zero ID)
+func recordFieldValues(record interface{}, field string) []string {
+	values := []string{}
+
+	if strings.HasPrefix(field, customFieldPrefix) {
+		attributes := reflect.ValueOf(record).FieldByName("Custom").Interface().(CustomAttributes)
+		for _, value := range attributes.Lookup(strings.TrimPrefix(field, customFieldPrefix)) {
+			if formatted := formatAttributeValue(value); formatted != "" {
+				values = append(values, formatted)
+			}
+		}
+		return values
+	}
+
+	fieldValue := reflect.ValueOf(record).FieldByName(field)
+	switch fieldValue.Kind() {
+	case reflect.Slice:
+		for _, item := range fieldValue.Interface().([]string) {
+			if item != "" {
+				values = append(values, item)
+			}
+		}
+	case reflect.String:
+		if fieldValue.String() != "" {
+			values = append(values, fieldValue.String())
+		}
+	case reflect.Int:
+		// as in the data files, a zero ID means no value
+		if fieldValue.Int() != 0 {
+			values = append(values, fmt.Sprintf("%d", fieldValue.Int()))
+		}
+	default:
+		values = append(values, fmt.Sprintf("%v", fieldValue.Interface()))
+	}
+
+	return values
+}
+
+// DescribeField counts the distinct values of a field across the records of a type. Each element of a list field (e.g. Tags)
+// is counted separately.
+func DescribeField(data *Dataset, searchType, field string) (FieldDescription, error) {
+	structName, records := typeRecords(data, searchType)
+	if structName == "" {
+		return FieldDescription{}, fmt.Errorf("Invalid type: %s (must be one of %s)", searchType, strings.Join(entityTypes, ", "))
+	}
+
+	// only data fields and custom attributes can be described, not the associated records filled in for search results
+	description := FieldDescription{StructName: structName, Field: field, FieldType: fieldTypeName(structName, field), Records: len(records)}
+	known := strings.HasPrefix(field, customFieldPrefix)
+	for _, name := range recordFieldNames(data, searchType) {
+		known = known || name == field
+	}
+	if !known {
+		return description, fmt.Errorf("No such field: %s.%s (enter %sfields %s for a list of fields)", structName, field, metaCommandPrefix, searchType)
+	}
+
+	counts := map[string]int{}
+	for _, record := range records {
+		values := recordFieldValues(record, field)
+		if len(values) <= 0 {
+			description.Empty++
+		}
+		for _, value := range values {
+			counts[value]++
+		}
+	}
+
+	for value, count := range counts {
+		description.Values = append(description.Values, ValueCount{Value: value, Count: count})
+	}
+	sort.Slice(description.Values, func(i, j int) bool {
+		if description.Values[i].Count != description.Values[j].Count {
+			return description.Values[i].Count > description.Values[j].Count
+		}
+		return description.Values[i].Value < description.Values[j].Value
+	})
+
+	return description, nil
+}
+
+// FormatFieldDescription outputs the distribution of a field's values: the most common values (up to maxDescribedValues)
+// with their counts and share of the records
+func FormatFieldDescription(description FieldDescription) string {
+	var formattedResult strings.Builder
+	heading := fmt.Sprintf("%s.%s (%s)", description.StructName, description.Field, description.FieldType)
+	formattedResult.WriteString(fmt.Sprintf("\n%s\n%s\n", heading, strings.Repeat("-", len(heading))))
+	formattedResult.WriteString(fmt.Sprintf("%d record(s), %d distinct value(s), %d empty\n\n", description.Records, len(description.Values), description.Empty))
+
+	for i, value := range description.Values {
+		if i >= maxDescribedValues {
+			formattedResult.WriteString(fmt.Sprintf("... and %d more value(s)\n", len(description.Values)-maxDescribedValues))
+			break
+		}
+
+		share := 0.0
+		if description.Records > 0 {
+			share = 100 * float64(value.Count) / float64(description.Records)
+		}
+		formattedResult.WriteString(fmt.Sprintf("%-40s %5d %6.1f%%\n", fmt.Sprintf("%q", value.Value), value.Count, share))
+	}
+
+	if description.Empty > 0 && description.Records > 0 {
+		formattedResult.WriteString(fmt.Sprintf("%-40s %5d %6.1f%%\n", "<empty>", description.Empty, 100*float64(description.Empty)/float64(description.Records)))
+	}
+
+	return formattedResult.String()
+}
+
+// FormatDatasetStats outputs the number of records of each type, the size of each index, and how many associated records
+// orgs and users have
+func FormatDatasetStats(data *Dataset) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nSTATS\n-----\n")
+	formattedResult.WriteString(fmt.Sprintf("Records: %d org(s), %d user(s), %d ticket(s)\n", len(data.OrgList), len(data.UserList), len(data.TicketList)))
+
+	formattedResult.WriteString("\nIndexes:\n")
+	indexes := []struct {
+		name    string
+		entries int
+		unit    string
+	}{
+		{"OrgIndex", len(data.OrgIndex), "org(s)"},
+		{"UserIndex", len(data.UserIndex), "user(s)"},
+		{"OrgUserIndex", len(data.OrgUserIndex), "org ID(s) with users"},
+		{"OrgTicketIndex", len(data.OrgTicketIndex), "org ID(s) with tickets"},
+		{"OrgDomainIndex", len(data.OrgDomainIndex), "domain(s)"},
+		{"UserSubmittedTixIndex", len(data.UserSubmittedTixIndex), "user ID(s) with submitted tickets"},
+		{"UserAssignedTixIndex", len(data.UserAssignedTixIndex), "user ID(s) with assigned tickets"},
+	}
+	for _, index := range indexes {
+		formattedResult.WriteString(fmt.Sprintf("  %-24s %6d %s\n", index.name, index.entries, index.unit))
+	}
+
+	names := []string{}
+	for name := range data.fuzzyIndexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := data.fuzzyIndexes[name]
+		formattedResult.WriteString(fmt.Sprintf("  %-24s %6d value(s), %d trigram(s)\n", "~"+name, len(index.values), len(index.postings)))
+	}
+
+	formattedResult.WriteString("\nAssociations:\n")
+	associations := []struct {
+		name   string
+		counts []int
+	}{
+		{"users per org", nil},
+		{"tickets per org", nil},
+		{"tickets submitted per user", nil},
+		{"tickets assigned per user", nil},
+	}
+	for _, org := range data.OrgList {
+		associations[0].counts = append(associations[0].counts, len(data.OrgUserIndex[org.ID]))
+		associations[1].counts = append(associations[1].counts, len(data.OrgTicketIndex[org.ID]))
+	}
+	for _, user := range data.UserList {
+		associations[2].counts = append(associations[2].counts, len(data.UserSubmittedTixIndex[user.ID]))
+		associations[3].counts = append(associations[3].counts, len(data.UserAssignedTixIndex[user.ID]))
+	}
+	for _, association := range associations {
+		total, max := 0, 0
+		for _, count := range association.counts {
+			total += count
+			if count > max {
+				max = count
+			}
+		}
+
+		average := 0.0
+		if len(association.counts) > 0 {
+			average = float64(total) / float64(len(association.counts))
+		}
+		formattedResult.WriteString(fmt.Sprintf("  %-28s average %.1f, max %d\n", association.name, average, max))
+	}
+
+	return formattedResult.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunMetaCommand(t *testing.T) {
+	data := loadTestDataset(t)
+
+	if !isMetaCommand(":help") || isMetaCommand("ticket Status pending") {
+		t.Errorf("TestRunMetaCommand: meta-commands not recognized correctly\n")
+	}
+
+	for _, input := range []string{":quit", ":q", ":exit"} {
+		if _, quit, err := RunMetaCommand(data, input); !quit || err != nil {
+			t.Errorf("TestRunMetaCommand: %s should quit (error %v)\n", input, err)
+		}
+	}
+
+	if output, _, err := RunMetaCommand(data, ":help"); err != nil || !strings.Contains(output, ":describe <type> <field>") {
+		t.Errorf("TestRunMetaCommand: unexpected help (error %v): %s\n", err, output)
+	}
+
+	for _, input := range []string{":foo", ":fields", ":fields thing", ":describe ticket", ":describe ticket Nope", ":describe ticket AssociatedUsers"} {
+		if _, quit, err := RunMetaCommand(data, input); quit || err == nil {
+			t.Errorf("TestRunMetaCommand: expected an error for %q\n", input)
+		}
+	}
+
+	output, _, err := RunMetaCommand(data, ":fields org")
+	if err != nil || !strings.Contains(output, "DomainNames") || !strings.Contains(output, "Name") {
+		t.Errorf("TestRunMetaCommand: unexpected org fields (error %v): %s\n", err, output)
+	}
+
+	output, _, err = RunMetaCommand(data, ":stats")
+	if err != nil || !strings.Contains(output, "25 org(s), 75 user(s), 200 ticket(s)") {
+		t.Errorf("TestRunMetaCommand: unexpected stats (error %v): %s\n", err, output)
+	}
+}
+
+func TestDescribeField(t *testing.T) {
+	data := loadTestDataset(t)
+
+	description, err := DescribeField(data, "ticket", "Status")
+	if err != nil {
+		t.Fatalf("TestDescribeField: unexpected error: %v\n", err)
+	}
+
+	if description.Records != len(data.TicketList) || description.Empty != 0 || len(description.Values) != 5 {
+		t.Errorf("TestDescribeField: unexpected description: %+v\n", description)
+	}
+	if top := description.Values[0]; top.Value != "pending" || top.Count != 45 {
+		t.Errorf("TestDescribeField: expected 45 pending tickets first, got %+v\n", top)
+	}
+
+	total := 0
+	for _, value := range description.Values {
+		total += value.Count
+	}
+	if total != len(data.TicketList) {
+		t.Errorf("TestDescribeField: value counts add up to %d, expected %d\n", total, len(data.TicketList))
+	}
+
+	// tickets without an assignee are counted as empty
+	description, err = DescribeField(data, "ticket", "Assignee")
+	if err != nil || description.Empty != 4 {
+		t.Errorf("TestDescribeField: expected 4 unassigned tickets, got %d (error %v)\n", description.Empty, err)
+	}
+
+	// each tag of a user is counted
+	description, err = DescribeField(data, "user", "Tags")
+	if err != nil || len(description.Values) != 300 {
+		t.Errorf("TestDescribeField: expected 300 distinct user tags, got %d (error %v)\n", len(description.Values), err)
+	}
+	if output := FormatFieldDescription(description); !strings.Contains(output, "... and 290 more value(s)") {
+		t.Errorf("TestDescribeField: unexpected formatting: %s\n", output)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// -------------------- creating, updating and deleting records --------------------
+
+// record types as named in search and write commands
+var entityTypes = []string{"org", "user", "ticket"}
+
+// GetRecord returns the org, user or ticket with the given ID (as an Organization, User or Ticket value)
+func (data *Dataset) GetRecord(entityType, id string) (interface{}, error) {
+	switch entityType {
+	case "org", "user":
+		intID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s ID: %s", entityType, id)
+		}
+
+		if entityType == "org" {
+			if org, found := data.GetOrg(intID); found {
+				return org, nil
+			}
+		} else if user, found := data.GetUser(intID); found {
+			return user, nil
+		}
+
+	case "ticket":
+		if ticket, found := data.GetTicket(id); found {
+			return ticket, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid record type: %s (must be one of %s)", entityType, strings.Join(entityTypes, ", "))
+	}
+
+	return nil, fmt.Errorf("No %s found with ID %s", entityType, id)
+}
+
+// PutRecord adds or replaces an org, user or ticket, returning true if an existing record was replaced
+func (data *Dataset) PutRecord(record interface{}) bool {
+	switch r := record.(type) {
+	case Organization:
+		return data.UpsertOrg(r)
+	case User:
+		return data.UpsertUser(r)
+	case Ticket:
+		return data.UpsertTicket(r)
+	}
+
+	return false
+}
+
+// DeleteRecord removes the org, user or ticket with the given ID
+func (data *Dataset) DeleteRecord(entityType, id string) error {
+	_, err := data.GetRecord(entityType, id)
+	if err != nil {
+		return err
+	}
+
+	switch entityType {
+	case "org":
+		intID, _ := strconv.Atoi(id)
+		data.DeleteOrgs(intID)
+	case "user":
+		intID, _ := strconv.Atoi(id)
+		data.DeleteUsers(intID)
+	case "ticket":
+		data.DeleteTickets(id)
+	}
+
+	return nil
+}
+
+// recordType returns the record type name (org/user/ticket) and ID of a record
+func recordType(record interface{}) (string, string) {
+	switch r := record.(type) {
+	case Organization:
+		return "org", strconv.Itoa(r.ID)
+	case User:
+		return "user", strconv.Itoa(r.ID)
+	case Ticket:
+		return "ticket", r.ID
+	}
+
+	return "", ""
+}
+
+// recordStructName returns the struct name of a record, as used in field names such as Ticket.Status
+func recordStructName(record interface{}) string {
+	return reflect.TypeOf(record).Name()
+}
+
+// SetRecordField returns a copy of a record with a field set to a value given as a string. The value is converted to the type
+// of the field, and must be an accepted value for enum-like fields and reference an existing record for Org/Submitter/Assignee.
+// Lists are given as comma-separated values, and custom attributes (custom.<name>) are set as strings.
+func SetRecordField(data *Dataset, record interface{}, field, value string) (interface{}, error) {
+	recordValue := reflect.New(reflect.TypeOf(record)).Elem()
+	recordValue.Set(reflect.ValueOf(record))
+	structName := recordStructName(record)
+
+	if strings.HasPrefix(field, customFieldPrefix) {
+		name := strings.TrimPrefix(field, customFieldPrefix)
+		if name == "" || strings.Contains(name, ".") {
+			return nil, fmt.Errorf("Only top-level custom attributes can be set (custom.<name>), not %s", field)
+		}
+
+		// copy the attributes, so the original record is left unchanged
+		custom := CustomAttributes{}
+		for k, v := range recordValue.FieldByName("Custom").Interface().(CustomAttributes) {
+			custom[k] = v
+		}
+		if value == "" {
+			delete(custom, name)
+		} else {
+			custom[name] = value
+		}
+		if len(custom) <= 0 {
+			custom = nil
+		}
+
+		recordValue.FieldByName("Custom").Set(reflect.ValueOf(custom))
+		return recordValue.Interface(), nil
+	}
+
+	structField, found := recordValue.Type().FieldByName(field)
+	if !found || structField.Tag.Get("json") == "" || structField.Tag.Get("json") == "-" {
+		return nil, fmt.Errorf("No such field: %s.%s", structName, field)
+	}
+
+	if field == "ID" {
+		return nil, fmt.Errorf("%s.ID cannot be changed", structName)
+	}
+
+	fieldValue := recordValue.FieldByName(field)
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(value)
+
+	case reflect.Int:
+		intValue := 0
+		if value != "" {
+			var err error
+			intValue, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value for %s.%s: %s is an int field and value (%s) must be a number", structName, field, fieldValue.Type(), value)
+			}
+		}
+		fieldValue.SetInt(int64(intValue))
+
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "true":
+			fieldValue.SetBool(true)
+		case "false":
+			fieldValue.SetBool(false)
+		default:
+			return nil, fmt.Errorf("Invalid value for boolean field: %s.%s is a %s field and value (%s) must be boolean (true/false)", structName, field, fieldValue.Type(), value)
+		}
+
+	case reflect.Slice:
+		values := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if strings.TrimSpace(v) != "" {
+				values = append(values, strings.TrimSpace(v))
+			}
+		}
+		fieldValue.Set(reflect.ValueOf(values))
+
+	default:
+		return nil, fmt.Errorf("%s.%s cannot be set", structName, field)
+	}
+
+	updated := recordValue.Interface()
+	err := checkRecordField(data, updated, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// AddRecordTag returns a copy of a record with a tag added (if not already present)
+func AddRecordTag(record interface{}, tag string) (interface{}, error) {
+	tags, err := recordTags(record)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tags {
+		if t == tag {
+			return record, nil
+		}
+	}
+
+	return withRecordTags(record, append(append([]string{}, tags...), tag)), nil
+}
+
+// RemoveRecordTag returns a copy of a record with a tag removed, or an error if the record doesn't have the tag
+func RemoveRecordTag(record interface{}, tag string) (interface{}, error) {
+	tags, err := recordTags(record)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := []string{}
+	for _, t := range tags {
+		if t != tag {
+			remaining = append(remaining, t)
+		}
+	}
+
+	if len(remaining) == len(tags) {
+		recordTypeName, id := recordType(record)
+		return nil, fmt.Errorf("%s %s has no tag %q", recordTypeName, id, tag)
+	}
+
+	return withRecordTags(record, remaining), nil
+}
+
+func recordTags(record interface{}) ([]string, error) {
+	tags := reflect.ValueOf(record).FieldByName("Tags")
+	if !tags.IsValid() {
+		return nil, fmt.Errorf("%s records have no tags", recordStructName(record))
+	}
+
+	return tags.Interface().([]string), nil
+}
+
+func withRecordTags(record interface{}, tags []string) interface{} {
+	recordValue := reflect.New(reflect.TypeOf(record)).Elem()
+	recordValue.Set(reflect.ValueOf(record))
+	recordValue.FieldByName("Tags").Set(reflect.ValueOf(tags))
+
+	return recordValue.Interface()
+}
+
+// CreateRecord decodes a new org, user or ticket from JSON (in the data file format), checking that its ID is set and unused,
+// its enum-like fields hold accepted values and its references are to existing records
+func CreateRecord(data *Dataset, entityType string, recordJSON string) (interface{}, error) {
+	var record interface{}
+	var id string
+	var err error
+
+	switch entityType {
+	case "org":
+		org := Organization{}
+		err = json.Unmarshal([]byte(recordJSON), &org)
+		record, id = org, strconv.Itoa(org.ID)
+	case "user":
+		user := User{}
+		err = json.Unmarshal([]byte(recordJSON), &user)
+		record, id = user, strconv.Itoa(user.ID)
+	case "ticket":
+		ticket := Ticket{}
+		err = json.Unmarshal([]byte(recordJSON), &ticket)
+		record, id = ticket, ticket.ID
+	default:
+		return nil, fmt.Errorf("Invalid record type: %s (must be one of %s)", entityType, strings.Join(entityTypes, ", "))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s record: %v", entityType, err)
+	}
+
+	if id == "" || id == "0" {
+		return nil, fmt.Errorf("New %s record must have an _id", entityType)
+	}
+
+	if _, err := data.GetRecord(entityType, id); err == nil {
+		return nil, fmt.Errorf("A %s with ID %s already exists", entityType, id)
+	}
+
+	for _, field := range []string{"Status", "Priority", "Type", "Via", "Role", "Org", "Submitter", "Assignee"} {
+		err = checkRecordField(data, record, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+// checkRecordField checks that an enum-like field holds an accepted value, and that a reference field refers to an existing
+// record (empty values are allowed for both)
+func checkRecordField(data *Dataset, record interface{}, field string) error {
+	fieldValue := reflect.ValueOf(record).FieldByName(field)
+	if !fieldValue.IsValid() || fieldValue.IsZero() {
+		return nil
+	}
+
+	fieldName := recordStructName(record) + "." + field
+	if validValues, isEnum := enumFieldValues[fieldName]; isEnum {
+		for _, v := range validValues {
+			if fieldValue.String() == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("Invalid value for %s: %q must be one of: %s", fieldName, fieldValue.String(), strings.Join(validValues, ", "))
+	}
+
+	switch fieldName {
+	case "User.Org", "Ticket.Org":
+		if _, found := data.GetOrg(int(fieldValue.Int())); !found {
+			return fmt.Errorf("Invalid value for %s: no org found with ID %d", fieldName, fieldValue.Int())
+		}
+	case "Ticket.Submitter", "Ticket.Assignee":
+		if _, found := data.GetUser(int(fieldValue.Int())); !found {
+			return fmt.Errorf("Invalid value for %s: no user found with ID %d", fieldName, fieldValue.Int())
+		}
+	}
+
+	return nil
+}
+
+// ---------------------- write command input ----------------------------
+
+// WriteCommand is a parsed record creation/modification command entered at the prompt:
+//
+//	update <type> <id> <field> <value>
+//	add tag <type> <id> <tag>
+//	remove tag <type> <id> <tag>
+//	delete <type> <id>
+//	create <type> <JSON record>
+type WriteCommand struct {
+	Action     string // update, add-tag, remove-tag, delete or create
+	EntityType string
+	ID         string
+	Field      string
+	Value      string // new field value, tag, or JSON record
+}
+
+// parseWriteCommand parses a write command, returning false if the input isn't a write command
+func parseWriteCommand(input string) (WriteCommand, bool, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 {
+		return WriteCommand{}, false, nil
+	}
+
+	command := WriteCommand{}
+	switch strings.ToLower(fields[0]) {
+	case "update":
+		words, value := splitWords(input, 4)
+		if len(words) < 4 {
+			return command, true, errors.New("Invalid update format. Format: $> update <type> <id> <field> <value>")
+		}
+		command = WriteCommand{Action: "update", EntityType: words[1], ID: words[2], Field: words[3], Value: value}
+
+	case "add", "remove":
+		words, tag := splitWords(input, 4)
+		if len(words) < 4 || strings.ToLower(words[1]) != "tag" || tag == "" {
+			return command, true, fmt.Errorf("Invalid %s tag format. Format: $> %s tag <type> <id> <tag>", fields[0], fields[0])
+		}
+		command = WriteCommand{Action: strings.ToLower(fields[0]) + "-tag", EntityType: words[2], ID: words[3], Value: tag}
+
+	case "delete":
+		if len(fields) != 3 {
+			return command, true, errors.New("Invalid delete format. Format: $> delete <type> <id>")
+		}
+		command = WriteCommand{Action: "delete", EntityType: fields[1], ID: fields[2]}
+
+	case "create":
+		words, recordJSON := splitWords(input, 2)
+		if len(words) < 2 || recordJSON == "" {
+			return command, true, errors.New("Invalid create format. Format: $> create <type> <JSON record>")
+		}
+		command = WriteCommand{Action: "create", EntityType: words[1], Value: recordJSON}
+
+	default:
+		return command, false, nil
+	}
+
+	command.EntityType = strings.ToLower(command.EntityType)
+	return command, true, nil
+}
+
+// splitWords splits off the first n whitespace-separated words of the input, returning them along with the rest of the input
+// (which can contain spaces) as is
+func splitWords(input string, n int) ([]string, string) {
+	rest := strings.TrimSpace(input)
+	words := []string{}
+	for i := 0; i < n && rest != ""; i++ {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		words = append(words, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	return words, rest
+}
+
+// RunWriteCommand applies a write command to the dataset, returning a description of the change made
+func RunWriteCommand(data *Dataset, command WriteCommand) (string, error) {
+	if command.Action == "create" {
+		record, err := CreateRecord(data, command.EntityType, command.Value)
+		if err != nil {
+			return "", err
+		}
+
+		data.PutRecord(record)
+		_, id := recordType(record)
+		return fmt.Sprintf("Created %s %s", command.EntityType, id), nil
+	}
+
+	record, err := data.GetRecord(command.EntityType, command.ID)
+	if err != nil {
+		return "", err
+	}
+
+	var updated interface{}
+	var description string
+
+	switch command.Action {
+	case "delete":
+		err = data.DeleteRecord(command.EntityType, command.ID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Deleted %s %s", command.EntityType, command.ID), nil
+
+	case "update":
+		updated, err = SetRecordField(data, record, command.Field, command.Value)
+		description = fmt.Sprintf("Updated %s %s: %s %q -> %q", command.EntityType, command.ID, command.Field, recordFieldString(record, command.Field), command.Value)
+
+	case "add-tag":
+		updated, err = AddRecordTag(record, command.Value)
+		description = fmt.Sprintf("Added tag %q to %s %s", command.Value, command.EntityType, command.ID)
+
+	case "remove-tag":
+		updated, err = RemoveRecordTag(record, command.Value)
+		description = fmt.Sprintf("Removed tag %q from %s %s", command.Value, command.EntityType, command.ID)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	data.PutRecord(updated)
+	return description, nil
+}
+
+// recordFieldString returns a record's field value (or custom attribute) as a string, for describing changes
+func recordFieldString(record interface{}, field string) string {
+	recordValue := reflect.ValueOf(record)
+
+	if strings.HasPrefix(field, customFieldPrefix) {
+		values := recordValue.FieldByName("Custom").Interface().(CustomAttributes).Lookup(strings.TrimPrefix(field, customFieldPrefix))
+		if len(values) <= 0 {
+			return ""
+		}
+		return formatAttributeValue(values[0])
+	}
+
+	fieldValue := recordValue.FieldByName(field)
+	if !fieldValue.IsValid() {
+		return ""
+	}
+
+	if fieldValue.Kind() == reflect.Slice {
+		return strings.Join(fieldValue.Interface().([]string), ", ")
+	}
+	if fieldValue.Kind() == reflect.Int && fieldValue.Int() == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", fieldValue.Interface())
+}
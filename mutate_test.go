@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWriteCommand(t *testing.T) {
+	inputs := map[string]WriteCommand{
+		"update ticket 1a227508-9f39-427c-8f57-1b72f3fab87c Status solved\n": {Action: "update", EntityType: "ticket", ID: "1a227508-9f39-427c-8f57-1b72f3fab87c", Field: "Status", Value: "solved"},
+		"update user 1 Signature Don't Worry Be Happy!\n":                    {Action: "update", EntityType: "user", ID: "1", Field: "Signature", Value: "Don't Worry Be Happy!"},
+		"add tag org 101 New South Wales\n":                                  {Action: "add-tag", EntityType: "org", ID: "101", Value: "New South Wales"},
+		"remove tag user 1 Sutton\n":                                         {Action: "remove-tag", EntityType: "user", ID: "1", Value: "Sutton"},
+		"delete user 1\n":                                                    {Action: "delete", EntityType: "user", ID: "1"},
+		`create org {"_id": 126, "name": "Initech"}` + "\n":                  {Action: "create", EntityType: "org", Value: `{"_id": 126, "name": "Initech"}`},
+	}
+
+	for input, expected := range inputs {
+		command, isWriteCommand, err := parseWriteCommand(input)
+		if !isWriteCommand || err != nil || command != expected {
+			t.Errorf("TestParseWriteCommand: %q parsed as %+v (write command %v, error %v)\n", input, command, isWriteCommand, err)
+		}
+	}
+
+	if _, isWriteCommand, _ := parseWriteCommand("user Name Francisca Rasmussen\n"); isWriteCommand {
+		t.Error("TestParseWriteCommand: search parsed as a write command.\n")
+	}
+
+	if _, isWriteCommand, err := parseWriteCommand("delete user\n"); !isWriteCommand || err == nil {
+		t.Error("TestParseWriteCommand: incomplete write command not reported as an error.\n")
+	}
+}
+
+func TestRunWriteCommand(t *testing.T) {
+	data := loadTestDataset(t)
+	data.TakeChanges()
+
+	ticketID := "1a227508-9f39-427c-8f57-1b72f3fab87c"
+	commands := []WriteCommand{
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Status", Value: "solved"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Assignee", Value: "49"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Has_incidents", Value: "true"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "custom.region", Value: "APAC"},
+		{Action: "add-tag", EntityType: "ticket", ID: ticketID, Value: "New South Wales"},
+		{Action: "remove-tag", EntityType: "ticket", ID: ticketID, Value: "Idaho"},
+	}
+
+	for _, command := range commands {
+		_, err := RunWriteCommand(data, command)
+		if err != nil {
+			t.Errorf("TestRunWriteCommand: error running %+v - %v\n", command, err)
+		}
+	}
+
+	ticket, _ := data.GetTicket(ticketID)
+	if ticket.Status != "solved" || ticket.Assignee != 49 || !ticket.Has_incidents || ticket.Custom["region"] != "APAC" || !reflect.DeepEqual(ticket.Tags, []string{"Puerto Rico", "Oklahoma", "Louisiana", "New South Wales"}) {
+		t.Errorf("TestRunWriteCommand: ticket not updated correctly: %+v\n", ticket)
+	}
+
+	// the ticket should now be listed under its new assignee
+	assigned := data.UserAssignedTixIndex[49]
+	if len(assigned) != 3 || len(data.UserAssignedTixIndex[38]) != 0 {
+		t.Errorf("TestRunWriteCommand: assigned ticket index not updated: %d tickets for new assignee\n", len(assigned))
+	}
+
+	invalidCommands := []WriteCommand{
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Status", Value: "done"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Assignee", Value: "999"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "Has_incidents", Value: "maybe"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "ID", Value: "x"},
+		{Action: "update", EntityType: "ticket", ID: ticketID, Field: "SubmitterObj", Value: "x"},
+		{Action: "update", EntityType: "user", ID: "1", Field: "Org", Value: "abc"},
+		{Action: "remove-tag", EntityType: "ticket", ID: ticketID, Value: "Idaho"},
+		{Action: "delete", EntityType: "user", ID: "999"},
+		{Action: "create", EntityType: "org", Value: `{"_id": 101, "name": "Duplicate"}`},
+		{Action: "create", EntityType: "ticket", Value: `{"_id": "t-new", "status": "done"}`},
+	}
+
+	for _, command := range invalidCommands {
+		_, err := RunWriteCommand(data, command)
+		if err == nil {
+			t.Errorf("TestRunWriteCommand: invalid command not rejected: %+v\n", command)
+		}
+	}
+
+	_, err := RunWriteCommand(data, WriteCommand{Action: "create", EntityType: "ticket", Value: `{"_id": "t-new", "status": "new", "submitter_id": 1, "tags": ["Ohio"]}`})
+	if err == nil {
+		_, err = RunWriteCommand(data, WriteCommand{Action: "delete", EntityType: "user", ID: "1"})
+	}
+	if err != nil {
+		t.Fatalf("TestRunWriteCommand: error creating ticket/deleting user - %v\n", err)
+	}
+
+	if _, found := data.GetTicket("t-new"); !found || len(data.TicketList) != 201 || len(data.UserList) != 74 {
+		t.Error("TestRunWriteCommand: record not created/deleted.\n")
+	}
+
+	changes := data.TakeChanges()
+	if len(changes.Tickets) != 2 || len(changes.Users) != 1 || len(changes.Orgs) != 0 {
+		t.Errorf("TestRunWriteCommand: incorrect changes tracked: %+v\n", changes)
+	}
+
+	checkIndexesMatchRebuild(t, "TestRunWriteCommand", data)
+}
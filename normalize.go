@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// -------------------- matching options (case folding, Unicode normalization) --------------------
+
+// MatchOptions control how string values are compared when searching. The zero value compares strings byte-for-byte.
+// Options are applied in order: Unicode normalization, accent stripping, case folding, whitespace collapsing.
+type MatchOptions struct {
+	FoldCase           bool   `json:"FoldCase"`           // ignore differences in case
+	Normalization      string `json:"Normalization"`      // Unicode normalization form: "" (none), "NFC" or "NFKD"
+	StripAccents       bool   `json:"StripAccents"`       // remove accents and other combining marks, e.g. "é" matches "e"
+	CollapseWhitespace bool   `json:"CollapseWhitespace"` // trim whitespace and treat runs of whitespace as a single space
+}
+
+// flags selecting matching options for a single search, given after the search type (e.g. `org:ia Name enthaze`)
+const (
+	matchFlagFoldCase      = 'i'
+	matchFlagNFC           = 'c'
+	matchFlagNFKD          = 'k'
+	matchFlagStripAccents  = 'a'
+	matchFlagCollapseSpace = 'w'
+	matchFlagExact         = 'x' // no options, i.e. byte-for-byte comparison
+)
+
+// options used for values that are always compared loosely (fuzzy matching, duplicate detection)
+var looseMatchOptions = MatchOptions{FoldCase: true, Normalization: "NFKD", StripAccents: true, CollapseWhitespace: true}
+
+// Validate checks that the normalization form is supported
+func (opts MatchOptions) Validate() error {
+	switch strings.ToUpper(opts.Normalization) {
+	case "", "NFC", "NFKD":
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported Unicode normalization form: %s (must be NFC or NFKD)", opts.Normalization)
+}
+
+// Normalize applies the matching options to a string
+func (opts MatchOptions) Normalize(s string) string {
+	switch strings.ToUpper(opts.Normalization) {
+	case "NFC":
+		s = NormalizeNFC(s)
+	case "NFKD":
+		s = NormalizeNFKD(s)
+	}
+
+	if opts.StripAccents {
+		s = stripAccents(s)
+	}
+
+	if opts.FoldCase {
+		s = strings.Map(foldRune, s)
+	}
+
+	if opts.CollapseWhitespace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+
+	return s
+}
+
+// Equal reports whether two strings match under the matching options
+func (opts MatchOptions) Equal(a, b string) bool {
+	if opts == (MatchOptions{}) {
+		return a == b
+	}
+
+	return opts.Normalize(a) == opts.Normalize(b)
+}
+
+// String describes the matching options, e.g. "ignore case, strip accents" (or "exact" for byte-for-byte comparison)
+func (opts MatchOptions) String() string {
+	options := []string{}
+	if opts.FoldCase {
+		options = append(options, "ignore case")
+	}
+	if opts.Normalization != "" {
+		options = append(options, strings.ToUpper(opts.Normalization))
+	}
+	if opts.StripAccents {
+		options = append(options, "strip accents")
+	}
+	if opts.CollapseWhitespace {
+		options = append(options, "collapse whitespace")
+	}
+
+	if len(options) <= 0 {
+		return "exact"
+	}
+
+	return strings.Join(options, ", ")
+}
+
+// parseMatchFlags converts per-search flags into matching options
+func parseMatchFlags(flags string) (MatchOptions, error) {
+	opts := MatchOptions{}
+
+	for _, flag := range flags {
+		switch flag {
+		case matchFlagFoldCase:
+			opts.FoldCase = true
+		case matchFlagNFC:
+			opts.Normalization = "NFC"
+		case matchFlagNFKD:
+			opts.Normalization = "NFKD"
+		case matchFlagStripAccents:
+			opts.StripAccents = true
+		case matchFlagCollapseSpace:
+			opts.CollapseWhitespace = true
+		case matchFlagExact:
+			opts = MatchOptions{}
+		default:
+			return opts, fmt.Errorf("Invalid match flag: %c (flags: i = ignore case, c = NFC, k = NFKD, a = strip accents, w = collapse whitespace, x = exact)", flag)
+		}
+	}
+
+	return opts, nil
+}
+
+// resolveSearchType splits the matching flags off a search type (e.g. "org:ia"), returning the search type and the matching
+// options to use: those given by the flags, or the default options if there are none
+func resolveSearchType(searchType string, defaults MatchOptions) (string, MatchOptions, error) {
+	colon := strings.Index(searchType, ":")
+	if colon < 0 {
+		return searchType, defaults, nil
+	}
+
+	opts, err := parseMatchFlags(searchType[colon+1:])
+	return searchType[:colon], opts, err
+}
+
+// foldRune maps all case variants of a character (e.g. "K", "k" and the Kelvin sign, or the Greek sigmas) to a single
+// lower-case character
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < folded {
+			folded = f
+		}
+	}
+
+	return unicode.ToLower(folded)
+}
+
+// stripAccents removes combining marks, after decomposing accented characters into base characters and marks
+func stripAccents(s string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn))), s)
+	if err != nil {
+		return s
+	}
+
+	return stripped
+}
+
+// NormalizeNFC returns the canonical composition of a string (e.g. "e" followed by a combining acute accent becomes "é")
+func NormalizeNFC(s string) string {
+	return norm.NFC.String(s)
+}
+
+// NormalizeNFKD returns the compatibility decomposition of a string (e.g. full-width "Ａ" becomes "A", and "é" becomes "e"
+// followed by a combining acute accent)
+func NormalizeNFKD(s string) string {
+	return norm.NFKD.String(s)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalization(t *testing.T) {
+	cases := []struct {
+		input    string
+		nfc      string
+		nfkd     string
+		stripped string
+	}{
+		{"é", "é", "é", "e"},
+		{"é", "é", "é", "e"},
+		{"Ｅｎｔｈａｚｅ", "Ｅｎｔｈａｚｅ", "Enthaze", "Ｅｎｔｈａｚｅ"},
+		{"ộ", "ộ", "ộ", "o"}, // marks in canonical order compose in turn
+		{"ộ", "ộ", "ộ", "o"}, // marks are reordered before composing
+		{"ἄ", "ἄ", "ἄ", "α"},
+		{"ﬁle ½", "ﬁle ½", "file 1⁄2", "ﬁle ½"},
+		{"ẛ̣", "ẛ̣", "ṩ", "ſ"},   // long s with dot above and below
+		{"각", "각", "각", "각"},   // Hangul syllables are decomposed into jamo
+		{"각", "각", "각", "각"}, // and jamo composed into syllables
+		{"क़", "क़", "क़", "क"},     // composition exclusions aren't composed
+		{"①", "①", "1", "①"},
+	}
+
+	for _, c := range cases {
+		if nfc := NormalizeNFC(c.input); nfc != c.nfc {
+			t.Errorf("TestNormalization: NFC of %q is %q, expected %q\n", c.input, nfc, c.nfc)
+		}
+		if nfkd := NormalizeNFKD(c.input); nfkd != c.nfkd {
+			t.Errorf("TestNormalization: NFKD of %q is %q, expected %q\n", c.input, nfkd, c.nfkd)
+		}
+		if stripped := stripAccents(c.input); stripped != c.stripped {
+			t.Errorf("TestNormalization: %q with accents stripped is %q, expected %q\n", c.input, stripped, c.stripped)
+		}
+	}
+}
+
+func TestMatchOptions(t *testing.T) {
+	matches := []struct {
+		flags string
+		a, b  string
+	}{
+		{"i", "ENTHAZE", "enthaze"},
+		{"i", "K", "k"}, // Kelvin sign
+		{"i", "ΟΔΥΣΣΕΥΣ", "οδυσσευς"},
+		{"c", "Maé Bowman", "Maé Bowman"},
+		{"ka", "Ｍａé", "Mae"},
+		{"a", "Strezzö", "Strezzo"},
+		{"w", "  Francisca \t Rasmussen ", "Francisca Rasmussen"},
+		{"iaw", " MAÉ  bowman", "mae Bowman"},
+	}
+
+	for _, m := range matches {
+		opts, err := parseMatchFlags(m.flags)
+		if err != nil || !opts.Equal(m.a, m.b) {
+			t.Errorf("TestMatchOptions: %q and %q don't match with flags %s (error %v)\n", m.a, m.b, m.flags, err)
+		}
+
+		if (MatchOptions{}).Equal(m.a, m.b) {
+			t.Errorf("TestMatchOptions: %q and %q match exactly\n", m.a, m.b)
+		}
+	}
+
+	if _, err := parseMatchFlags("iz"); err == nil {
+		t.Error("TestMatchOptions: invalid flag not rejected.\n")
+	}
+
+	if err := (MatchOptions{Normalization: "NFKC"}).Validate(); err == nil {
+		t.Error("TestMatchOptions: unsupported normalization form not rejected.\n")
+	}
+
+	searchType, opts, err := resolveSearchType("org:ix", MatchOptions{FoldCase: true})
+	if err != nil || searchType != "org" || opts != (MatchOptions{}) {
+		t.Errorf("TestMatchOptions: org:ix resolved to %s %+v (error %v)\n", searchType, opts, err)
+	}
+
+	searchType, opts, _ = resolveSearchType("org", MatchOptions{FoldCase: true})
+	if searchType != "org" || !opts.FoldCase {
+		t.Error("TestMatchOptions: default options not used without flags.\n")
+	}
+}
+
+func TestSearchWithOptions(t *testing.T) {
+	data := loadTestDataset(t)
+
+	if orgs, _ := data.FindOrgs("Name", "enthaze", MatchOptions{}); len(orgs) != 0 {
+		t.Error("TestSearchWithOptions: exact search ignored case.\n")
+	}
+
+	if orgs, _ := data.FindOrgs("Name", "enthaze", MatchOptions{FoldCase: true}); len(orgs) != 1 || orgs[0].ID != 101 {
+		t.Error("TestSearchWithOptions: case-insensitive org search failed.\n")
+	}
+
+	if orgs, _ := data.FindOrgs("Name", "strezzo", looseMatchOptions); len(orgs) != 1 || orgs[0].Name != "Strezzö" {
+		t.Error("TestSearchWithOptions: accent-insensitive org search failed.\n")
+	}
+
+	org, _ := data.GetOrg(101)
+	if orgs, _ := data.FindOrgs("Tags", "FULTON", MatchOptions{FoldCase: true}); len(orgs) != 1 || orgs[0].Tags[0] != org.Tags[0] {
+		t.Error("TestSearchWithOptions: case-insensitive tag search failed.\n")
+	}
+
+	records, err := SearchRecords(data, "user:ia", "Name", "mae BOWMAN")
+	if err != nil || len(records) != 1 || records[0].(User).ID != 62 {
+		t.Errorf("TestSearchWithOptions: search with match flags returned %d records (error %v)\n", len(records), err)
+	}
+
+	// fuzzy matching ignores case and accents of indexed and search values alike
+	if users, _ := data.FindUsers("Name", "~MAE BOWMANN", MatchOptions{}); len(users) <= 0 || users[0].ID != 62 {
+		t.Error("TestSearchWithOptions: fuzzy search not normalized.\n")
+	}
+}
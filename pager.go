@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// -------------------- pager for output longer than the terminal --------------------
+
+// width of a tab stop, for working out how many rows a line takes on the terminal
+const tabWidth = 8
+
+// Pager prints output, showing it a screen at a time if it is longer than the terminal (when both the input and output
+// are terminals)
+type Pager struct {
+	keys *LineEditor
+	out  io.Writer
+	rows int // terminal size, or 0 if output isn't paged
+	cols int
+}
+
+// NewPager returns a pager writing to out, reading keys with the line editor
+func NewPager(keys *LineEditor, out *os.File) *Pager {
+	pager := &Pager{keys: keys, out: out}
+	if keys.terminal == nil || !isTerminal(out) {
+		return pager
+	}
+
+	pager.rows, pager.cols, _ = terminalSize(keys.terminal)
+	return pager
+}
+
+// isTerminal reports whether a file is a terminal (character device)
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalSize returns the number of rows and columns of a terminal
+func terminalSize(terminal *os.File) (int, int, error) {
+	output, err := stty(terminal, "size")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size := strings.Fields(output)
+	if len(size) != 2 {
+		return 0, 0, fmt.Errorf("Unexpected terminal size: %s", output)
+	}
+
+	rows, err := strconv.Atoi(size[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	cols, err := strconv.Atoi(size[1])
+	return rows, cols, err
+}
+
+// Println prints text followed by a newline, paging it if it doesn't fit on the terminal
+func (pager *Pager) Println(text string) error {
+	if pager.rows <= 1 || pager.cols <= 0 {
+		_, err := fmt.Fprintln(pager.out, text)
+		return err
+	}
+
+	lines := wrapLines(text, pager.cols)
+	if len(lines) < pager.rows {
+		_, err := fmt.Fprintln(pager.out, text)
+		return err
+	}
+
+	restore, err := pager.keys.rawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	return pager.page(lines)
+}
+
+// page shows lines a screen at a time, with a status line at the bottom, until the end of the lines is reached or the user quits.
+// Moving forward prints the next lines (keeping the earlier ones in the terminal's scrollback), and moving back redraws the screen.
+func (pager *Pager) page(lines []string) error {
+	height := pager.rows - 1
+	shown := 0 // number of lines up to the last one on the screen
+
+	forward := func(n int) {
+		end := shown + n
+		if end > len(lines) {
+			end = len(lines)
+		}
+		for _, line := range lines[shown:end] {
+			fmt.Fprintln(pager.out, line)
+		}
+		shown = end
+	}
+	redraw := func(top int) {
+		if top > len(lines)-height {
+			top = len(lines) - height
+		}
+		if top < 0 {
+			top = 0
+		}
+		fmt.Fprint(pager.out, "\x1b[H\x1b[2J")
+		shown = top
+		forward(height)
+	}
+
+	forward(height)
+	for shown < len(lines) {
+		fmt.Fprintf(pager.out, "\x1b[7m-- More -- lines %d-%d of %d (space: next page, enter: next line, b: back, q: quit)\x1b[0m", shown-height+1, shown, len(lines))
+		key, err := pager.keys.readKey()
+		fmt.Fprint(pager.out, "\r\x1b[K")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case " ", "f", "pgdn":
+			forward(height)
+		case "enter", "j", "down":
+			forward(1)
+		case "b", "pgup":
+			redraw(shown - 2*height)
+		case "k", "up":
+			redraw(shown - height - 1)
+		case "g", "home":
+			redraw(0)
+		case "G", "end":
+			redraw(len(lines))
+		case "q", "Q", "esc", "ctrl-c":
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// wrapLines splits text into the rows it takes on a terminal of the given width, expanding tabs (escape sequences, e.g.
+// colors, take no space)
+func wrapLines(text string, cols int) []string {
+	rows := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		var row strings.Builder
+		width := 0
+		for i := 0; i < len(line); {
+			r, size := utf8.DecodeRuneInString(line[i:])
+
+			if r == '\x1b' {
+				// copy the escape sequence up to its final character
+				end := i + 1
+				for end < len(line) && (end == i+1 || line[end] < '@' || line[end] > '~') {
+					end++
+				}
+				if end < len(line) {
+					end++
+				}
+				row.WriteString(line[i:end])
+				i = end
+				continue
+			}
+
+			text := string(r)
+			if r == '\t' {
+				text = strings.Repeat(" ", tabWidth-width%tabWidth)
+			}
+			if width+utf8.RuneCountInString(text) > cols && width > 0 {
+				rows = append(rows, row.String())
+				row.Reset()
+				width = 0
+				if r == '\t' {
+					text = strings.Repeat(" ", tabWidth)
+				}
+			}
+
+			row.WriteString(text)
+			width += utf8.RuneCountInString(text)
+			i += size
+		}
+		rows = append(rows, row.String())
+	}
+
+	return rows
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		text     string
+		cols     int
+		expected []string
+	}{
+		{"short\nlines", 10, []string{"short", "lines"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"\tName: x", 10, []string{"        Na", "me: x"}},
+		{"\x1b[1mbold\x1b[0m text", 6, []string{"\x1b[1mbold\x1b[0m t", "ext"}}, // escape sequences take no space
+		{"Côpeland", 4, []string{"Côpe", "land"}},
+	}
+
+	for _, test := range tests {
+		if lines := wrapLines(test.text, test.cols); !reflect.DeepEqual(lines, test.expected) {
+			t.Errorf("TestWrapLines: %q: expected %q, got %q\n", test.text, test.expected, lines)
+		}
+	}
+}
+
+func TestPager(t *testing.T) {
+	lines := []string{}
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	text := strings.Join(lines, "\n")
+
+	// output that fits on the terminal isn't paged
+	out := &bytes.Buffer{}
+	pager := &Pager{keys: newLineEditor(strings.NewReader(""), out, nil), out: out, rows: 30, cols: 80}
+	if pager.Println(text); out.String() != text+"\n" {
+		t.Errorf("TestPager: short output changed: %q\n", out.String())
+	}
+
+	tests := []struct {
+		keys     string
+		expected int // number of status lines shown
+		last     string
+		end      bool // whether the end of the text is shown
+	}{
+		{"q", 1, "lines 1-5 of 20", false},
+		{"  ", 3, "lines 11-15 of 20", false},           // space: next page
+		{"   ", 3, "lines 11-15 of 20", true},           // the end of the text stops paging
+		{"\r\r", 3, "lines 3-7 of 20", false},           // enter: next line
+		{"  bq", 4, "lines 6-10 of 20", false},          // b: back a page
+		{"G", 1, "lines 1-5 of 20", true},               // G: jump to the end
+		{"\x1b[6~\x1b[Aq", 3, "lines 5-9 of 20", false}, // page down, up a line
+	}
+
+	for _, test := range tests {
+		out := &bytes.Buffer{}
+		pager := &Pager{keys: newLineEditor(strings.NewReader(test.keys), out, nil), out: out, rows: 6, cols: 80}
+		pager.Println(text)
+
+		statuses := strings.Count(out.String(), "-- More --")
+		last := out.String()[strings.LastIndex(out.String(), "-- More --"):]
+		if statuses != test.expected || !strings.Contains(last, test.last) {
+			t.Errorf("TestPager: keys %q: expected %d status line(s) ending with %q, got %d: %q\n", test.keys, test.expected, test.last, statuses, last)
+		}
+		if test.end != strings.HasSuffix(out.String(), lines[19]+"\n") {
+			t.Errorf("TestPager: keys %q: expected the end of the text shown: %v\n", test.keys, test.end)
+		}
+	}
+}
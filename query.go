@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// -------------------- running searches (search, augment, format) --------------------
+
+// SearchResult holds the records matching a search, with their associated records filled in. Only the list for the search
+// type is set.
+type SearchResult struct {
+	SearchType   string // org, user or ticket
+	SearchField  string
+	SearchValue  string
+	MatchOptions MatchOptions
+	Orgs         []Organization
+	Users        []User
+	Tickets      []Ticket
+}
+
+// Len returns the number of records matching the search
+func (result SearchResult) Len() int {
+	return len(result.Orgs) + len(result.Users) + len(result.Tickets)
+}
+
+// Search runs a search given as <searchtype> <searchfield> <search value>, where the search type can be followed by matching
+// flags (e.g. "org:i") and the search value can start with ~ for a fuzzy match, and adds the associated records of each
+// result. If plan is not nil, how the search was run is recorded in it.
+func (data *Dataset) Search(searchInput string, plan *QueryPlan) (SearchResult, error) {
+	searchType, searchField, searchValue, err := parseSearchInput(strings.TrimRight(searchInput, "\r\n") + "\n")
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	// matching options can be given after the search type, e.g. org:i (otherwise the configured defaults apply)
+	searchType, matchOptions, err := resolveSearchType(searchType, data.MatchOptions)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	result := SearchResult{SearchType: strings.ToLower(searchType), SearchField: searchField, SearchValue: searchValue, MatchOptions: matchOptions}
+	if plan != nil {
+		plan.describeSearch(data, result.SearchType, searchField, searchValue, matchOptions)
+	}
+
+	start := time.Now()
+	switch result.SearchType {
+	case "org":
+		result.Orgs, err = data.FindOrgs(searchField, searchValue, matchOptions)
+	case "user":
+		result.Users, err = data.FindUsers(searchField, searchValue, matchOptions)
+	case "ticket":
+		result.Tickets, err = data.FindTickets(searchField, searchValue, matchOptions)
+	default:
+		return result, fmt.Errorf("Invalid search type: %s", searchType)
+	}
+	if err != nil {
+		return result, err
+	}
+	searchTime := time.Since(start)
+
+	// add associated records to the search results
+	start = time.Now()
+	switch result.SearchType {
+	case "org":
+		result.Orgs = getAssociatedUsersAndTickets(result.Orgs, data.OrgUserIndex, data.OrgTicketIndex)
+	case "user":
+		result.Users = getAssociatedOrgsAndTickets(result.Users, data.OrgIndex, data.UserSubmittedTixIndex, data.UserAssignedTixIndex)
+	case "ticket":
+		result.Tickets = getAssociatedUsersAndOrgs(result.Tickets, data.UserIndex, data.OrgIndex)
+	}
+	augmentTime := time.Since(start)
+
+	if plan != nil {
+		plan.recordSearch(result, searchTime)
+		plan.recordAugment(result, augmentTime)
+	}
+
+	return result, nil
+}
+
+// FormatSearchResult outputs search results in a human-readable format
+func FormatSearchResult(result SearchResult) string {
+	return FormatStyledSearchResult(result, plainStyle{})
+}
+
+// FormatSearchOutput formats search results for output: with the output template for their search type if there is one,
+// otherwise in the built-in format, in the given style
+func FormatSearchOutput(result SearchResult, templates *OutputTemplates, style OutputStyle) (string, error) {
+	formatted, templated, err := templates.Format(result)
+	if templated || err != nil {
+		return formatted, err
+	}
+
+	return FormatStyledSearchResult(result, style), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -------------------- saved, parameterized queries (:save, :queries, :unsave, :run) --------------------
+
+// names queries can be saved under
+var savedQueryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parameters of a saved query, replaced by the arguments it is run with: $1, $2, ... and $* (all the arguments)
+var savedQueryParamPattern = regexp.MustCompile(`\$(\d+|\*)`)
+
+// SavedQueries are queries saved under a name, kept in a JSON file mapping names to queries
+type SavedQueries struct {
+	file    string // not saved if empty
+	Queries map[string]string
+}
+
+// OpenSavedQueries reads the saved queries from a file (none if it doesn't exist yet)
+func OpenSavedQueries(file string) (*SavedQueries, error) {
+	queries := &SavedQueries{file: file, Queries: map[string]string{}}
+	if file == "" {
+		return queries, nil
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return queries, nil
+	}
+	if err != nil {
+		return queries, err
+	}
+
+	if err := json.Unmarshal(contents, &queries.Queries); err != nil {
+		return queries, fmt.Errorf("Error reading saved queries from %s: %v", file, err)
+	}
+	if queries.Queries == nil {
+		queries.Queries = map[string]string{}
+	}
+
+	return queries, nil
+}
+
+// Names returns the names of the saved queries, sorted
+func (queries *SavedQueries) Names() []string {
+	names := []string{}
+	for name := range queries.Queries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Save saves a query under a name, replacing any query saved under it
+func (queries *SavedQueries) Save(name, query string) error {
+	query = strings.TrimSpace(query)
+	if !savedQueryNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid query name: %s (use letters, digits, - and _)", name)
+	}
+	if query == "" {
+		return fmt.Errorf("No query to save as %s", name)
+	}
+	if fields := strings.Fields(query); strings.ToLower(fields[0]) == metaCommandPrefix+"run" {
+		return fmt.Errorf("A saved query can't run another saved query")
+	}
+
+	queries.Queries[name] = query
+	return queries.write()
+}
+
+// Delete removes a saved query
+func (queries *SavedQueries) Delete(name string) error {
+	if _, found := queries.Queries[name]; !found {
+		return fmt.Errorf("No saved query named %s", name)
+	}
+
+	delete(queries.Queries, name)
+	return queries.write()
+}
+
+// write saves the queries to their file
+func (queries *SavedQueries) write() error {
+	if queries.file == "" {
+		return nil
+	}
+
+	contents, err := json.MarshalIndent(queries.Queries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(queries.file, append(contents, '\n'), 0600)
+}
+
+// Expand returns a saved query with its parameters replaced by arguments. $1, $2, ... are replaced by the arguments in
+// order, the last parameter taking any remaining arguments (so values can contain spaces), and $* by all the arguments.
+func (queries *SavedQueries) Expand(name string, args []string) (string, error) {
+	query, found := queries.Queries[name]
+	if !found {
+		return "", fmt.Errorf("No saved query named %s (enter %squeries for a list)", name, metaCommandPrefix)
+	}
+
+	params := savedQueryParams(query)
+	if len(args) < params {
+		return "", fmt.Errorf("Query %s takes %d argument(s): %s", name, params, query)
+	}
+	if params > 0 && len(args) > params {
+		args = append(args[:params-1:params-1], strings.Join(args[params-1:], " "))
+	}
+
+	return savedQueryParamPattern.ReplaceAllStringFunc(query, func(param string) string {
+		if param == "$*" {
+			return strings.Join(args, " ")
+		}
+		n, _ := strconv.Atoi(param[1:])
+		if n < 1 {
+			return param
+		}
+		return args[n-1]
+	}), nil
+}
+
+// ExpandRun returns the query to evaluate for an input: the saved query (with its arguments) for :run <name> [<argument> ...],
+// or the input itself. It lets inputs other than the prompt's (e.g. the full-screen UI's query bar) run saved queries.
+func (queries *SavedQueries) ExpandRun(input string) (string, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 || strings.ToLower(fields[0]) != metaCommandPrefix+"run" {
+		return input, nil
+	}
+	if len(fields) < 2 {
+		return "", fmt.Errorf("Invalid run format. Format: $> %srun <name> [<argument> ...]", metaCommandPrefix)
+	}
+
+	return queries.Expand(fields[1], fields[2:])
+}
+
+// savedQueryParams returns the number of numbered parameters of a query (its highest parameter number)
+func savedQueryParams(query string) int {
+	params := 0
+	for _, match := range savedQueryParamPattern.FindAllStringSubmatch(query, -1) {
+		if n, err := strconv.Atoi(match[1]); err == nil && n > params {
+			params = n
+		}
+	}
+
+	return params
+}
+
+// RunSavedQueryCommand runs a saved query command: :save <name> <query>, :queries, :unsave <name> or :run <name> [<argument> ...].
+// It returns the command's output, or for :run, the query to evaluate in place of the input. The boolean result is false if
+// the input isn't a saved query command.
+func RunSavedQueryCommand(queries *SavedQueries, input string) (string, string, bool, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 {
+		return "", "", false, nil
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case metaCommandPrefix + "save":
+		if len(fields) < 3 {
+			return "", "", true, fmt.Errorf("Invalid save format. Format: $> %ssave <name> <query>", metaCommandPrefix)
+		}
+		// keep the query as entered, since search values can depend on their spacing
+		query := strings.TrimPrefix(strings.TrimSpace(input), fields[0])
+		query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), fields[1]))
+		if err := queries.Save(fields[1], query); err != nil {
+			return "", "", true, err
+		}
+		return fmt.Sprintf("Saved %s: %s", fields[1], query), "", true, nil
+
+	case metaCommandPrefix + "queries":
+		return FormatSavedQueries(queries), "", true, nil
+
+	case metaCommandPrefix + "unsave":
+		if len(fields) != 2 {
+			return "", "", true, fmt.Errorf("Invalid unsave format. Format: $> %sunsave <name>", metaCommandPrefix)
+		}
+		if err := queries.Delete(fields[1]); err != nil {
+			return "", "", true, err
+		}
+		return "Deleted " + fields[1], "", true, nil
+
+	case metaCommandPrefix + "run":
+		query, err := queries.ExpandRun(input)
+		return "", query, true, err
+	}
+
+	return "", "", false, nil
+}
+
+// FormatSavedQueries lists the saved queries
+func FormatSavedQueries(queries *SavedQueries) string {
+	output := "\nSAVED QUERIES\n-------------\n"
+	if len(queries.Queries) <= 0 {
+		return output + fmt.Sprintf("None. Save one with %ssave <name> <query>.\n", metaCommandPrefix)
+	}
+
+	for _, name := range queries.Names() {
+		output += fmt.Sprintf("%-24s %s\n", name, queries.Queries[name])
+	}
+
+	return output
+}
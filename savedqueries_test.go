@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSavedQueries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSavedQueries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "saved_queries.json")
+	queries, err := OpenSavedQueries(file)
+	if err != nil || len(queries.Queries) != 0 {
+		t.Fatalf("TestSavedQueries: expected no saved queries (error %v)\n", err)
+	}
+
+	for _, input := range []string{":save org-tickets  ticket Org $1", ":save user-name user Name $1", ":save pending ticket Status pending", ":save similar similar ticket $1 $2"} {
+		if _, _, isCommand, err := RunSavedQueryCommand(queries, input); !isCommand || err != nil {
+			t.Errorf("TestSavedQueries: %q not saved (error %v)\n", input, err)
+		}
+	}
+
+	for _, input := range []string{":save bad/name ticket Status open", ":save empty", ":save loop :run pending"} {
+		if _, _, _, err := RunSavedQueryCommand(queries, input); err == nil {
+			t.Errorf("TestSavedQueries: expected an error for %q\n", input)
+		}
+	}
+
+	// queries are kept in the file
+	reopened, err := OpenSavedQueries(file)
+	if err != nil || len(reopened.Queries) != 4 || reopened.Queries["org-tickets"] != "ticket Org $1" {
+		t.Fatalf("TestSavedQueries: queries not saved: %v (error %v)\n", reopened.Queries, err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":run org-tickets 101", "ticket Org 101"},
+		{":run user-name Francisca Rasmussen", "user Name Francisca Rasmussen"}, // the last parameter takes the remaining arguments
+		{":run pending", "ticket Status pending"},
+		{":run similar 436bf9b0-1147-4c0a-8439-6f79833bff5b 3", "similar ticket 436bf9b0-1147-4c0a-8439-6f79833bff5b 3"},
+	}
+
+	for _, test := range tests {
+		_, query, _, err := RunSavedQueryCommand(reopened, test.input)
+		if err != nil || query != test.expected {
+			t.Errorf("TestSavedQueries: %q: expected %q, got %q (error %v)\n", test.input, test.expected, query, err)
+		}
+	}
+
+	for _, input := range []string{":run org-tickets", ":run similar 1", ":run nothing", ":unsave nothing"} {
+		if _, _, _, err := RunSavedQueryCommand(reopened, input); err == nil {
+			t.Errorf("TestSavedQueries: expected an error for %q\n", input)
+		}
+	}
+
+	if _, _, _, err := RunSavedQueryCommand(reopened, ":unsave pending"); err != nil {
+		t.Errorf("TestSavedQueries: unexpected error deleting a query: %v\n", err)
+	}
+	if reopened, _ = OpenSavedQueries(file); len(reopened.Names()) != 3 {
+		t.Errorf("TestSavedQueries: query not deleted: %v\n", reopened.Names())
+	}
+
+	if _, _, isCommand, _ := RunSavedQueryCommand(reopened, "ticket Status pending"); isCommand {
+		t.Errorf("TestSavedQueries: a search was taken for a saved query command\n")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// -------------------- record validation against user-defined JSON Schema files --------------------
+
+// Schema holds the subset of JSON Schema used to validate data records: type, properties, required, additionalProperties,
+// enum, items, minLength/maxLength, pattern, minimum/maximum and minItems/maxItems
+type Schema struct {
+	Type                 interface{}        `json:"type"` // a single type name, or a list of type names
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	Items                *Schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	patternRegexp        *regexp.Regexp
+}
+
+// SchemaViolation describes a single record field that does not conform to its schema
+type SchemaViolation struct {
+	Record  string // record identifier, e.g. "organizations.json[3] (_id 104)"
+	Path    string // path to the offending value within the record, e.g. "tags[2]"
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	if v.Path == "" {
+		return fmt.Sprintf("%s: %s", v.Record, v.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", v.Record, v.Path, v.Message)
+}
+
+// LoadSchema reads a JSON Schema file, returning an error if it cannot be parsed or uses an invalid pattern
+func LoadSchema(fileName string) (*Schema, error) {
+	schemaData, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{}
+	err = json.Unmarshal(schemaData, schema)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema file %s: %v", fileName, err)
+	}
+
+	err = schema.compile()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema file %s: %v", fileName, err)
+	}
+
+	return schema, nil
+}
+
+// compile prepares regular expressions used by the schema and any sub-schemas
+func (schema *Schema) compile() error {
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return err
+		}
+		schema.patternRegexp = re
+	}
+
+	for _, propSchema := range schema.Properties {
+		err := propSchema.compile()
+		if err != nil {
+			return err
+		}
+	}
+
+	if schema.Items != nil {
+		return schema.Items.compile()
+	}
+
+	return nil
+}
+
+// typeNames returns the list of types a value is allowed to take (empty if unrestricted)
+func (schema *Schema) typeNames() []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		names := []string{}
+		for _, name := range t {
+			names = append(names, fmt.Sprintf("%v", name))
+		}
+		return names
+	}
+
+	return []string{}
+}
+
+// ValidateRecords checks a JSON array of records against a schema, returning any violations found. Records are identified by
+// their position in the file and their _id value.
+func ValidateRecords(sourceName string, data []byte, schema *Schema) ([]SchemaViolation, error) {
+	violations := []SchemaViolation{}
+	if schema == nil {
+		return violations, nil
+	}
+
+	var records []interface{}
+	err := json.Unmarshal(data, &records)
+	if err != nil {
+		return violations, err
+	}
+
+	for i, record := range records {
+		recordName := fmt.Sprintf("%s[%d]", sourceName, i)
+		if obj, isObj := record.(map[string]interface{}); isObj && obj["_id"] != nil {
+			recordName = fmt.Sprintf("%s (_id %v)", recordName, obj["_id"])
+		}
+
+		violations = append(violations, schema.Validate(recordName, "", record)...)
+	}
+
+	return violations, nil
+}
+
+// Validate checks a single decoded JSON value against the schema
+func (schema *Schema) Validate(recordName, path string, value interface{}) []SchemaViolation {
+	violations := []SchemaViolation{}
+	violation := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Record: recordName, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	typeNames := schema.typeNames()
+	if len(typeNames) > 0 && !jsonTypeMatches(value, typeNames) {
+		violation("expected %s, got %s", strings.Join(typeNames, " or "), jsonTypeName(value))
+		return violations
+	}
+
+	if len(schema.Enum) > 0 {
+		inEnum := false
+		for _, e := range schema.Enum {
+			if jsonValuesEqual(e, value) {
+				inEnum = true
+				break
+			}
+		}
+
+		if !inEnum {
+			violation("value %v is not one of %v", value, schema.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if schema.MinLength != nil && len([]rune(v)) < *schema.MinLength {
+			violation("string shorter than %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && len([]rune(v)) > *schema.MaxLength {
+			violation("string longer than %d characters", *schema.MaxLength)
+		}
+		if schema.patternRegexp != nil && !schema.patternRegexp.MatchString(v) {
+			violation("value %q does not match pattern %s", v, schema.Pattern)
+		}
+
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			violation("value %v is less than minimum %v", v, *schema.Minimum)
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			violation("value %v is greater than maximum %v", v, *schema.Maximum)
+		}
+
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			violation("array has fewer than %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			violation("array has more than %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range v {
+				violations = append(violations, schema.Items.Validate(recordName, fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, field := range schema.Required {
+			if _, present := v[field]; !present {
+				violation("missing required field %q", field)
+			}
+		}
+
+		// check fields in a stable order so violations are reported consistently
+		fields := []string{}
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			fieldPath := field
+			if path != "" {
+				fieldPath = path + "." + field
+			}
+
+			propSchema, defined := schema.Properties[field]
+			if !defined {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					violations = append(violations, SchemaViolation{Record: recordName, Path: fieldPath, Message: "field not defined in schema"})
+				}
+				continue
+			}
+
+			violations = append(violations, propSchema.Validate(recordName, fieldPath, v[field])...)
+		}
+	}
+
+	return violations
+}
+
+// jsonTypeName returns the JSON Schema type name of a decoded JSON value
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return "unknown"
+}
+
+// jsonTypeMatches reports whether a decoded JSON value is one of the given JSON Schema types
+func jsonTypeMatches(value interface{}, typeNames []string) bool {
+	valueType := jsonTypeName(value)
+
+	for _, name := range typeNames {
+		if name == valueType || (name == "number" && valueType == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonValuesEqual reports whether two decoded JSON values are equal: of the same JSON type (so the string "5" doesn't equal
+// the number 5) and with the same value, comparing arrays item by item and objects field by field
+func jsonValuesEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bv, isBool := b.(bool)
+		return isBool && av == bv
+	case string:
+		bv, isString := b.(string)
+		return isString && av == bv
+	case float64:
+		bv, isNumber := b.(float64)
+		return isNumber && av == bv
+	case []interface{}:
+		bv, isArray := b.([]interface{})
+		if !isArray || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonValuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, isObject := b.(map[string]interface{})
+		if !isObject || len(av) != len(bv) {
+			return false
+		}
+		for field, value := range av {
+			other, present := bv[field]
+			if !present || !jsonValuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSampleDataConformsToSchemas(t *testing.T) {
+	config, err := ReadAppConfig("config.json")
+	if err != nil {
+		t.Fatalf("TestSampleDataConformsToSchemas: cannot read config file - %v\n", err)
+	}
+
+	orgSchema, err := LoadSchema(config.OrgSchemaFileLocation)
+	if err != nil {
+		t.Fatalf("TestSampleDataConformsToSchemas: cannot load org schema - %v\n", err)
+	}
+
+	userSchema, err := LoadSchema(config.UserSchemaFileLocation)
+	if err != nil {
+		t.Fatalf("TestSampleDataConformsToSchemas: cannot load user schema - %v\n", err)
+	}
+
+	ticketSchema, err := LoadSchema(config.TicketSchemaFileLocation)
+	if err != nil {
+		t.Fatalf("TestSampleDataConformsToSchemas: cannot load ticket schema - %v\n", err)
+	}
+
+	orgs, violations, err := ReadOrganizationDataWithSchema(config.OrgFileLocation, orgSchema)
+	if err != nil || len(orgs) != 25 || len(violations) != 0 {
+		t.Errorf("TestSampleDataConformsToSchemas: org data - %d orgs, violations %v, error %v\n", len(orgs), violations, err)
+	}
+
+	users, violations, err := ReadUserDataWithSchema(config.UserFileLocation, userSchema)
+	if err != nil || len(users) != 75 || len(violations) != 0 {
+		t.Errorf("TestSampleDataConformsToSchemas: user data - %d users, violations %v, error %v\n", len(users), violations, err)
+	}
+
+	tickets, violations, err := ReadTicketDataWithSchema(config.TicketFileLocation, ticketSchema)
+	if err != nil || len(tickets) != 200 || len(violations) != 0 {
+		t.Errorf("TestSampleDataConformsToSchemas: ticket data - %d tickets, violations %v, error %v\n", len(tickets), violations, err)
+	}
+}
+
+func TestValidateRecordsReportsViolations(t *testing.T) {
+	schema, err := LoadSchema("schemas/ticket.schema.json")
+	if err != nil {
+		t.Fatalf("TestValidateRecordsReportsViolations: cannot load ticket schema - %v\n", err)
+	}
+
+	data := []byte(`[{"_id": "t1", "url": "ftp://x", "external_id": "e", "created_at": "c", "subject": "s", "priority": "whenever",
+		"status": "open", "submitter_id": "5", "via": "web", "tags": ["a", 3]}]`)
+
+	violations, err := ValidateRecords("tickets.json", data, schema)
+	if err != nil {
+		t.Fatalf("TestValidateRecordsReportsViolations: error validating records - %v\n", err)
+	}
+
+	// bad url pattern, priority enum, submitter_id type and tags[1] type
+	if len(violations) != 4 {
+		t.Errorf("TestValidateRecordsReportsViolations: expected 4 violations, got %d: %v\n", len(violations), violations)
+	}
+
+	for _, violation := range violations {
+		if !strings.HasPrefix(violation.String(), "tickets.json[0] (_id t1)") {
+			t.Errorf("TestValidateRecordsReportsViolations: violation not attributed to record: %s\n", violation)
+		}
+	}
+
+	closed := false
+	schema.AdditionalProperties = &closed
+	violations, _ = ValidateRecords("tickets.json", []byte(`[{"_id": "t2", "url": "http://x", "external_id": "e", "created_at": "c",
+		"subject": "s", "priority": "low", "status": "open", "submitter_id": 5, "via": "web", "region": "APAC"}]`), schema)
+	if len(violations) != 1 || violations[0].Path != "region" {
+		t.Errorf("TestValidateRecordsReportsViolations: undefined field not reported: %v\n", violations)
+	}
+}
+
+func TestValidateEnumComparesTypes(t *testing.T) {
+	schema := &Schema{Enum: []interface{}{"5", 1.0, true, nil, []interface{}{"a"}}}
+
+	inputs := map[string]bool{
+		`"5"`:     true,
+		`5`:       false,
+		`1`:       true,
+		`"1"`:     false,
+		`true`:    true,
+		`"true"`:  false,
+		`null`:    true,
+		`"<nil>"`: false,
+		`["a"]`:   true,
+		`"[a]"`:   false,
+	}
+
+	for input, valid := range inputs {
+		violations, err := ValidateRecords("values.json", []byte("["+input+"]"), schema)
+		if err != nil {
+			t.Fatalf("TestValidateEnumComparesTypes: error validating %s - %v\n", input, err)
+		}
+
+		if (len(violations) == 0) != valid {
+			t.Errorf("TestValidateEnumComparesTypes: %s - expected valid %v, got violations %v\n", input, valid, violations)
+		}
+	}
+}
@@ -1,69 +1,189 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"gopkg.in/oleiade/reflections.v1"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 )
 
 func main() {
+	// run a saved query and exit, rather than starting the prompt: search -run <name> [<argument> ...]
+	runQuery := flag.String("run", "", "run a saved query with the arguments that follow, and exit")
+	// manage saved queries and exit: search -queries, search -save <name> <query>, search -unsave <name>
+	listQueries := flag.Bool("queries", false, "list the saved queries, and exit")
+	saveQuery := flag.String("save", "", "save the query that follows under a name, and exit")
+	unsaveQuery := flag.String("unsave", "", "delete a saved query, and exit")
+	// start the full-screen UI rather than the prompt
+	startTUI := flag.Bool("tui", false, "start the full-screen terminal UI")
+	// output templates, in place of the ones set in the config
+	templateFlags := map[string]*string{
+		"org":    flag.String("org-template", "", "text/template file formatting each org in search results"),
+		"user":   flag.String("user-template", "", "text/template file formatting each user in search results"),
+		"ticket": flag.String("ticket-template", "", "text/template file formatting each ticket in search results"),
+	}
+	// the time tickets' due dates are compared with, in place of the one set in the config
+	slaNow := flag.String("now", "", "time to compare ticket due dates with, e.g. 2016-08-01 (default the current time)")
+	flag.Parse()
+
 	// parse app config and get data file locations for reading
 	log.Println("Reading config..")
-	orgDataFile, userDataFile, ticketDataFile, err := GetAppConfig()
+	config, err := ReadAppConfig("config.json")
 	if err != nil {
 		log.Fatal(fmt.Sprintf("Error reading config file: %v", err))
 	}
 
-	// read organization data from file
-	OrgList, err := ReadOrganizationData(orgDataFile)
+	// open the storage backend and read org/user/ticket data from it
+	store, err := OpenStore(config)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Error reading org data file: %v", err))
+		log.Fatal(fmt.Sprintf("Error opening data store: %v", err))
+	}
+	defer store.Close()
+
+	if _, indexed := store.(IndexedStore); !indexed && *runQuery == "" {
+		fmt.Println("Building indexes...")
 	}
 
-	// read user data from file
-	UserList, err := ReadUserData(userDataFile)
+	// load the data, building indexes (or loading them, for stores that persist them)
+	data, err := LoadDataset(store)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Error reading user data file: %v", err))
+		log.Fatal(err)
+	}
+	data.MatchOptions = config.MatchOptions
+	data.SLA = config.SLA
+	if *slaNow != "" {
+		data.SLA.Now = *slaNow
+		if err := data.SLA.Validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// open the change journal, re-applying any changes that were journaled but not saved (e.g. due to a crash). Recovered
+	// changes stay unsaved (in memory and the journal) until the save command, so the data store isn't written on startup.
+	var journal *Journal
+	var recoveredEntries []int
+	if config.JournalFileLocation != "" {
+		journal, err = OpenJournal(config.JournalFileLocation)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Error opening journal: %v", err))
+		}
+		defer journal.Close()
+
+		for _, entry := range journal.Unsaved() {
+			recoveredEntries = append(recoveredEntries, entry.Seq)
+		}
+
+		recovered, err := journal.Recover(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if recovered > 0 {
+			fmt.Printf("Recovered %d unsaved change(s) from %s.\n", recovered, config.JournalFileLocation)
+		}
+	}
+
+	// apply any configured delta files to bring the loaded data up to date. They are applied again on each startup, so
+	// aren't journaled, and like recovered changes are only saved to the data store by the save command.
+	for _, deltaFile := range config.DeltaFileLocations {
+		delta, err := ReadDeltaFile(deltaFile)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Error reading delta file: %v", err))
+		}
+
+		orgResult, userResult, ticketResult := data.ApplyDelta(delta)
+		fmt.Printf("Applied %s: %d org, %d user and %d ticket change(s).\n", deltaFile, orgResult.Inserted+orgResult.Updated+orgResult.Deleted, userResult.Inserted+userResult.Updated+userResult.Deleted, ticketResult.Inserted+ticketResult.Updated+ticketResult.Deleted)
+	}
+
+	// changes made on startup, kept apart from the changes saved by later commands
+	unsaved := data.TakeChanges()
+	if !unsaved.Empty() {
+		fmt.Printf("%d record(s) changed on startup are not saved to the data store. Enter 'save' to save them.\n", unsaved.Len())
 	}
 
-	// read ticket data from file
-	TicketList, err := ReadTicketData(ticketDataFile)
+	savedQueries, err := OpenSavedQueries(config.SavedQueriesFileLocation)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Error reading ticket data file: %v", err))
+		log.Printf("Error reading saved queries: %v", err)
 	}
 
-	fmt.Println("Building indexes...")
+	// provide search prompt to user on command line, running REPL-style until keyboard interrupt. Input is read with a line
+	// editor (history, reverse search and tab completion) if it comes from a terminal.
+	var editor *LineEditor
+	commandLineInput := ""
+	switch {
+	case *runQuery != "":
+		commandLineInput = strings.Join(append([]string{metaCommandPrefix + "run", *runQuery}, flag.Args()...), " ")
+	case *saveQuery != "":
+		commandLineInput = strings.Join(append([]string{metaCommandPrefix + "save", *saveQuery}, flag.Args()...), " ")
+	case *unsaveQuery != "":
+		commandLineInput = metaCommandPrefix + "unsave " + *unsaveQuery
+	case *listQueries:
+		commandLineInput = metaCommandPrefix + "queries"
+	}
 
-	// build indexes
-	OrgUserIndex := indexOrgUsers(UserList)
-	OrgTicketIndex := indexOrgTickets(TicketList)
-	OrgIndex := indexOrgs(OrgList)
-	UserSubmittedTixIndex := indexUserSubmittedTickets(TicketList)
-	UserAssignedTixIndex := indexUserAssignedTickets(TicketList)
-	UserIndex := indexUsers(UserList)
+	if commandLineInput != "" {
+		// the saved query command is the only input, and there is no prompt
+		editor = newLineEditor(strings.NewReader(commandLineInput+"\n"), ioutil.Discard, nil)
+	} else {
+		fmt.Printf("%d organizations.\n", len(data.OrgList))
+		fmt.Printf("%d users.\n", len(data.UserList))
+		fmt.Printf("%d tickets.\n\n", len(data.TicketList))
 
-	fmt.Printf("%d organizations.\n", len(OrgList))
-	fmt.Printf("%d users.\n", len(UserList))
-	fmt.Printf("%d tickets.\n\n", len(TicketList))
+		editor, err = NewLineEditor(os.Stdin, os.Stdout, config.HistoryFileLocation, newPromptCompleter(data, savedQueries))
+		if err != nil {
+			log.Printf("Error reading history file: %v", err)
+		}
+	}
+	prompt := "search >>" // console prompt text
 
-	// provide search prompt to user on command line, running REPL-style until keyboard interrupt
-	buffReader := bufio.NewReader(os.Stdin) // buffered reader to read console input
-	prompt := "search >>"                   // console prompt text
+	// long output is paged if it doesn't fit on the terminal
+	pager := NewPager(editor, os.Stdout)
 
-	for {
-		// show prompt
-		fmt.Print(prompt)
+	// search results are colored if the output is a terminal (unless NO_COLOR is set, or as configured)
+	style := NewOutputStyle(useColor(config.Color, os.Stdout))
 
-		// read input from user
-		searchInput, _ := buffReader.ReadString('\n')
+	// search results of types with an output template are formatted with it, rather than the built-in format
+	templateFiles := map[string]string{"org": config.OrgTemplateFileLocation, "user": config.UserTemplateFileLocation, "ticket": config.TicketTemplateFileLocation}
+	for searchType, file := range templateFlags {
+		if *file != "" {
+			templateFiles[searchType] = *file
+		}
+	}
+	templates, err := LoadOutputTemplates(templateFiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *startTUI {
+		if editor.terminal == nil {
+			log.Fatal(errNoTerminal)
+		}
+		if err := NewTUI(data, savedQueries, editor, os.Stdout).Run(""); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for {
+		// show prompt and read input from user
+		searchInput, err := editor.ReadLine(prompt)
+		if err == io.EOF || err == errInterrupted {
+			// end of piped input, Ctrl-D or Ctrl-C
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading input: %v", err)
+			return
+		}
 
 		if strings.TrimSpace(searchInput) == "" {
 			// no input - continue showing prompt
@@ -71,76 +191,311 @@ func main() {
 
 		} else {
 			// search input received - evaluate
+			if err := editor.AddHistory(searchInput); err != nil {
+				log.Printf("Error saving history: %v", err)
+			}
 
-			// input format expected: <searchtype> <searchfield> <search value> (search value can be empty)
-			searchType, searchField, searchValue, err := parseSearchInput(searchInput)
+			// saved queries: :save <name> <query>, :queries, :unsave <name>, or :run <name> [<argument> ...] to evaluate a
+			// saved query in place of the input
+			output, query, isSavedQueryCommand, err := RunSavedQueryCommand(savedQueries, searchInput)
+			if isSavedQueryCommand {
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				if query == "" {
+					pager.Println(output)
+					continue
+				}
+				searchInput = query
+			}
 
-			if err != nil {
-				// show error and prompt for next search input
-				fmt.Printf("Error: %v\n", err)
+			// meta-commands: :help, :fields <type>, :describe <type> <field>, :stats and :quit
+			if isMetaCommand(searchInput) {
+				output, quit, err := RunMetaCommand(data, searchInput)
+				if quit {
+					return
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+
+				pager.Println(output)
+				continue
+			}
+
+			// save the changes made on startup (recovered from the journal, or applied from delta files) to the data store
+			if strings.ToLower(strings.TrimSpace(searchInput)) == "save" {
+				if unsaved.Empty() {
+					fmt.Println("No unsaved changes.")
+					continue
+				}
+
+				err := store.Commit(data, unsaved)
+				if err == nil && journal != nil && len(recoveredEntries) > 0 {
+					err = journal.MarkSaved(recoveredEntries...)
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+
+				fmt.Printf("Saved %d record(s).\n", unsaved.Len())
+				unsaved, recoveredEntries = newChangeSet(), nil
 				continue
 			}
 
-			validSearchType := false
+			// data validation command
+			if strings.ToLower(strings.TrimSpace(searchInput)) == "validate" {
+				pager.Println(FormatValidationReport(ValidateData(data.OrgList, data.UserList, data.TicketList)))
+				continue
+			}
 
-			// search organizations
-			if strings.ToLower(searchType) == "org" {
-				validSearchType = true
+			// duplicate user/org detection command
+			if strings.ToLower(strings.TrimSpace(searchInput)) == "duplicates" {
+				pager.Println(FormatDuplicates(FindDuplicates(data)))
+				continue
+			}
+
+			// email domain report, optionally linking users with a missing org to the org listing their email domain
+			if command := strings.Join(strings.Fields(strings.ToLower(searchInput)), " "); command == "domains" || command == "domains fill" {
+				if command == "domains" {
+					pager.Println(FormatDomainReport(CheckUserDomains(data)))
+					continue
+				}
 
-				// get list of organizations matching this search criteria
-				orgs, err := SearchOrgs(searchField, searchValue, OrgList)
+				description := fmt.Sprintf("Linked %d user(s) to orgs by email domain", FillUserOrgsFromDomains(data))
+				fmt.Println(description)
+				err := SaveChanges(store, journal, data, journalChange, description, 0)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+			}
+
+			// ticket SLA report, of all the tickets or those matching a search: sla [ticket <searchfield> <search value>]
+			if slaSearch, isSLACommand := parseSLACommand(searchInput); isSLACommand {
+				report, err := data.ReportSLAs(slaSearch)
 				if err != nil {
 					fmt.Printf("Error: %v\n", err)
 					continue
 				}
 
-				// add associated users and tickets to returned search results
-				orgsAugmented := getAssociatedUsersAndTickets(orgs, OrgUserIndex, OrgTicketIndex)
+				pager.Println(FormatSLAReport(report))
+				continue
+			}
+
+			// merge duplicate users/orgs into a surviving record: merge <user|org> <surviving id> <duplicate id> ...
+			mergeType, survivorID, duplicateIDs, isMergeCommand, err := parseMergeCommand(searchInput)
+			if isMergeCommand {
+				var result MergeResult
+				if err == nil {
+					if mergeType == "user" {
+						result, err = data.MergeUsers(survivorID, duplicateIDs...)
+					} else {
+						result, err = data.MergeOrgs(survivorID, duplicateIDs...)
+					}
+				}
 
-				// print search result
-				fmt.Println(FormatOrgResult(orgsAugmented))
+				if err == nil {
+					description := fmt.Sprintf("Merged %d %s(s) into %s %d: %d user(s) and %d ticket(s) updated", result.Merged, mergeType, mergeType, survivorID, result.UsersUpdated, result.TicketsUpdated)
+					fmt.Println(description)
+					err = SaveChanges(store, journal, data, journalChange, description, 0)
+				}
+
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
 			}
 
-			// search users
-			if strings.ToLower(searchType) == "user" {
-				validSearchType = true
+			// tickets most similar to a ticket: similar ticket <id> [<number of tickets>]
+			similarID, similarCount, isSimilarCommand, err := parseSimilarCommand(searchInput)
+			if isSimilarCommand {
+				var similar []SimilarTicket
+				if err == nil {
+					similar, err = data.SimilarTickets(similarID, similarCount)
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
 
-				// get list of users matching this search criteria
-				users, err := SearchUsers(searchField, searchValue, UserList)
+				target, _ := data.GetTicket(similarID)
+				pager.Println(FormatSimilarTickets(target, similar))
+				continue
+			}
+
+			// apply a delta file to the loaded data: apply <delta file>
+			if fields := strings.Fields(searchInput); len(fields) == 2 && strings.ToLower(fields[0]) == "apply" {
+				delta, err := ReadDeltaFile(fields[1])
 				if err != nil {
 					fmt.Printf("Error: %v\n", err)
 					continue
 				}
 
-				// add associated orgs and tickets to returned search results
-				usersAugmented := getAssociatedOrgsAndTickets(users, OrgIndex, UserSubmittedTixIndex, UserAssignedTixIndex)
+				pager.Println(FormatDeltaResult(data.ApplyDelta(delta)))
+				err = SaveChanges(store, journal, data, journalChange, "Applied "+fields[1], 0)
+				if err != nil {
+					fmt.Printf("Error saving changes: %v\n", err)
+				}
+				continue
+			}
+
+			// create/update/delete records, saving the changes to the data store
+			command, isWriteCommand, err := parseWriteCommand(searchInput)
+			if isWriteCommand {
+				if err == nil {
+					var description string
+					description, err = RunWriteCommand(data, command)
+					if err == nil {
+						fmt.Println(description)
+						err = SaveChanges(store, journal, data, journalChange, description, 0)
+					}
+				}
 
-				// print search result
-				fmt.Println(FormatUserResult(usersAugmented))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
 			}
 
-			if strings.ToLower(searchType) == "ticket" {
-				validSearchType = true
+			// apply a write operation to all records matching a search, after previewing the changes
+			bulkCommand, isBulkCommand, err := parseBulkCommand(searchInput)
+			if isBulkCommand {
+				var changes []BulkChange
+				if err == nil {
+					changes, err = PlanBulkCommand(data, bulkCommand)
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+
+				pager.Println(FormatBulkPreview(changes))
+				if bulkCommand.Preview || len(changes) <= 0 {
+					continue
+				}
 
-				
+				confirmation, _ := editor.ReadLine(fmt.Sprintf("Apply changes to %d record(s)? (y/n) ", len(changes)))
+				if answer := strings.ToLower(strings.TrimSpace(confirmation)); answer != "y" && answer != "yes" {
+					fmt.Println("No changes made.")
+					continue
+				}
 
-				// get list of tickets matching this search criteria
-				tickets, err := SearchTickets(searchField, searchValue, TicketList)
+				ApplyBulkChanges(data, changes)
+				description := describeBulkCommand(bulkCommand, len(changes))
+				fmt.Println(description)
+				err = SaveChanges(store, journal, data, journalChange, description, 0)
 				if err != nil {
 					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+			}
+
+			// journal commands: undo the last change, or list recent changes
+			if command := strings.ToLower(strings.TrimSpace(searchInput)); command == "undo" || command == "history" {
+				if journal == nil {
+					fmt.Println("Error: the change journal is not enabled (set JournalFileLocation in the config)")
+					continue
+				}
+
+				if command == "history" {
+					pager.Println(FormatJournalHistory(journal))
 					continue
 				}
 
-				// func getAssociatedUsersAndOrgs(tickets []Ticket, userIndex map[int]User, orgIndex map[int]Organization) []Ticket
-				ticketsAugmented := getAssociatedUsersAndOrgs(tickets, UserIndex, OrgIndex)
+				entry, err := journal.Undo(data)
+				if err == nil {
+					description := fmt.Sprintf("Undid #%d: %s", entry.Seq, entry.Description)
+					fmt.Println(description)
+					err = SaveChanges(store, journal, data, journalUndo, description, entry.Seq)
+				}
 
-				// print search result
-				fmt.Println(FormatTicketResult(ticketsAugmented))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
 			}
 
-			if !validSearchType {
-				fmt.Printf("Invalid search type: %s\n", searchType)
+			// step through the results of a search and the records linked to them: browse <searchtype> <searchfield> <search value>
+			if search, isBrowseCommand := parseBrowseCommand(searchInput); isBrowseCommand {
+				if editor.terminal == nil {
+					fmt.Printf("Error: %v\n", errNoTerminal)
+					continue
+				}
+
+				result, err := data.Search(search, nil)
+				if err == nil {
+					err = NewBrowser(data, editor, os.Stdout).Browse(search, searchRecords(result))
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
 			}
+
+			// full-screen UI, optionally starting with the results of a search: tui [<searchtype> <searchfield> <search value>]
+			if search, isTUICommand := parseTUICommand(searchInput); isTUICommand {
+				if editor.terminal == nil {
+					fmt.Printf("Error: %v\n", errNoTerminal)
+					continue
+				}
+
+				if err := NewTUI(data, savedQueries, editor, os.Stdout).Run(search); err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				continue
+			}
+
+			// write the results of a search to a report file: export <format> <file> <searchtype> <searchfield> <search value>
+			exportFormat, exportFile, exportSearch, isExportCommand, err := parseExportCommand(searchInput)
+			if isExportCommand {
+				var result SearchResult
+				var files []string
+				if err == nil {
+					result, files, err = ExportSearch(data, exportFormat, exportFile, exportSearch)
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+
+				if len(files) > 0 {
+					fmt.Printf("Exported %d result(s) to %s.\n", result.Len(), strings.Join(files, ", "))
+				}
+				continue
+			}
+
+			// show how a search is run: explain <searchtype> <searchfield> <search value>
+			if search, isExplainCommand := parseExplainCommand(searchInput); isExplainCommand {
+				plan, err := Explain(data, search, templates, style)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+
+				pager.Println(FormatQueryPlan(plan))
+				continue
+			}
+
+			// input format expected: <searchtype> <searchfield> <search value> (search value can be empty), with matching
+			// options after the search type, e.g. org:i (otherwise the configured defaults apply)
+			result, err := data.Search(searchInput, nil)
+			if err != nil {
+				// show error and prompt for next search input
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+
+			// print search result, with the associated records of each result
+			formatted, err := FormatSearchOutput(result, templates, style)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			pager.Println(formatted)
 		}
 	}
 }
@@ -148,73 +503,100 @@ func main() {
 // --------------- struct types to store Org/User/Ticket data and read application config ---------------------------
 
 type Organization struct {
-	ID                int      `json:"_id"`
-	Name              string   `json:"name"`
-	URL               string   `json:"url"`
-	External_id       string   `json:"external_id"`
-	DomainNames       []string `json:"domain_names"`
-	Created_at        string   `json:"created_at"`
-	Details           string   `json:"details"`
-	Shared_tickets    bool     `json:"shared_tickets"`
-	Tags              []string `json:"tags"`
+	ID                int              `json:"_id"`
+	Name              string           `json:"name"`
+	URL               string           `json:"url"`
+	External_id       string           `json:"external_id"`
+	DomainNames       []string         `json:"domain_names"`
+	Created_at        string           `json:"created_at"`
+	Details           string           `json:"details"`
+	Shared_tickets    bool             `json:"shared_tickets"`
+	Tags              []string         `json:"tags"`
+	Custom            CustomAttributes `json:"-"`
 	AssociatedUsers   []User
 	AssociatedTickets []Ticket
 }
 
 type User struct {
-	ID               int      `json:"_id"`
-	Name             string   `json:"name"`
-	URL              string   `json:"url"`
-	External_id      string   `json:"external_id"`
-	Alias            string   `json:"alias"`
-	Created_at       string   `json:"created_at"`
-	Active           bool     `json:"active"`
-	Verified         bool     `json:"verified"`
-	Shared           bool     `json:"shared"`
-	Locale           string   `json:"locale"`
-	Timezone         string   `json:"timezone"`
-	Last_login_at    string   `json:"last_login_at"`
-	Email            string   `json:"email"`
-	Phone            string   `json:"phone"`
-	Signature        string   `json:"signature"`
-	Tags             []string `json:"tags"`
-	Suspended        bool     `json:"suspended"`
-	Role             string   `json:"role"`
-	Org              int      `json:"organization_id"`
+	ID               int              `json:"_id"`
+	Name             string           `json:"name"`
+	URL              string           `json:"url"`
+	External_id      string           `json:"external_id"`
+	Alias            string           `json:"alias"`
+	Created_at       string           `json:"created_at"`
+	Active           bool             `json:"active"`
+	Verified         bool             `json:"verified"`
+	Shared           bool             `json:"shared"`
+	Locale           string           `json:"locale"`
+	Timezone         string           `json:"timezone"`
+	Last_login_at    string           `json:"last_login_at"`
+	Email            string           `json:"email"`
+	Phone            string           `json:"phone"`
+	Signature        string           `json:"signature"`
+	Tags             []string         `json:"tags"`
+	Suspended        bool             `json:"suspended"`
+	Role             string           `json:"role"`
+	Org              int              `json:"organization_id"`
+	Custom           CustomAttributes `json:"-"`
 	OrgObject        Organization
 	TicketsSubmitted []Ticket
 	TicketsAssigned  []Ticket
 }
 
 type Ticket struct {
-	ID            string   `json:"_id"`
-	URL           string   `json:"url"`
-	External_id   string   `json:"external_id"`
-	Created_at    string   `json:"created_at"`
-	Priority      string   `json:"priority"`
-	Status        string   `json:"status"`
-	Type          string   `json:"type"`
-	Subject       string   `json:"subject"`
-	Description   string   `json:"description"`
-	Tags          []string `json:"tags"`
-	Org           int      `json:"organization_id"`
-	Has_incidents bool     `json:"has_incidents"`
-	Due_at        string   `json:"due_at"`
-	Submitter     int      `json:"submitter_id"`
-	Assignee      int      `json:"assignee_id"`
-	Via           string   `json:"via"`
+	ID            string           `json:"_id"`
+	URL           string           `json:"url"`
+	External_id   string           `json:"external_id"`
+	Created_at    string           `json:"created_at"`
+	Priority      string           `json:"priority"`
+	Status        string           `json:"status"`
+	Type          string           `json:"type"`
+	Subject       string           `json:"subject"`
+	Description   string           `json:"description"`
+	Tags          []string         `json:"tags"`
+	Org           int              `json:"organization_id"`
+	Has_incidents bool             `json:"has_incidents"`
+	Due_at        string           `json:"due_at"`
+	Submitter     int              `json:"submitter_id"`
+	Assignee      int              `json:"assignee_id"`
+	Via           string           `json:"via"`
+	Custom        CustomAttributes `json:"-"`
 	SubmitterObj  User
 	AssigneeObj   User
 	OrgObj        Organization
 }
 
-// struct to read in an application config file with locations of input data files
+// struct to read in an application config file with locations of input data files (and optional schema files to validate them)
 type AppConfig struct {
-	OrgFileLocation    string `json:"OrgDataFileLocation"`
-	UserFileLocation   string `json:"UserDataFileLocation"`
-	TicketFileLocation string `json:"TicketDataileLocation"`
+	OrgFileLocation          string       `json:"OrgDataFileLocation"`
+	UserFileLocation         string       `json:"UserDataFileLocation"`
+	TicketFileLocation       string       `json:"TicketDataileLocation"`
+	OrgSchemaFileLocation    string       `json:"OrgSchemaFileLocation"`
+	UserSchemaFileLocation   string       `json:"UserSchemaFileLocation"`
+	TicketSchemaFileLocation string       `json:"TicketSchemaFileLocation"`
+	RefuseSchemaViolations   bool         `json:"RefuseSchemaViolations"` // exit on startup if any data record violates its schema
+	ImportDirectory          string       `json:"ImportDirectory"`        // directory of saved Zendesk API export pages, used instead of the data files
+	ImportBaseURL            string       `json:"ImportBaseURL"`          // Zendesk instance to fetch export pages from, used instead of the data files
+	ImportAPIToken           string       `json:"ImportAPIToken"`
+	DeltaFileLocations       []string     `json:"DeltaFileLocations"`       // delta files applied in order after loading the data
+	StorageBackend           string       `json:"StorageBackend"`           // "json" (default) to use the data files, or "kv" for the embedded store
+	StoreFileLocation        string       `json:"StoreFileLocation"`        // file used by the kv storage backend
+	JournalFileLocation      string       `json:"JournalFileLocation"`      // change journal used for undo/history and crash recovery (disabled if empty)
+	HistoryFileLocation      string       `json:"HistoryFileLocation"`      // prompt input history, kept across sessions (not kept if empty)
+	SavedQueriesFileLocation string       `json:"SavedQueriesFileLocation"` // queries saved with :save (not kept across sessions if empty)
+	MatchOptions             MatchOptions `json:"MatchOptions"`             // how string values are compared by default when searching
+	Color                    string       `json:"Color"`                    // "always" or "never" to color search results, or "auto" (default) for terminals without NO_COLOR set
+	SLA                      SLAOptions   `json:"SLA"`                      // the time tickets' due dates are compared with, and the window in which they are due soon
+
+	// text/template files formatting each record of search results, in place of the built-in format (if not empty)
+	OrgTemplateFileLocation    string `json:"OrgTemplateFileLocation"`
+	UserTemplateFileLocation   string `json:"UserTemplateFileLocation"`
+	TicketTemplateFileLocation string `json:"TicketTemplateFileLocation"`
 }
 
+// maximum number of schema violations logged for each data file on startup
+const maxReportedSchemaViolations = 10
+
 // -------------------- data indexing functions --------------------
 
 // indexOrgUsers builds a map mapping organization ID's to users, enabling fast retrieval of all users belonging to a specific org
@@ -233,6 +615,35 @@ func indexOrgUsers(UserList []User) map[int][]User {
 	return orgUserIndex
 }
 
+// indexOrgDomains builds a map mapping (lower-cased) domain names to organizations, enabling fast retrieval of the org(s) an email domain belongs to
+func indexOrgDomains(OrgList []Organization) map[string][]Organization {
+	orgDomainIndex := map[string][]Organization{}
+
+	for _, org := range OrgList {
+		for _, domain := range orgDomains(org) {
+			orgDomainIndex[domain] = append(orgDomainIndex[domain], org)
+		}
+	}
+
+	return orgDomainIndex
+}
+
+// orgDomains returns the distinct domain names of an organization, lower-cased
+func orgDomains(org Organization) []string {
+	domains := []string{}
+	seen := map[string]bool{}
+
+	for _, domain := range org.DomainNames {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
+
 // indexOrgTickets builds a map mapping organization ID's to tickets, enabling fast retrieval of all tickets belonging to a specific org
 func indexOrgTickets(TicketList []Ticket) map[int][]Ticket {
 	ticketUserIndex := map[int][]Ticket{}
@@ -303,7 +714,24 @@ func indexUsers(UserList []User) map[int]User {
 // -------------------- primary type search functions (orgs/users/tickets) --------------------
 
 func SearchOrgs(searchField, searchValue string, OrgList []Organization) ([]Organization, error) {
+	return SearchOrgsWithOptions(searchField, searchValue, OrgList, MatchOptions{})
+}
+
+// SearchOrgsWithOptions compares string values using the given matching options (e.g. ignoring case)
+func SearchOrgsWithOptions(searchField, searchValue string, OrgList []Organization, opts MatchOptions) ([]Organization, error) {
 	results := []Organization{}
+
+	// searching custom attributes (unknown fields retained from the data file)
+	if strings.HasPrefix(searchField, customFieldPrefix) {
+		for _, org := range OrgList {
+			if org.Custom.MatchesWithOptions(strings.TrimPrefix(searchField, customFieldPrefix), searchValue, opts) {
+				results = append(results, org)
+			}
+		}
+
+		return results, nil
+	}
+
 	for _, org := range OrgList {
 		val, err := reflections.GetField(org, searchField)
 		if err != nil {
@@ -319,7 +747,7 @@ func SearchOrgs(searchField, searchValue string, OrgList []Organization) ([]Orga
 
 		// searching string fields
 		if searchFieldType == "string" {
-			if val == searchValue {
+			if opts.Equal(val.(string), searchValue) {
 				results = append(results, org)
 			}
 		}
@@ -339,7 +767,7 @@ func SearchOrgs(searchField, searchValue string, OrgList []Organization) ([]Orga
 			valStrComps := strings.Split(valStr, " ")
 
 			for _, v := range valStrComps {
-				if v == searchValue {
+				if opts.Equal(v, searchValue) {
 					results = append(results, org)
 				}
 			}
@@ -386,7 +814,24 @@ func SearchOrgs(searchField, searchValue string, OrgList []Organization) ([]Orga
 }
 
 func SearchUsers(searchField, searchValue string, UserList []User) ([]User, error) {
+	return SearchUsersWithOptions(searchField, searchValue, UserList, MatchOptions{})
+}
+
+// SearchUsersWithOptions compares string values using the given matching options (e.g. ignoring case)
+func SearchUsersWithOptions(searchField, searchValue string, UserList []User, opts MatchOptions) ([]User, error) {
 	results := []User{}
+
+	// searching custom attributes (unknown fields retained from the data file)
+	if strings.HasPrefix(searchField, customFieldPrefix) {
+		for _, user := range UserList {
+			if user.Custom.MatchesWithOptions(strings.TrimPrefix(searchField, customFieldPrefix), searchValue, opts) {
+				results = append(results, user)
+			}
+		}
+
+		return results, nil
+	}
+
 	for _, user := range UserList {
 		val, err := reflections.GetField(user, searchField)
 		if err != nil {
@@ -402,7 +847,7 @@ func SearchUsers(searchField, searchValue string, UserList []User) ([]User, erro
 
 		// searching string fields
 		if searchFieldType == "string" {
-			if val == searchValue {
+			if opts.Equal(val.(string), searchValue) {
 				results = append(results, user)
 			}
 		}
@@ -422,7 +867,7 @@ func SearchUsers(searchField, searchValue string, UserList []User) ([]User, erro
 			valStrComps := strings.Split(valStr, " ")
 
 			for _, v := range valStrComps {
-				if v == searchValue {
+				if opts.Equal(v, searchValue) {
 					results = append(results, user)
 				}
 			}
@@ -468,7 +913,24 @@ func SearchUsers(searchField, searchValue string, UserList []User) ([]User, erro
 }
 
 func SearchTickets(searchField, searchValue string, TicketList []Ticket) ([]Ticket, error) {
+	return SearchTicketsWithOptions(searchField, searchValue, TicketList, MatchOptions{})
+}
+
+// SearchTicketsWithOptions compares string values using the given matching options (e.g. ignoring case)
+func SearchTicketsWithOptions(searchField, searchValue string, TicketList []Ticket, opts MatchOptions) ([]Ticket, error) {
 	results := []Ticket{}
+
+	// searching custom attributes (unknown fields retained from the data file)
+	if strings.HasPrefix(searchField, customFieldPrefix) {
+		for _, ticket := range TicketList {
+			if ticket.Custom.MatchesWithOptions(strings.TrimPrefix(searchField, customFieldPrefix), searchValue, opts) {
+				results = append(results, ticket)
+			}
+		}
+
+		return results, nil
+	}
+
 	for _, ticket := range TicketList {
 		val, err := reflections.GetField(ticket, searchField)
 		if err != nil {
@@ -484,7 +946,7 @@ func SearchTickets(searchField, searchValue string, TicketList []Ticket) ([]Tick
 
 		// searching string fields
 		if searchFieldType == "string" {
-			if val == searchValue {
+			if opts.Equal(val.(string), searchValue) {
 				results = append(results, ticket)
 			}
 		}
@@ -505,7 +967,7 @@ func SearchTickets(searchField, searchValue string, TicketList []Ticket) ([]Tick
 			valStrComps := strings.Split(valStr, " ")
 
 			for _, v := range valStrComps {
-				if v == searchValue {
+				if opts.Equal(v, searchValue) {
 					results = append(results, ticket)
 				}
 			}
@@ -635,142 +1097,354 @@ func getAssociatedUsersAndOrgs(tickets []Ticket, userIndex map[int]User, orgInde
 
 // ----------------------- result formatting functions -----------------------------
 
-func FormatOrgResult(orgs []Organization) string {
-	var formattedResult strings.Builder
-	formattedResult.WriteString("\nORGS\n----\n")
+// resultField is a field of a record, as it is shown in search results
+type resultField struct {
+	Name  string // the field searched on to match it, e.g. Created_at (or custom.<path> for a custom attribute)
+	Label string // e.g. Created At
+	Value string
+}
 
-	if len(orgs) <= 0 {
-		formattedResult.WriteString("<No results found>\n")
-		return formattedResult.String()
+// orgResultFields returns the fields of an org shown in search results, in order
+func orgResultFields(org Organization) []resultField {
+	return []resultField{
+		{"ID", "Organization ID", fmt.Sprintf("%d", org.ID)},
+		{"Name", "Name", org.Name},
+		{"URL", "URLs", org.URL},
+		{"External_id", "External_ID", org.External_id},
+		{"DomainNames", "Domain Names", fmt.Sprintf("%s", org.DomainNames)},
+		{"Created_at", "Created At", org.Created_at},
+		{"Details", "Details", org.Details},
+		{"Shared_tickets", "Shared Tickets", fmt.Sprintf("%v", org.Shared_tickets)},
+		{"Tags", "Tags", fmt.Sprintf("%v", org.Tags)},
 	}
+}
 
-	for _, org := range orgs {
-		formattedResult.WriteString(fmt.Sprintf("\nOrganization ID: %d\nName: %s\nURLs: %s\nExternal_ID: %s\nDomain Names: %s\nCreated At: %s\nDetails:  %s\nShared Tickets: %v\nTags: %v\n\n", org.ID, org.Name, org.URL, org.External_id, org.DomainNames, org.Created_at, org.Details, org.Shared_tickets, org.Tags))
+// userResultFields returns the fields of a user shown in search results, in order
+func userResultFields(user User) []resultField {
+	return []resultField{
+		{"ID", "ID", fmt.Sprintf("%d", user.ID)},
+		{"Name", "Name", user.Name},
+		{"URL", "URL", user.URL},
+		{"External_id", "External ID", user.External_id},
+		{"Alias", "Alias", user.Alias},
+		{"Created_at", "Created At", user.Created_at},
+		{"Active", "Active", fmt.Sprintf("%v", user.Active)},
+		{"Verified", "Verified", fmt.Sprintf("%v", user.Verified)},
+		{"Shared", "Shared", fmt.Sprintf("%v", user.Shared)},
+		{"Locale", "Locale", user.Locale},
+		{"Timezone", "Time Zone", user.Timezone},
+		{"Last_login_at", "Last Login At", user.Last_login_at},
+		{"Email", "Email", user.Email},
+		{"Phone", "Phone", user.Phone},
+		{"Signature", "Signature", user.Signature},
+		{"Tags", "Tags", fmt.Sprintf("%v", user.Tags)},
+		{"Suspended", "Suspended", fmt.Sprintf("%v", user.Suspended)},
+		{"Role", "Role", user.Role},
+		{"Org", "Organization", fmt.Sprintf("%d", user.Org)},
+	}
+}
 
-		formattedResult.WriteString("\tASSOCIATED USERS\n\t----------------\n")
-		if len(org.AssociatedUsers) > 0 {
-			for _, user := range org.AssociatedUsers {
-				formattedResult.WriteString(fmt.Sprintf("\n\tID: %d\n\tName: %s\n\tURL: %s\n\tExternal ID: %s\n\tAlias: %s\n\tCreated At: %s\n\tActive: %v\n\tVerified: %v\n\tShared: %v\n\tLocale: %s\n\tTime Zone: %s\n\tLast Login At: %s\n\tEmail: %s\n\tPhone: %s\n\tSignature: %s\n\tTags: %v\n\tSuspended: %v\n\tRole: %s\n\tOrganization: %d\n\n", user.ID, user.Name, user.URL, user.External_id, user.Alias, user.Created_at, user.Active, user.Verified, user.Shared, user.Locale, user.Timezone, user.Last_login_at, user.Email, user.Phone, user.Signature, user.Tags, user.Suspended, user.Role, user.Org))
-			}
-		} else {
-			formattedResult.WriteString("\t<No associated users found for this organization>\n")
-		}
+// ticketResultFields returns the fields of a ticket shown in search results, in order
+func ticketResultFields(ticket Ticket) []resultField {
+	return []resultField{
+		{"ID", "Ticket ID", ticket.ID},
+		{"URL", "URL", ticket.URL},
+		{"External_id", "External ID", ticket.External_id},
+		{"Created_at", "Created At", ticket.Created_at},
+		{"Priority", "Priority", ticket.Priority},
+		{"Status", "Status", ticket.Status},
+		{"Type", "Type", ticket.Type},
+		{"Subject", "Subject", ticket.Subject},
+		{"Description", "Description", ticket.Description},
+		{"Tags", "Tags", fmt.Sprintf("%v", ticket.Tags)},
+		{"Org", "Organization", fmt.Sprintf("%d", ticket.Org)},
+		{"Has_incidents", "Has Incidents", fmt.Sprintf("%v", ticket.Has_incidents)},
+		{"Due_at", "Due At", ticket.Due_at},
+		{"Submitter", "Submitter", fmt.Sprintf("%d", ticket.Submitter)},
+		{"Assignee", "Assignee", fmt.Sprintf("%d", ticket.Assignee)},
+		{"Via", "Via", ticket.Via},
+	}
+}
 
-		formattedResult.WriteString("\n\tASSOCIATED TICKETS\n\t------------------\n")
-		if len(org.AssociatedTickets) > 0 {
-			for _, ticket := range org.AssociatedTickets {
-				formattedResult.WriteString(fmt.Sprintf("\n\tTicket ID: %s\n\tURL: %s\n\tExternal ID: %s\n\tCreated At: %s\n\tPriority: %s\n\tStatus: %s\n\tType: %s\n\tSubject: %s\n\tDescription: %s\n\tTags: %v\n\tOrganization: %d\n\tHas Incidents: %v\n\tDue At: %s\n\tSubmitter: %d\n\tAssignee: %d\n\tVia: %s\n\n", ticket.ID, ticket.URL, ticket.External_id, ticket.Created_at, ticket.Priority, ticket.Status, ticket.Type, ticket.Subject, ticket.Description, ticket.Tags, ticket.Org, ticket.Has_incidents, ticket.Due_at, ticket.Submitter, ticket.Assignee, ticket.Via))
-			}
-		} else {
-			formattedResult.WriteString("\t<No associated tickets found for this organization>\n")
+// resultFormatter writes search results in the built-in format, styled by an output style (see OutputStyle)
+type resultFormatter struct {
+	result SearchResult
+	style  OutputStyle
+	output strings.Builder
+}
+
+// FormatStyledSearchResult outputs search results in the built-in format, in the given style (e.g. colored): each record
+// matching the search, with its associated records
+func FormatStyledSearchResult(result SearchResult, style OutputStyle) string {
+	formatter := &resultFormatter{result: result, style: style}
+
+	titles := map[string]string{"org": "ORGS", "user": "USERS"}
+	title, found := titles[result.SearchType]
+	if !found {
+		title = "TICKETS"
+	}
+	formatter.output.WriteString("\n")
+	formatter.header("", title)
+
+	records := searchRecords(result)
+	if len(records) <= 0 {
+		formatter.note("", "<No results found>")
+	}
+
+	for _, record := range records {
+		switch record := record.(type) {
+		case Organization:
+			formatter.org(record)
+		case User:
+			formatter.user(record)
+		case Ticket:
+			formatter.ticket(record)
 		}
 	}
 
-	return formattedResult.String()
+	return formatter.output.String()
+}
+
+func FormatOrgResult(orgs []Organization) string {
+	return FormatSearchResult(SearchResult{SearchType: "org", Orgs: orgs})
 }
 
 func FormatUserResult(users []User) string {
-	var formattedResult strings.Builder
-	formattedResult.WriteString("\nUSERS\n-----\n")
+	return FormatSearchResult(SearchResult{SearchType: "user", Users: users})
+}
 
-	if len(users) <= 0 {
-		formattedResult.WriteString("<No results found>\n")
-		return formattedResult.String()
-	}
+func FormatTicketResult(tickets []Ticket) string {
+	return FormatSearchResult(SearchResult{SearchType: "ticket", Tickets: tickets})
+}
 
-	for _, user := range users {
-		formattedResult.WriteString(fmt.Sprintf("\nID: %d\nName: %s\nURL: %s\nExternal ID: %s\nAlias: %s\nCreated At: %s\nActive: %v\nVerified: %v\nShared: %v\nLocale: %s\nTime Zone: %s\nLast Login At: %s\nEmail: %s\nPhone: %s\nSignature: %s\nTags: %v\nSuspended: %v\nRole: %s\nOrganization: %d\n\n", user.ID, user.Name, user.URL, user.External_id, user.Alias, user.Created_at, user.Active, user.Verified, user.Shared, user.Locale, user.Timezone, user.Last_login_at, user.Email, user.Phone, user.Signature, user.Tags, user.Suspended, user.Role, user.Org))
+// org writes an org matching the search, with its users and tickets
+func (formatter *resultFormatter) org(org Organization) {
+	formatter.record(append(orgResultFields(org), customResultFields(org.Custom)...))
+
+	formatter.header("\t", "ASSOCIATED USERS")
+	if len(org.AssociatedUsers) <= 0 {
+		formatter.note("\t", "<No associated users found for this organization>")
+	}
+	for _, user := range org.AssociatedUsers {
+		formatter.associated(userResultFields(user))
+	}
 
-		formattedResult.WriteString("\tASSOCIATED ORGS\n\t----------------\n")
+	formatter.output.WriteString("\n")
+	formatter.header("\t", "ASSOCIATED TICKETS")
+	if len(org.AssociatedTickets) <= 0 {
+		formatter.note("\t", "<No associated tickets found for this organization>")
+	}
+	for _, ticket := range org.AssociatedTickets {
+		formatter.associated(ticketResultFields(ticket))
+	}
+}
 
-		formattedResult.WriteString(fmt.Sprintf("\n\tOrganization ID: %d\n\tName: %s\n\tURLs: %s\n\tExternal_ID: %s\n\tDomain Names: %s\n\tCreated At: %s\n\tDetails:  %s\n\tShared Tickets: %v\n\tTags: %v\n\n", user.OrgObject.ID, user.OrgObject.Name, user.OrgObject.URL, user.OrgObject.External_id, user.OrgObject.DomainNames, user.OrgObject.Created_at, user.OrgObject.Details, user.OrgObject.Shared_tickets, user.OrgObject.Tags))
+// user writes a user matching the search, with their org and the tickets they submitted and are assigned
+func (formatter *resultFormatter) user(user User) {
+	formatter.record(append(userResultFields(user), customResultFields(user.Custom)...))
 
-		formattedResult.WriteString("\n\tTICKETS (SUBMITTED)\n\t-------------------\n")
-		if len(user.TicketsSubmitted) > 0 {
-			for _, ticket := range user.TicketsSubmitted {
-				formattedResult.WriteString(fmt.Sprintf("\n\tTicket ID: %s\n\tURL: %s\n\tExternal ID: %s\n\tCreated At: %s\n\tPriority: %s\n\tStatus: %s\n\tType: %s\n\tSubject: %s\n\tDescription: %s\n\tTags: %v\n\tOrganization: %d\n\tHas Incidents: %v\n\tDue At: %s\n\tSubmitter: %d\n\tAssignee: %d\n\tVia: %s\n\n", ticket.ID, ticket.URL, ticket.External_id, ticket.Created_at, ticket.Priority, ticket.Status, ticket.Type, ticket.Subject, ticket.Description, ticket.Tags, ticket.Org, ticket.Has_incidents, ticket.Due_at, ticket.Submitter, ticket.Assignee, ticket.Via))
-			}
-		} else {
-			formattedResult.WriteString("\t<No submitted tickets found for this user>\n")
-		}
+	formatter.header("\t", "ASSOCIATED ORGS")
+	if user.OrgObject.ID == 0 {
+		formatter.unresolved("org", user.Org)
+	} else {
+		formatter.associated(orgResultFields(user.OrgObject))
+	}
 
-		formattedResult.WriteString("\n\tTICKETS (ASSIGNED)\n\t------------------\n")
-		if len(user.TicketsAssigned) > 0 {
-			for _, ticket := range user.TicketsAssigned {
-				formattedResult.WriteString(fmt.Sprintf("\n\tTicket ID: %s\n\tURL: %s\n\tExternal ID: %s\n\tCreated At: %s\n\tPriority: %s\n\tStatus: %s\n\tType: %s\n\tSubject: %s\n\tDescription: %s\n\tTags: %v\n\tOrganization: %d\n\tHas Incidents: %v\n\tDue At: %s\n\tSubmitter: %d\n\tAssignee: %d\n\tVia: %s\n\n", ticket.ID, ticket.URL, ticket.External_id, ticket.Created_at, ticket.Priority, ticket.Status, ticket.Type, ticket.Subject, ticket.Description, ticket.Tags, ticket.Org, ticket.Has_incidents, ticket.Due_at, ticket.Submitter, ticket.Assignee, ticket.Via))
-			}
-		} else {
-			formattedResult.WriteString("\t<No assigned tickets found for this user>\n")
-		}
+	formatter.output.WriteString("\n")
+	formatter.header("\t", "TICKETS (SUBMITTED)")
+	if len(user.TicketsSubmitted) <= 0 {
+		formatter.note("\t", "<No submitted tickets found for this user>")
+	}
+	for _, ticket := range user.TicketsSubmitted {
+		formatter.associated(ticketResultFields(ticket))
 	}
 
-	return formattedResult.String()
+	formatter.output.WriteString("\n")
+	formatter.header("\t", "TICKETS (ASSIGNED)")
+	if len(user.TicketsAssigned) <= 0 {
+		formatter.note("\t", "<No assigned tickets found for this user>")
+	}
+	for _, ticket := range user.TicketsAssigned {
+		formatter.associated(ticketResultFields(ticket))
+	}
 }
 
-func FormatTicketResult(tickets []Ticket) string {
-	var formattedResult strings.Builder
-	formattedResult.WriteString("\nTICKETS\n-------\n")
+// ticket writes a ticket matching the search, with its org, submitter and assignee
+func (formatter *resultFormatter) ticket(ticket Ticket) {
+	formatter.record(append(ticketResultFields(ticket), customResultFields(ticket.Custom)...))
 
-	if len(tickets) <= 0 {
-		formattedResult.WriteString("<No results found>\n")
-		return formattedResult.String()
+	formatter.header("\t", "ASSOCIATED ORGS")
+	if ticket.OrgObj.ID == 0 {
+		formatter.unresolved("org", ticket.Org)
+	} else {
+		formatter.associated(orgResultFields(ticket.OrgObj))
 	}
 
-	for _, ticket := range tickets {
-		formattedResult.WriteString(fmt.Sprintf("\nTicket ID: %s\nURL: %s\nExternal ID: %s\nCreated At: %s\nPriority: %s\nStatus: %s\nType: %s\nSubject: %s\nDescription: %s\nTags: %v\nOrganization: %d\nHas Incidents: %v\nDue At: %s\nSubmitter: %d\nAssignee: %d\nVia: %s\n\n", ticket.ID, ticket.URL, ticket.External_id, ticket.Created_at, ticket.Priority, ticket.Status, ticket.Type, ticket.Subject, ticket.Description, ticket.Tags, ticket.Org, ticket.Has_incidents, ticket.Due_at, ticket.Submitter, ticket.Assignee, ticket.Via))
+	formatter.output.WriteString("\n")
+	formatter.header("\t", "ASSOCIATED USERS (SUBMITTER)")
+	if ticket.SubmitterObj.ID == 0 {
+		formatter.unresolved("user", ticket.Submitter)
+	} else {
+		formatter.associated(userResultFields(ticket.SubmitterObj))
+	}
 
-		formattedResult.WriteString("\tASSOCIATED ORGS\n\t----------------\n")
-		formattedResult.WriteString(fmt.Sprintf("\n\tOrganization ID: %d\n\tName: %s\n\tURLs: %s\n\tExternal ID: %s\n\tDomain Names: %s\n\tCreated At: %s\n\tDetails:  %s\n\tShared Tickets: %v\n\tTags: %v\n\n", ticket.OrgObj.ID, ticket.OrgObj.Name, ticket.OrgObj.URL, ticket.OrgObj.External_id, ticket.OrgObj.DomainNames, ticket.OrgObj.Created_at, ticket.OrgObj.Details, ticket.OrgObj.Shared_tickets, ticket.OrgObj.Tags))
+	formatter.output.WriteString("\n")
+	formatter.header("\t", "ASSOCIATED USERS (ASSIGNEE)")
+	if ticket.AssigneeObj.ID == 0 {
+		formatter.unresolved("user", ticket.Assignee)
+	} else {
+		formatter.associated(userResultFields(ticket.AssigneeObj))
+	}
+}
 
-		formattedResult.WriteString("\n\tASSOCIATED USERS (SUBMITTER)\n\t----------------------------\n")
-		formattedResult.WriteString(fmt.Sprintf("\n\tID: %d\n\tName: %s\n\tURL: %s\n\tExternal ID: %s\n\tAlias: %s\n\tCreated At: %s\n\tActive: %v\n\tVerified: %v\n\tShared: %v\n\tLocale: %s\n\tTime Zone: %s\n\tLast Login At: %s\n\tEmail: %s\n\tPhone: %s\n\tSignature: %s\n\tTags: %v\n\tSuspended: %v\n\tRole: %s\n\tOrganization: %d\n\n", ticket.SubmitterObj.ID, ticket.SubmitterObj.Name, ticket.SubmitterObj.URL, ticket.SubmitterObj.External_id, ticket.SubmitterObj.Alias, ticket.SubmitterObj.Created_at, ticket.SubmitterObj.Active, ticket.SubmitterObj.Verified, ticket.SubmitterObj.Shared, ticket.SubmitterObj.Locale, ticket.SubmitterObj.Timezone, ticket.SubmitterObj.Last_login_at, ticket.SubmitterObj.Email, ticket.SubmitterObj.Phone, ticket.SubmitterObj.Signature, ticket.SubmitterObj.Tags, ticket.SubmitterObj.Suspended, ticket.SubmitterObj.Role, ticket.SubmitterObj.Org))
+// header writes an underlined header, e.g. USERS or ASSOCIATED ORGS
+func (formatter *resultFormatter) header(indent, title string) {
+	formatter.output.WriteString(indent + formatter.style.Header(title) + "\n")
+	formatter.output.WriteString(indent + formatter.style.Muted(strings.Repeat("-", len(title))) + "\n")
+}
+
+// note writes a line in place of missing records, e.g. <No results found>
+func (formatter *resultFormatter) note(indent, text string) {
+	formatter.output.WriteString(indent + formatter.style.Muted(text) + "\n")
+}
 
-		formattedResult.WriteString("\n\tASSOCIATED USERS (ASSIGNEE)\n\t---------------------------\n")
-		formattedResult.WriteString(fmt.Sprintf("\n\tID: %d\n\tName: %s\n\tURL: %s\n\tExternal ID: %s\n\tAlias: %s\n\tCreated At: %s\n\tActive: %v\n\tVerified: %v\n\tShared: %v\n\tLocale: %s\n\tTime Zone: %s\n\tLast Login At: %s\n\tEmail: %s\n\tPhone: %s\n\tSignature: %s\n\tTags: %v\n\tSuspended: %v\n\tRole: %s\n\tOrganization: %d\n\n", ticket.AssigneeObj.ID, ticket.AssigneeObj.Name, ticket.AssigneeObj.URL, ticket.AssigneeObj.External_id, ticket.AssigneeObj.Alias, ticket.AssigneeObj.Created_at, ticket.AssigneeObj.Active, ticket.AssigneeObj.Verified, ticket.AssigneeObj.Shared, ticket.AssigneeObj.Locale, ticket.AssigneeObj.Timezone, ticket.AssigneeObj.Last_login_at, ticket.AssigneeObj.Email, ticket.AssigneeObj.Phone, ticket.AssigneeObj.Signature, ticket.AssigneeObj.Tags, ticket.AssigneeObj.Suspended, ticket.AssigneeObj.Role, ticket.AssigneeObj.Org))
+// unresolved notes an associated entity that could not be found
+func (formatter *resultFormatter) unresolved(entityName string, id int) {
+	formatter.output.WriteString("\n")
+	formatter.note("\t", strings.TrimSpace(formatUnresolvedReference(entityName, id)))
+	formatter.output.WriteString("\n")
+}
+
+// record writes the fields of a record matching the search, marking the field searched on
+func (formatter *resultFormatter) record(fields []resultField) {
+	formatter.output.WriteString("\n")
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, formatter.result.SearchField) {
+			formatter.output.WriteString(formatter.style.SearchedLabel(field.Label) + ": " + formatter.style.SearchedValue(field.Value, formatter.result) + "\n")
+			continue
+		}
+		formatter.field("", field)
 	}
+	formatter.output.WriteString("\n")
+}
 
-	return formattedResult.String()
+// associated writes the fields of an associated record, indented
+func (formatter *resultFormatter) associated(fields []resultField) {
+	formatter.output.WriteString("\n")
+	for _, field := range fields {
+		formatter.field("\t", field)
+	}
+	formatter.output.WriteString("\n")
+}
+
+// field writes a field, muting empty values
+func (formatter *resultFormatter) field(indent string, field resultField) {
+	line := field.Label + ": " + field.Value
+	if field.Value == "" || field.Value == "[]" {
+		line = formatter.style.Muted(line)
+	}
+	formatter.output.WriteString(indent + line + "\n")
+}
+
+// formatUnresolvedReference describes an associated entity that could not be found, rather than printing a zero-value struct
+func formatUnresolvedReference(entityName string, id int) string {
+	if id == 0 {
+		return fmt.Sprintf("\n\t<No %s referenced>\n\n", entityName)
+	}
+
+	return fmt.Sprintf("\n\t<unknown %s %d>\n\n", entityName, id)
 }
 
 // -------------------- data loader functions --------------------------
 
 // ReadUserData reads in user data from a given file, and returns a list of User objects (and an error if required)
 func ReadUserData(fileName string) ([]User, error) {
+	userList, _, err := ReadUserDataWithSchema(fileName, nil)
+	return userList, err
+}
+
+// ReadUserDataWithSchema reads in user data from a given file, validating each record against a schema (if not nil), and returns
+// a list of User objects along with any schema violations found (and an error if required)
+func ReadUserDataWithSchema(fileName string, schema *Schema) ([]User, []SchemaViolation, error) {
 	userData, _ := ioutil.ReadFile(fileName)
 
+	return ParseUserData(filepath.Base(fileName), userData, schema)
+}
+
+// ParseUserData decodes user records from JSON data, validating each record against a schema (if not nil)
+func ParseUserData(sourceName string, userData []byte, schema *Schema) ([]User, []SchemaViolation, error) {
 	var userList []User
-	err := json.Unmarshal(userData, &userList)
+	violations, err := ValidateRecords(sourceName, userData, schema)
+	if err != nil {
+		return userList, violations, err
+	}
+
+	err = json.Unmarshal(userData, &userList)
 	if err != nil {
-		return userList, err
+		return userList, violations, err
 	}
 
-	return userList, nil
+	return userList, violations, nil
 }
 
 // ReadTicketData reads in ticket data from a given file, and returns a list of Ticket objects (and an error if required)
 func ReadTicketData(fileName string) ([]Ticket, error) {
+	ticketList, _, err := ReadTicketDataWithSchema(fileName, nil)
+	return ticketList, err
+}
+
+// ReadTicketDataWithSchema reads in ticket data from a given file, validating each record against a schema (if not nil), and
+// returns a list of Ticket objects along with any schema violations found (and an error if required)
+func ReadTicketDataWithSchema(fileName string, schema *Schema) ([]Ticket, []SchemaViolation, error) {
 	ticketData, _ := ioutil.ReadFile(fileName)
 
+	return ParseTicketData(filepath.Base(fileName), ticketData, schema)
+}
+
+// ParseTicketData decodes ticket records from JSON data, validating each record against a schema (if not nil)
+func ParseTicketData(sourceName string, ticketData []byte, schema *Schema) ([]Ticket, []SchemaViolation, error) {
 	var ticketList []Ticket
-	err := json.Unmarshal(ticketData, &ticketList)
+	violations, err := ValidateRecords(sourceName, ticketData, schema)
 	if err != nil {
-		return ticketList, err
+		return ticketList, violations, err
 	}
 
-	return ticketList, nil
+	err = json.Unmarshal(ticketData, &ticketList)
+	if err != nil {
+		return ticketList, violations, err
+	}
+
+	return ticketList, violations, nil
 }
 
 // ReadOrganizationData reads in organization data from a given file, and returns a list of Organization objects (and an error if required)
 func ReadOrganizationData(fileName string) ([]Organization, error) {
+	orgList, _, err := ReadOrganizationDataWithSchema(fileName, nil)
+	return orgList, err
+}
+
+// ReadOrganizationDataWithSchema reads in organization data from a given file, validating each record against a schema (if not
+// nil), and returns a list of Organization objects along with any schema violations found (and an error if required)
+func ReadOrganizationDataWithSchema(fileName string, schema *Schema) ([]Organization, []SchemaViolation, error) {
 	orgData, _ := ioutil.ReadFile(fileName)
 
+	return ParseOrganizationData(filepath.Base(fileName), orgData, schema)
+}
+
+// ParseOrganizationData decodes organization records from JSON data, validating each record against a schema (if not nil)
+func ParseOrganizationData(sourceName string, orgData []byte, schema *Schema) ([]Organization, []SchemaViolation, error) {
 	var orgList []Organization
-	err := json.Unmarshal(orgData, &orgList)
+	violations, err := ValidateRecords(sourceName, orgData, schema)
 	if err != nil {
-		return orgList, err
+		return orgList, violations, err
 	}
 
-	return orgList, nil
+	err = json.Unmarshal(orgData, &orgList)
+	if err != nil {
+		return orgList, violations, err
+	}
+
+	return orgList, violations, nil
 }
 
 // ---------------------- command line input capture ----------------------------
@@ -807,17 +1481,58 @@ func parseSearchInput(searchInput string) (string, string, string, error) {
 // ------------------------- App config ---------------------------------
 // read application config file and return locations of org/user/data files
 func GetAppConfig() (string, string, string, error) {
-	file, _ := os.Open("config.json")
+	config, err := ReadAppConfig("config.json")
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return config.OrgFileLocation, config.UserFileLocation, config.TicketFileLocation, nil
+}
+
+// ReadAppConfig reads the full application config from a given file
+func ReadAppConfig(fileName string) (AppConfig, error) {
+	file, _ := os.Open(fileName)
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
 	config := AppConfig{}
 	err := decoder.Decode(&config)
 	if err != nil {
-		return "", "", "", err
+		return config, err
 	}
 
-	return config.OrgFileLocation, config.UserFileLocation, config.TicketFileLocation, nil
+	if err := config.MatchOptions.Validate(); err != nil {
+		return config, err
+	}
+
+	return config, config.SLA.Validate()
+}
+
+// loadSchemaIfSet loads a schema file if a location has been configured, returning nil otherwise
+func loadSchemaIfSet(fileName string) (*Schema, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+
+	return LoadSchema(fileName)
+}
+
+// reportSchemaViolations logs any schema violations found in a data file, returning true if there were any
+func reportSchemaViolations(fileName string, violations []SchemaViolation) bool {
+	if len(violations) <= 0 {
+		return false
+	}
+
+	log.Printf("%d schema violation(s) in %s:", len(violations), fileName)
+	for i, violation := range violations {
+		if i >= maxReportedSchemaViolations {
+			log.Printf("\t... and %d more", len(violations)-maxReportedSchemaViolations)
+			break
+		}
+		log.Printf("\t%s", violation)
+	}
+
+	return true
 }
 
 // ----------------- reflect functions to get struct field types at runtime --------------------
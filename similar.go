@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -------------------- similar ticket recommendations --------------------
+
+// number of similar tickets listed by default
+const defaultSimilarTickets = 5
+
+// maximum number of shared words/tags listed when explaining a match
+const maxSimilarityExamples = 5
+
+// minimum subject/description similarity (0-1) counted towards a match, so that sharing only common words (e.g. "in") isn't
+// reported as a reason for a match
+const minTextSimilarity = 0.01
+
+// weights of the similarity components, adding up to 1
+const (
+	similarSubjectWeight     = 0.35
+	similarDescriptionWeight = 0.25
+	similarTagWeight         = 0.2
+	similarOrgWeight         = 0.1
+	similarTypeWeight        = 0.1
+)
+
+// SimilarTicket is a ticket scored by its similarity to another ticket (0-1), with the reasons it matched
+type SimilarTicket struct {
+	Ticket  Ticket
+	Score   float64
+	Reasons []string
+}
+
+// ticketWords returns the distinct words of a text, normalized as for fuzzy matching. Single letters are left out.
+func ticketWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.Fields(normalizeFuzzyText(text)) {
+		if len([]rune(word)) > 1 {
+			words[word] = true
+		}
+	}
+
+	return words
+}
+
+// wordWeights returns the inverse document frequency of each word across the texts, so that words common to many tickets
+// (e.g. "in") count for less than rare ones
+func wordWeights(texts []map[string]bool) map[string]float64 {
+	counts := map[string]int{}
+	for _, words := range texts {
+		for word := range words {
+			counts[word]++
+		}
+	}
+
+	weights := map[string]float64{}
+	for word, count := range counts {
+		weights[word] = math.Log(float64(len(texts)+1) / float64(count))
+	}
+
+	return weights
+}
+
+// weightedOverlap returns the weighted Jaccard similarity of two word sets (total weight of shared words over total weight
+// of all words), along with the shared words, most significant first
+func weightedOverlap(a, b map[string]bool, weights map[string]float64) (float64, []string) {
+	shared := []string{}
+	sharedWeight, totalWeight := 0.0, 0.0
+
+	for word := range a {
+		totalWeight += weights[word]
+		if b[word] {
+			shared = append(shared, word)
+			sharedWeight += weights[word]
+		}
+	}
+	for word := range b {
+		if !a[word] {
+			totalWeight += weights[word]
+		}
+	}
+
+	sort.Slice(shared, func(i, j int) bool {
+		if weights[shared[i]] != weights[shared[j]] {
+			return weights[shared[i]] > weights[shared[j]]
+		}
+		return shared[i] < shared[j]
+	})
+
+	if totalWeight <= 0 {
+		return 0, shared
+	}
+
+	return sharedWeight / totalWeight, shared
+}
+
+// sharedTags returns the tags two tickets have in common (compared ignoring case), and the Jaccard similarity of their tags
+func sharedTags(a, b []string) (float64, []string) {
+	tagsA := map[string]bool{}
+	for _, tag := range a {
+		tagsA[looseMatchOptions.Normalize(tag)] = true
+	}
+
+	shared := []string{}
+	union := len(tagsA)
+	seen := map[string]bool{}
+	for _, tag := range b {
+		normalized := looseMatchOptions.Normalize(tag)
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+
+		if tagsA[normalized] {
+			shared = append(shared, tag)
+		} else {
+			union++
+		}
+	}
+
+	if union <= 0 {
+		return 0, shared
+	}
+
+	return float64(len(shared)) / float64(union), shared
+}
+
+// listExamples joins up to maxSimilarityExamples values for display
+func listExamples(values []string) string {
+	if len(values) > maxSimilarityExamples {
+		return strings.Join(values[:maxSimilarityExamples], ", ") + ", ..."
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// SimilarTickets scores every other ticket by its similarity to the given ticket (subject and description text, shared
+// tags, same org and same type) and returns the top n, most similar first. Tickets with nothing in common are left out.
+func (data *Dataset) SimilarTickets(id string, n int) ([]SimilarTicket, error) {
+	target, found := data.GetTicket(id)
+	if !found {
+		return nil, fmt.Errorf("No ticket found with ID %s", id)
+	}
+
+	subjects := make([]map[string]bool, len(data.TicketList))
+	descriptions := make([]map[string]bool, len(data.TicketList))
+	for i, ticket := range data.TicketList {
+		subjects[i] = ticketWords(ticket.Subject)
+		descriptions[i] = ticketWords(ticket.Description)
+	}
+	subjectWeights, descriptionWeights := wordWeights(subjects), wordWeights(descriptions)
+	targetSubject, targetDescription := ticketWords(target.Subject), ticketWords(target.Description)
+
+	similar := []SimilarTicket{}
+	for i, ticket := range data.TicketList {
+		if ticket.ID == target.ID {
+			continue
+		}
+
+		match := SimilarTicket{Ticket: ticket}
+
+		if score, words := weightedOverlap(targetSubject, subjects[i], subjectWeights); score >= minTextSimilarity {
+			match.Score += similarSubjectWeight * score
+			match.Reasons = append(match.Reasons, fmt.Sprintf("subject %.0f%% similar (shared words: %s)", 100*score, listExamples(words)))
+		}
+
+		if score, words := weightedOverlap(targetDescription, descriptions[i], descriptionWeights); score >= minTextSimilarity {
+			match.Score += similarDescriptionWeight * score
+			match.Reasons = append(match.Reasons, fmt.Sprintf("description %.0f%% similar (shared words: %s)", 100*score, listExamples(words)))
+		}
+
+		if score, tags := sharedTags(target.Tags, ticket.Tags); len(tags) > 0 {
+			match.Score += similarTagWeight * score
+			match.Reasons = append(match.Reasons, fmt.Sprintf("%d shared tag(s): %s", len(tags), listExamples(tags)))
+		}
+
+		if target.Org != 0 && ticket.Org == target.Org {
+			match.Score += similarOrgWeight
+			match.Reasons = append(match.Reasons, fmt.Sprintf("same org (%d)", ticket.Org))
+		}
+
+		if target.Type != "" && ticket.Type == target.Type {
+			match.Score += similarTypeWeight
+			match.Reasons = append(match.Reasons, fmt.Sprintf("same type (%s)", ticket.Type))
+		}
+
+		if match.Score > 0 {
+			similar = append(similar, match)
+		}
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Score > similar[j].Score
+	})
+
+	if len(similar) > n {
+		similar = similar[:n]
+	}
+
+	return similar, nil
+}
+
+// parseSimilarCommand parses a similar tickets command: similar ticket <id> [<number of tickets>], returning false if the
+// input isn't a similar tickets command
+func parseSimilarCommand(input string) (string, int, bool, error) {
+	fields := strings.Fields(input)
+	if len(fields) <= 0 || strings.ToLower(fields[0]) != "similar" {
+		return "", 0, false, nil
+	}
+
+	if len(fields) < 3 || len(fields) > 4 || strings.ToLower(fields[1]) != "ticket" {
+		return "", 0, true, errors.New("Invalid similar format. Format: $> similar ticket <id> [<number of tickets>]")
+	}
+
+	n := defaultSimilarTickets
+	if len(fields) == 4 {
+		var err error
+		n, err = strconv.Atoi(fields[3])
+		if err != nil || n <= 0 {
+			return "", 0, true, fmt.Errorf("Invalid number of tickets: %s", fields[3])
+		}
+	}
+
+	return fields[2], n, true, nil
+}
+
+// FormatSimilarTickets outputs similar tickets in a human-readable format, with the reasons each matched
+func FormatSimilarTickets(target Ticket, similar []SimilarTicket) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nSIMILAR TICKETS\n---------------\n")
+	formattedResult.WriteString(fmt.Sprintf("Ticket %s: %s\n", target.ID, target.Subject))
+
+	if len(similar) <= 0 {
+		formattedResult.WriteString("<No similar tickets found>\n")
+		return formattedResult.String()
+	}
+
+	for i, match := range similar {
+		formattedResult.WriteString(fmt.Sprintf("\n%d. [%.2f] %s: %s\n", i+1, match.Score, match.Ticket.ID, match.Ticket.Subject))
+		for _, reason := range match.Reasons {
+			formattedResult.WriteString(fmt.Sprintf("\t- %s\n", reason))
+		}
+	}
+
+	return formattedResult.String()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimilarTickets(t *testing.T) {
+	data := loadTestDataset(t)
+
+	target, _ := data.GetTicket("436bf9b0-1147-4c0a-8439-6f79833bff5b")
+
+	// a copy of the ticket should be the best match, for every reason
+	duplicate := target
+	duplicate.ID = "00000000-0000-0000-0000-000000000001"
+	data.UpsertTicket(duplicate)
+
+	similar, err := data.SimilarTickets(target.ID, 3)
+	if err != nil {
+		t.Fatalf("TestSimilarTickets: unexpected error: %v\n", err)
+	}
+
+	if len(similar) != 3 {
+		t.Fatalf("TestSimilarTickets: expected 3 similar tickets, got %d\n", len(similar))
+	}
+
+	if similar[0].Ticket.ID != duplicate.ID || similar[0].Score < 0.99 || len(similar[0].Reasons) != 5 {
+		t.Errorf("TestSimilarTickets: copy of ticket not ranked first with all reasons: %+v\n", similar[0])
+	}
+
+	for i, match := range similar {
+		if match.Ticket.ID == target.ID {
+			t.Error("TestSimilarTickets: ticket listed as similar to itself.\n")
+		}
+		if i > 0 && match.Score > similar[i-1].Score {
+			t.Error("TestSimilarTickets: similar tickets not ordered by score.\n")
+		}
+		if len(match.Reasons) <= 0 {
+			t.Errorf("TestSimilarTickets: no reasons given for ticket %s\n", match.Ticket.ID)
+		}
+	}
+
+	// a ticket sharing only a rare subject word is explained by that word
+	data.UpsertTicket(Ticket{ID: "00000000-0000-0000-0000-000000000002", Subject: "Korea"})
+	similar, _ = data.SimilarTickets(target.ID, len(data.TicketList))
+	found := false
+	for _, match := range similar {
+		if match.Ticket.ID == "00000000-0000-0000-0000-000000000002" {
+			found = len(match.Reasons) == 1 && strings.Contains(match.Reasons[0], "korea")
+		}
+	}
+	if !found {
+		t.Error("TestSimilarTickets: ticket sharing a subject word not matched on it.\n")
+	}
+
+	if _, err := data.SimilarTickets("no-such-ticket", 3); err == nil {
+		t.Error("TestSimilarTickets: expected an error for an unknown ticket.\n")
+	}
+}
+
+func TestParseSimilarCommand(t *testing.T) {
+	id, n, isSimilar, err := parseSimilarCommand("similar ticket abc\n")
+	if !isSimilar || err != nil || id != "abc" || n != defaultSimilarTickets {
+		t.Errorf("TestParseSimilarCommand: unexpected result %s %d %v %v\n", id, n, isSimilar, err)
+	}
+
+	id, n, isSimilar, err = parseSimilarCommand("Similar Ticket abc 10\n")
+	if !isSimilar || err != nil || id != "abc" || n != 10 {
+		t.Errorf("TestParseSimilarCommand: unexpected result %s %d %v %v\n", id, n, isSimilar, err)
+	}
+
+	for _, input := range []string{"similar user 1", "similar ticket", "similar ticket abc 0", "similar ticket abc x"} {
+		if _, _, isSimilar, err := parseSimilarCommand(input); !isSimilar || err == nil {
+			t.Errorf("TestParseSimilarCommand: expected an error for %q\n", input)
+		}
+	}
+
+	if _, _, isSimilar, _ := parseSimilarCommand("ticket Subject similar"); isSimilar {
+		t.Error("TestParseSimilarCommand: search parsed as a similar command.\n")
+	}
+}
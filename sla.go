@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -------------------- ticket SLAs: overdue, due soon and on track tickets --------------------
+
+// prefix of the command reporting the SLAs of tickets: sla [ticket <searchfield> <search value>]
+const slaPrefix = "sla"
+
+// derived ticket field searched for tickets that are (or aren't) overdue: ticket overdue true
+const overdueField = "overdue"
+
+// window before their due dates in which tickets are due soon, if not configured
+const defaultSLADueSoon = 24 * time.Hour
+
+// SLA statuses of tickets, in the order they are reported
+const (
+	slaOverdue   = "overdue"
+	slaDueSoon   = "due soon"
+	slaOnTrack   = "on track"
+	slaNoDueDate = "no due date" // including due dates that can't be parsed
+	slaClosed    = "closed"      // solved or closed tickets, which can't be overdue
+)
+
+var slaStatuses = []string{slaOverdue, slaDueSoon, slaOnTrack, slaNoDueDate, slaClosed}
+
+// ticket statuses for which the ticket's due date no longer applies
+var closedTicketStatuses = []string{"solved", "closed"}
+
+// layouts of the times SLAs can be classified against: the data's date format, RFC 3339 or a date (at midnight UTC)
+var slaTimeLayouts = []string{dataDateLayout, time.RFC3339, "2006-01-02"}
+
+// SLAOptions set the time tickets' due dates are compared with, and how close to their due dates tickets are due soon
+type SLAOptions struct {
+	Now     string `json:"Now"`     // e.g. 2016-08-01T00:00:00 -10:00 or 2016-08-01 (the current time if empty)
+	DueSoon string `json:"DueSoon"` // a duration, e.g. 48h (24h if empty)
+}
+
+// Times returns the time tickets are classified against, and the window before their due dates in which they are due soon
+func (opts SLAOptions) Times() (time.Time, time.Duration, error) {
+	now := time.Now()
+	if opts.Now != "" {
+		parsed, err := parseSLATime(opts.Now)
+		if err != nil {
+			return now, 0, fmt.Errorf("Invalid SLA time: %s (use the data's date format, e.g. 2016-08-01T00:00:00 -10:00, or a date, e.g. 2016-08-01)", opts.Now)
+		}
+		now = parsed
+	}
+
+	dueSoon := defaultSLADueSoon
+	if opts.DueSoon != "" {
+		parsed, err := time.ParseDuration(opts.DueSoon)
+		if err != nil || parsed < 0 {
+			return now, 0, fmt.Errorf("Invalid SLA due soon window: %s (use a duration, e.g. 48h)", opts.DueSoon)
+		}
+		dueSoon = parsed
+	}
+
+	return now, dueSoon, nil
+}
+
+// Validate checks that the time and due soon window can be parsed
+func (opts SLAOptions) Validate() error {
+	_, _, err := opts.Times()
+	return err
+}
+
+// parseSLATime parses a due date, or a time to classify due dates against
+func parseSLATime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range slaTimeLayouts {
+		var parsed time.Time
+		if parsed, err = time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// ClassifyTicketSLA returns the SLA status of a ticket at a time: closed if it is solved or closed, otherwise overdue if its
+// due date has passed, due soon if it is due within the due soon window, or on track
+func ClassifyTicketSLA(ticket Ticket, now time.Time, dueSoon time.Duration) string {
+	for _, status := range closedTicketStatuses {
+		if strings.EqualFold(ticket.Status, status) {
+			return slaClosed
+		}
+	}
+
+	due, err := parseSLATime(ticket.Due_at)
+	switch {
+	case ticket.Due_at == "" || err != nil:
+		return slaNoDueDate
+	case due.Before(now):
+		return slaOverdue
+	case !due.After(now.Add(dueSoon)):
+		return slaDueSoon
+	}
+
+	return slaOnTrack
+}
+
+// FindOverdueTickets returns the tickets that are overdue (or with false, those that aren't) at the dataset's SLA time
+func (data *Dataset) FindOverdueTickets(searchValue string) ([]Ticket, error) {
+	overdue := strings.ToLower(searchValue) == "true"
+	if !overdue && strings.ToLower(searchValue) != "false" {
+		return nil, fmt.Errorf("Invalid search value for boolean field: Ticket.%s is a bool field and search value (%s) must be boolean (true/false)", overdueField, searchValue)
+	}
+
+	now, dueSoon, err := data.SLA.Times()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Ticket{}
+	for _, ticket := range data.TicketList {
+		if (ClassifyTicketSLA(ticket, now, dueSoon) == slaOverdue) == overdue {
+			results = append(results, ticket)
+		}
+	}
+
+	return results, nil
+}
+
+// SLAGroup counts the tickets of each SLA status in a group of tickets (e.g. an org's tickets)
+type SLAGroup struct {
+	Name   string
+	Counts map[string]int
+	Total  int
+}
+
+// SLABreakdown groups tickets by one of their fields
+type SLABreakdown struct {
+	Title  string
+	Groups []SLAGroup
+}
+
+// SLAReport counts tickets by SLA status at a time, in total and broken down by org, assignee, priority and status
+type SLAReport struct {
+	Now        time.Time
+	DueSoon    time.Duration
+	Totals     SLAGroup
+	Breakdowns []SLABreakdown
+}
+
+// parseSLACommand returns the search whose tickets are reported on (empty for all the tickets), and whether the input is
+// an SLA command
+func parseSLACommand(input string) (string, bool) {
+	fields := strings.SplitN(strings.TrimSpace(input), " ", 2)
+	if strings.ToLower(fields[0]) != slaPrefix {
+		return "", false
+	}
+	if len(fields) < 2 {
+		return "", true
+	}
+
+	return strings.TrimSpace(fields[1]), true
+}
+
+// ReportSLAs reports the SLAs of the tickets matching a ticket search, or of all the tickets if the search is empty
+func (data *Dataset) ReportSLAs(search string) (SLAReport, error) {
+	now, dueSoon, err := data.SLA.Times()
+	if err != nil {
+		return SLAReport{}, err
+	}
+
+	tickets := data.TicketList
+	if search != "" {
+		result, err := data.Search(search, nil)
+		if err != nil {
+			return SLAReport{}, err
+		}
+		if result.SearchType != "ticket" {
+			return SLAReport{}, fmt.Errorf("SLAs are reported for tickets: %s [ticket <searchfield> <search value>]", slaPrefix)
+		}
+		tickets = result.Tickets
+	}
+
+	report := SLAReport{Now: now, DueSoon: dueSoon, Totals: SLAGroup{Counts: map[string]int{}}}
+	groupings := []struct {
+		title string
+		name  func(Ticket) string
+	}{
+		{"BY ORG", func(ticket Ticket) string {
+			if org, found := data.GetOrg(ticket.Org); found {
+				return fmt.Sprintf("%s (%d)", org.Name, org.ID)
+			}
+			return strings.TrimSpace(formatUnresolvedReference("org", ticket.Org))
+		}},
+		{"BY ASSIGNEE", func(ticket Ticket) string {
+			if user, found := data.GetUser(ticket.Assignee); found {
+				return fmt.Sprintf("%s (%d)", user.Name, user.ID)
+			}
+			return strings.TrimSpace(formatUnresolvedReference("user", ticket.Assignee))
+		}},
+		{"BY PRIORITY", func(ticket Ticket) string { return ticket.Priority }},
+		{"BY STATUS", func(ticket Ticket) string { return ticket.Status }},
+	}
+
+	groups := make([]map[string]*SLAGroup, len(groupings))
+	for i := range groups {
+		groups[i] = map[string]*SLAGroup{}
+	}
+
+	for _, ticket := range tickets {
+		status := ClassifyTicketSLA(ticket, now, dueSoon)
+		report.Totals.Counts[status]++
+		report.Totals.Total++
+
+		for i, grouping := range groupings {
+			name := grouping.name(ticket)
+			if name == "" {
+				name = "<none>"
+			}
+			group, found := groups[i][name]
+			if !found {
+				group = &SLAGroup{Name: name, Counts: map[string]int{}}
+				groups[i][name] = group
+			}
+			group.Counts[status]++
+			group.Total++
+		}
+	}
+
+	for i, grouping := range groupings {
+		breakdown := SLABreakdown{Title: grouping.title}
+		for _, group := range groups[i] {
+			breakdown.Groups = append(breakdown.Groups, *group)
+		}
+
+		// the groups with the most overdue (then due soon) tickets first
+		sort.Slice(breakdown.Groups, func(a, b int) bool {
+			groupA, groupB := breakdown.Groups[a], breakdown.Groups[b]
+			if groupA.Counts[slaOverdue] != groupB.Counts[slaOverdue] {
+				return groupA.Counts[slaOverdue] > groupB.Counts[slaOverdue]
+			}
+			if groupA.Counts[slaDueSoon] != groupB.Counts[slaDueSoon] {
+				return groupA.Counts[slaDueSoon] > groupB.Counts[slaDueSoon]
+			}
+			return groupA.Name < groupB.Name
+		})
+		report.Breakdowns = append(report.Breakdowns, breakdown)
+	}
+
+	return report, nil
+}
+
+// FormatSLAReport formats an SLA report as a table of counts for each breakdown
+func FormatSLAReport(report SLAReport) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nTICKET SLAS\n-----------\n")
+	formattedResult.WriteString(fmt.Sprintf("As of %s (due soon: within %s of the due date)\n", report.Now.Format(dataDateLayout), report.DueSoon))
+
+	totals := []string{}
+	for _, status := range slaStatuses {
+		totals = append(totals, fmt.Sprintf("%d %s", report.Totals.Counts[status], status))
+	}
+	formattedResult.WriteString(fmt.Sprintf("%d ticket(s): %s\n", report.Totals.Total, strings.Join(totals, ", ")))
+	if report.Totals.Total <= 0 {
+		return formattedResult.String()
+	}
+
+	for _, breakdown := range report.Breakdowns {
+		formattedResult.WriteString(fmt.Sprintf("\n%s\n%s\n", breakdown.Title, strings.Repeat("-", len(breakdown.Title))))
+		formattedResult.WriteString(fmt.Sprintf("%-32s", ""))
+		for _, status := range slaStatuses {
+			formattedResult.WriteString(fmt.Sprintf(" %12s", status))
+		}
+		formattedResult.WriteString(fmt.Sprintf(" %8s\n", "total"))
+
+		for _, group := range breakdown.Groups {
+			formattedResult.WriteString(fitWidth(group.Name, 32))
+			for _, status := range slaStatuses {
+				formattedResult.WriteString(fmt.Sprintf(" %12d", group.Counts[status]))
+			}
+			formattedResult.WriteString(fmt.Sprintf(" %8d\n", group.Total))
+		}
+	}
+
+	return formattedResult.String()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyTicketSLA(t *testing.T) {
+	now, _ := parseSLATime("2016-08-01T00:00:00 +00:00")
+	tests := []struct {
+		ticket   Ticket
+		expected string
+	}{
+		{Ticket{Status: "open", Due_at: "2016-07-31T12:00:00 +00:00"}, slaOverdue},
+		{Ticket{Status: "pending", Due_at: "2016-08-01T12:00:00 +00:00"}, slaDueSoon},
+		{Ticket{Status: "hold", Due_at: "2016-08-03T00:00:00 +00:00"}, slaOnTrack},
+		{Ticket{Status: "open", Due_at: ""}, slaNoDueDate},
+		{Ticket{Status: "open", Due_at: "next week"}, slaNoDueDate},
+		{Ticket{Status: "Solved", Due_at: "2016-07-31T12:00:00 +00:00"}, slaClosed},
+		// the data's dates have time zones: 2016-07-31T20:00:00 -10:00 is 06:00 on 2016-08-01 in UTC
+		{Ticket{Status: "open", Due_at: "2016-07-31T20:00:00 -10:00"}, slaDueSoon},
+	}
+
+	for _, test := range tests {
+		if status := ClassifyTicketSLA(test.ticket, now, 24*time.Hour); status != test.expected {
+			t.Errorf("TestClassifyTicketSLA: %s ticket due %q: expected %s, got %s\n", test.ticket.Status, test.ticket.Due_at, test.expected, status)
+		}
+	}
+}
+
+func TestSLAOptions(t *testing.T) {
+	now, dueSoon, err := SLAOptions{Now: "2016-08-01", DueSoon: "48h"}.Times()
+	if err != nil || now.Format("2006-01-02") != "2016-08-01" || dueSoon != 48*time.Hour {
+		t.Errorf("TestSLAOptions: unexpected times: %v %v (error %v)\n", now, dueSoon, err)
+	}
+
+	if _, dueSoon, _ := (SLAOptions{}).Times(); dueSoon != defaultSLADueSoon {
+		t.Errorf("TestSLAOptions: expected the default due soon window, got %v\n", dueSoon)
+	}
+
+	for _, opts := range []SLAOptions{{Now: "August"}, {DueSoon: "2 days"}, {DueSoon: "-1h"}} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("TestSLAOptions: expected an error for %+v\n", opts)
+		}
+	}
+}
+
+func TestOverdueSearch(t *testing.T) {
+	data := loadTestDataset(t)
+	data.SLA = SLAOptions{Now: "2016-08-01"}
+	now, dueSoon, _ := data.SLA.Times()
+
+	overdue, err := data.Search("ticket overdue true", nil)
+	if err != nil || len(overdue.Tickets) <= 0 {
+		t.Fatalf("TestOverdueSearch: expected overdue tickets (error %v)\n", err)
+	}
+	for _, ticket := range overdue.Tickets {
+		if ClassifyTicketSLA(ticket, now, dueSoon) != slaOverdue {
+			t.Errorf("TestOverdueSearch: ticket %s (%s, due %s) isn't overdue\n", ticket.ID, ticket.Status, ticket.Due_at)
+		}
+	}
+
+	notOverdue, err := data.Search("ticket Overdue false", nil)
+	if err != nil || len(overdue.Tickets)+len(notOverdue.Tickets) != len(data.TicketList) {
+		t.Errorf("TestOverdueSearch: overdue and not overdue tickets don't add up (error %v)\n", err)
+	}
+
+	if _, err := data.Search("ticket overdue soon", nil); err == nil {
+		t.Errorf("TestOverdueSearch: expected an error for a non-boolean value\n")
+	}
+}
+
+func TestReportSLAs(t *testing.T) {
+	data := loadTestDataset(t)
+	data.SLA = SLAOptions{Now: "2016-08-01"}
+
+	report, err := data.ReportSLAs("")
+	if err != nil {
+		t.Fatalf("TestReportSLAs: unexpected error: %v\n", err)
+	}
+	if report.Totals.Total != len(data.TicketList) || len(report.Breakdowns) != 4 {
+		t.Fatalf("TestReportSLAs: unexpected report: %+v\n", report.Totals)
+	}
+	for _, breakdown := range report.Breakdowns {
+		total := 0
+		for i, group := range breakdown.Groups {
+			total += group.Total
+			if i > 0 && group.Counts[slaOverdue] > breakdown.Groups[i-1].Counts[slaOverdue] {
+				t.Errorf("TestReportSLAs: %s groups not sorted by overdue tickets\n", breakdown.Title)
+			}
+		}
+		if total != len(data.TicketList) {
+			t.Errorf("TestReportSLAs: %s groups count %d tickets, expected %d\n", breakdown.Title, total, len(data.TicketList))
+		}
+	}
+
+	urgent, err := data.ReportSLAs("ticket Priority urgent")
+	if err != nil || urgent.Totals.Total <= 0 || urgent.Totals.Total >= report.Totals.Total || len(urgent.Breakdowns[2].Groups) != 1 {
+		t.Errorf("TestReportSLAs: unexpected report of urgent tickets: %+v (error %v)\n", urgent.Totals, err)
+	}
+
+	if _, err := data.ReportSLAs("user Role admin"); err == nil {
+		t.Errorf("TestReportSLAs: expected an error for a user search\n")
+	}
+
+	formatted := FormatSLAReport(report)
+	for _, expected := range []string{"TICKET SLAS", "As of 2016-08-01T00:00:00 +00:00", "BY ORG", "BY ASSIGNEE", "BY PRIORITY", "BY STATUS", "overdue"} {
+		if !strings.Contains(formatted, expected) {
+			t.Errorf("TestReportSLAs: expected %q in: %s\n", expected, formatted)
+		}
+	}
+}
+
+func TestParseSLACommand(t *testing.T) {
+	if search, isSLACommand := parseSLACommand("SLA"); !isSLACommand || search != "" {
+		t.Errorf("TestParseSLACommand: unexpected parse: %q %v\n", search, isSLACommand)
+	}
+	if search, isSLACommand := parseSLACommand("sla ticket Priority high"); !isSLACommand || search != "ticket Priority high" {
+		t.Errorf("TestParseSLACommand: unexpected parse: %q %v\n", search, isSLACommand)
+	}
+	if _, isSLACommand := parseSLACommand("slack"); isSLACommand {
+		t.Errorf("TestParseSLACommand: slack isn't an SLA command\n")
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// -------------------- storage backends --------------------
+
+// Store is a storage backend that org/user/ticket data is loaded from, and changes to the data are persisted to
+type Store interface {
+	// Load returns all stored orgs, users and tickets
+	Load() ([]Organization, []User, []Ticket, error)
+
+	// Commit persists the records with the given IDs, as they now are in the dataset (records no longer in the dataset are removed)
+	Commit(data *Dataset, changes ChangeSet) error
+
+	Close() error
+}
+
+// IndexedStore is a storage backend that also persists the relationship indexes of its records, so they can be loaded along
+// with the records rather than rebuilt
+type IndexedStore interface {
+	Store
+
+	// LoadDataset returns all stored orgs, users and tickets, with their indexes
+	LoadDataset() (*Dataset, error)
+}
+
+// LoadDataset loads the data from a store, with its indexes loaded from the store if it persists them (or built otherwise)
+func LoadDataset(store Store) (*Dataset, error) {
+	if indexedStore, indexed := store.(IndexedStore); indexed {
+		return indexedStore.LoadDataset()
+	}
+
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDataset(OrgList, UserList, TicketList), nil
+}
+
+// errReadOnlyStore is returned when committing changes to data that was loaded from a source that can't be written back to
+var errReadOnlyStore = errors.New("Data source is read-only (imported from the Zendesk API), changes only apply until exit")
+
+// OpenStore opens the storage backend set in the app config: "json" (the default) for the flat JSON data files, or "kv" for
+// the embedded key/value store. A new key/value store is populated from the JSON data files (or API import) on first use.
+func OpenStore(config AppConfig) (Store, error) {
+	jsonStore, err := NewJSONStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.StorageBackend {
+	case "", "json":
+		return jsonStore, nil
+
+	case "kv":
+		kvStore, err := OpenKVStore(config.StoreFileLocation)
+		if err != nil {
+			return nil, err
+		}
+
+		if kvStore.Empty() {
+			log.Printf("Populating %s from data files..", config.StoreFileLocation)
+			OrgList, UserList, TicketList, err := jsonStore.Load()
+			if err != nil {
+				kvStore.Close()
+				return nil, err
+			}
+
+			err = kvStore.Import(OrgList, UserList, TicketList)
+			if err != nil {
+				kvStore.Close()
+				return nil, err
+			}
+		}
+
+		return kvStore, nil
+	}
+
+	return nil, fmt.Errorf("Unknown storage backend: %s (must be json or kv)", config.StorageBackend)
+}
+
+// JSONStore loads data from the org/user/ticket JSON data files (or a Zendesk API import), validating records against any
+// configured schemas. Changes are persisted by updating the changed records in the data files.
+type JSONStore struct {
+	config       AppConfig
+	orgSchema    *Schema
+	userSchema   *Schema
+	ticketSchema *Schema
+}
+
+// NewJSONStore creates a store for the data files in the app config, loading any schemas configured for them
+func NewJSONStore(config AppConfig) (*JSONStore, error) {
+	store := &JSONStore{config: config}
+	var err error
+
+	store.orgSchema, err = loadSchemaIfSet(config.OrgSchemaFileLocation)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading org schema file: %v", err)
+	}
+
+	store.userSchema, err = loadSchemaIfSet(config.UserSchemaFileLocation)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading user schema file: %v", err)
+	}
+
+	store.ticketSchema, err = loadSchemaIfSet(config.TicketSchemaFileLocation)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading ticket schema file: %v", err)
+	}
+
+	return store, nil
+}
+
+// importing reports whether data is imported from the Zendesk API rather than read from the data files
+func (store *JSONStore) importing() bool {
+	return store.config.ImportDirectory != "" || store.config.ImportBaseURL != ""
+}
+
+// Load reads all orgs, users and tickets, logging any schema violations (and failing if RefuseSchemaViolations is set)
+func (store *JSONStore) Load() ([]Organization, []User, []Ticket, error) {
+	var OrgList []Organization
+	var UserList []User
+	var TicketList []Ticket
+	var orgViolations, userViolations, ticketViolations []SchemaViolation
+	var err error
+
+	if store.importing() {
+		// import data from Zendesk API export pages instead of the data files
+		log.Println("Importing API export..")
+		export, err := importAPIExport(store.config)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error importing API export: %v", err)
+		}
+
+		OrgList, orgViolations, err = ParseOrganizationData("organizations (API export)", export.JSON("organizations"), store.orgSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading imported org data: %v", err)
+		}
+
+		UserList, userViolations, err = ParseUserData("users (API export)", export.JSON("users"), store.userSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading imported user data: %v", err)
+		}
+
+		TicketList, ticketViolations, err = ParseTicketData("tickets (API export)", export.JSON("tickets"), store.ticketSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading imported ticket data: %v", err)
+		}
+	} else {
+		OrgList, orgViolations, err = ReadOrganizationDataWithSchema(store.config.OrgFileLocation, store.orgSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading org data file: %v", err)
+		}
+
+		UserList, userViolations, err = ReadUserDataWithSchema(store.config.UserFileLocation, store.userSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading user data file: %v", err)
+		}
+
+		TicketList, ticketViolations, err = ReadTicketDataWithSchema(store.config.TicketFileLocation, store.ticketSchema)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error reading ticket data file: %v", err)
+		}
+	}
+
+	// report schema violations, refusing to load the data if configured to do so
+	orgsInvalid := reportSchemaViolations(store.config.OrgFileLocation, orgViolations)
+	usersInvalid := reportSchemaViolations(store.config.UserFileLocation, userViolations)
+	ticketsInvalid := reportSchemaViolations(store.config.TicketFileLocation, ticketViolations)
+	if (orgsInvalid || usersInvalid || ticketsInvalid) && store.config.RefuseSchemaViolations {
+		return nil, nil, nil, errors.New("Data files do not conform to their schemas (RefuseSchemaViolations is set)")
+	}
+
+	return OrgList, UserList, TicketList, nil
+}
+
+// Commit updates the changed records in the data file of each entity type. Records that haven't changed are written back
+// exactly as they were read, and changed records keep the layout of their original JSON, so the data files stay in the
+// format of the export they came from.
+func (store *JSONStore) Commit(data *Dataset, changes ChangeSet) error {
+	if changes.Empty() {
+		return nil
+	}
+
+	if store.importing() {
+		return errReadOnlyStore
+	}
+
+	if len(changes.Orgs) > 0 {
+		updates := []jsonRecordUpdate{}
+		for _, org := range data.OrgList {
+			if changes.Orgs[org.ID] {
+				updates = append(updates, jsonRecordUpdate{ID: strconv.Itoa(org.ID), Record: org})
+			}
+		}
+		for id := range changes.Orgs {
+			if _, exists := data.GetOrg(id); !exists {
+				updates = append(updates, jsonRecordUpdate{ID: strconv.Itoa(id)})
+			}
+		}
+
+		err := updateJSONDataFile(store.config.OrgFileLocation, updates)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(changes.Users) > 0 {
+		updates := []jsonRecordUpdate{}
+		for _, user := range data.UserList {
+			if changes.Users[user.ID] {
+				updates = append(updates, jsonRecordUpdate{ID: strconv.Itoa(user.ID), Record: user})
+			}
+		}
+		for id := range changes.Users {
+			if _, exists := data.GetUser(id); !exists {
+				updates = append(updates, jsonRecordUpdate{ID: strconv.Itoa(id)})
+			}
+		}
+
+		err := updateJSONDataFile(store.config.UserFileLocation, updates)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(changes.Tickets) > 0 {
+		updates := []jsonRecordUpdate{}
+		for _, ticket := range data.TicketList {
+			if changes.Tickets[ticket.ID] {
+				updates = append(updates, jsonRecordUpdate{ID: ticket.ID, Record: ticket})
+			}
+		}
+		for id := range changes.Tickets {
+			if _, exists := data.GetTicket(id); !exists {
+				updates = append(updates, jsonRecordUpdate{ID: id})
+			}
+		}
+
+		err := updateJSONDataFile(store.config.TicketFileLocation, updates)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonRecordUpdate is a record to write to a data file, replacing the record with the same _id (or added, if there is none).
+// A nil record deletes the record with the _id.
+type jsonRecordUpdate struct {
+	ID     string
+	Record interface{}
+}
+
+// updateJSONDataFile applies record updates to a data file. Records without an update are kept exactly as they were read,
+// updated records keep the layout of their original JSON (see patchRecordJSON), and new records are added at the end, in
+// the order given.
+func updateJSONDataFile(fileName string, updates []jsonRecordUpdate) error {
+	records := []json.RawMessage{}
+	fileData, err := ioutil.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal(fileData, &records)
+		if err != nil {
+			return fmt.Errorf("Cannot update %s: %v", fileName, err)
+		}
+	}
+
+	pending := map[string]interface{}{}
+	for _, update := range updates {
+		pending[update.ID] = update.Record
+	}
+
+	updated := []json.RawMessage{}
+	written := map[string]bool{}
+	for _, record := range records {
+		id, err := rawRecordID(record)
+		if err != nil {
+			return fmt.Errorf("Cannot update %s: %v", fileName, err)
+		}
+
+		update, changed := pending[id]
+		if !changed {
+			updated = append(updated, record)
+			continue
+		}
+
+		written[id] = true
+		if update == nil {
+			continue
+		}
+
+		patched, err := patchRecordJSON(record, update)
+		if err != nil {
+			return err
+		}
+		updated = append(updated, patched)
+	}
+
+	for _, update := range updates {
+		if written[update.ID] || update.Record == nil {
+			continue
+		}
+
+		encoded, err := json.Marshal(update.Record)
+		if err != nil {
+			return err
+		}
+		updated = append(updated, encoded)
+	}
+
+	return writeJSONDataFile(fileName, updated)
+}
+
+// rawRecordID returns the _id of a record in a data file, as a string (e.g. "101" or a ticket's ID)
+func rawRecordID(record json.RawMessage) (string, error) {
+	var fields struct {
+		ID json.RawMessage `json:"_id"`
+	}
+	err := json.Unmarshal(record, &fields)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	if json.Unmarshal(fields.ID, &id) == nil {
+		return id, nil
+	}
+
+	return string(fields.ID), nil
+}
+
+func (store *JSONStore) Close() error {
+	return nil
+}
+
+// writeJSONDataFile writes a list of records to a data file. The data is written to a temporary file first, which then replaces
+// the data file, so the data file is never left partially written. The previous version of the data file is kept as a backup
+// (<data file>.bak).
+func writeJSONDataFile(fileName string, records interface{}) error {
+	recordData, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	tempFileName := tempFile.Name()
+
+	// keep the permissions of the file being replaced
+	if fileInfo, statErr := os.Stat(fileName); statErr == nil {
+		tempFile.Chmod(fileInfo.Mode())
+	}
+
+	_, err = tempFile.Write(append(recordData, '\n'))
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFileName)
+		return err
+	}
+
+	err = backupFile(fileName)
+	if err != nil {
+		os.Remove(tempFileName)
+		return fmt.Errorf("Cannot back up %s: %v", fileName, err)
+	}
+
+	return os.Rename(tempFileName, fileName)
+}
+
+// backupFile copies a file to <file name>.bak, replacing any earlier backup. Files that don't exist yet are skipped.
+func backupFile(fileName string) error {
+	fileData, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fileName+".bak", fileData, fileInfo.Mode())
+}
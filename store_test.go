@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestKVFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	kv, err := OpenKVFile(path)
+	if err != nil {
+		t.Fatalf("TestKVFile: cannot open key/value file - %v\n", err)
+	}
+
+	err = kv.Write([]KVWrite{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}, {Key: "c", Value: []byte("3")}})
+	if err == nil {
+		err = kv.Write([]KVWrite{{Key: "a", Value: []byte("one")}, {Key: "b", Delete: true}})
+	}
+	if err != nil {
+		t.Fatalf("TestKVFile: error writing to key/value file - %v\n", err)
+	}
+	kv.Close()
+
+	// simulate a crash part way through writing an entry
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{0, 1, 2, 3, 1, 0, 0})
+	file.Close()
+
+	kv, err = OpenKVFile(path)
+	if err != nil {
+		t.Fatalf("TestKVFile: cannot reopen key/value file - %v\n", err)
+	}
+	defer kv.Close()
+
+	value, found, err := kv.Get("a")
+	if err != nil || !found || string(value) != "one" {
+		t.Errorf("TestKVFile: incorrect value for replaced key: %q (found %v, error %v)\n", value, found, err)
+	}
+
+	if _, found, _ := kv.Get("b"); found {
+		t.Error("TestKVFile: deleted key still found.\n")
+	}
+
+	if keys := kv.Keys(""); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+		t.Errorf("TestKVFile: keys not listed in insertion order: %v\n", keys)
+	}
+
+	err = kv.Compact()
+	if err != nil {
+		t.Fatalf("TestKVFile: error compacting key/value file - %v\n", err)
+	}
+
+	value, found, _ = kv.Get("c")
+	if !found || string(value) != "3" || kv.Len() != 2 || kv.size != kv.liveBytes {
+		t.Errorf("TestKVFile: incorrect state after compaction (value %q, %d keys, %d/%d bytes live)\n", value, kv.Len(), kv.liveBytes, kv.size)
+	}
+}
+
+func TestKVFileCorruptLengths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	kv, err := OpenKVFile(path)
+	if err == nil {
+		err = kv.Write([]KVWrite{{Key: "a", Value: []byte("1")}})
+	}
+	if err != nil {
+		t.Fatalf("TestKVFileCorruptLengths: error writing to key/value file - %v\n", err)
+	}
+	validSize := kv.size
+	kv.Close()
+
+	// a corrupt header claiming a huge value shouldn't be allocated for, only discarded
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write([]byte{0, 1, 2, 3, kvOpPut, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 'b'})
+	file.Close()
+
+	kv, err = OpenKVFile(path)
+	if err != nil {
+		t.Fatalf("TestKVFileCorruptLengths: cannot reopen key/value file - %v\n", err)
+	}
+	defer kv.Close()
+
+	fileInfo, _ := os.Stat(path)
+	if value, found, _ := kv.Get("a"); !found || string(value) != "1" || kv.Len() != 1 || fileInfo.Size() != validSize {
+		t.Errorf("TestKVFileCorruptLengths: corrupt entry not truncated (%d keys, file size %d)\n", kv.Len(), fileInfo.Size())
+	}
+
+	if err := kv.Write([]KVWrite{{Key: "big", Value: make([]byte, kvMaxValueSize+1)}}); err == nil {
+		t.Error("TestKVFileCorruptLengths: value over the maximum size written.\n")
+	}
+}
+
+func TestKVFileCorruptEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	kv, err := OpenKVFile(path)
+	if err == nil {
+		err = kv.Write([]KVWrite{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}})
+	}
+	if err != nil {
+		t.Fatalf("TestKVFileCorruptEntry: error writing to key/value file - %v\n", err)
+	}
+	size := kv.size
+	kv.Close()
+
+	// flip a bit in the first entry's value, which is followed by a valid entry
+	contents, _ := ioutil.ReadFile(path)
+	contents[kvHeaderSize+1] ^= 1
+	ioutil.WriteFile(path, contents, 0644)
+
+	if kv, err = OpenKVFile(path); err == nil {
+		kv.Close()
+		t.Error("TestKVFileCorruptEntry: corrupt entry before the end of the file not reported.\n")
+	}
+
+	if fileInfo, _ := os.Stat(path); fileInfo.Size() != size {
+		t.Errorf("TestKVFileCorruptEntry: file with a corrupt entry truncated to %d bytes\n", fileInfo.Size())
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	data := loadTestDataset(t)
+	path := filepath.Join(t.TempDir(), "zdsearch.db")
+
+	store, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatalf("TestKVStore: cannot open store - %v\n", err)
+	}
+
+	err = store.Import(data.OrgList, data.UserList, data.TicketList)
+	if err != nil {
+		t.Fatalf("TestKVStore: error importing data - %v\n", err)
+	}
+
+	delta, err := ReadDeltaFile("testdata/delta.json")
+	if err != nil {
+		t.Fatalf("TestKVStore: cannot read delta file - %v\n", err)
+	}
+	data.TakeChanges()
+	data.ApplyDelta(delta)
+
+	err = store.Commit(data, data.TakeChanges())
+	if err != nil {
+		t.Fatalf("TestKVStore: error committing changes - %v\n", err)
+	}
+	store.Close()
+
+	// changes should persist across runs
+	store, err = OpenKVStore(path)
+	if err != nil {
+		t.Fatalf("TestKVStore: cannot reopen store - %v\n", err)
+	}
+	defer store.Close()
+
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestKVStore: error loading data - %v\n", err)
+	}
+
+	// deletes move records in the dataset's lists, while the store keeps the order records were first stored in
+	loadedData, committedData := NewDataset(OrgList, UserList, TicketList), NewDataset(data.OrgList, data.UserList, data.TicketList)
+	for _, org := range committedData.OrgList {
+		if loadedOrg, found := loadedData.GetOrg(org.ID); !found || !reflect.DeepEqual(loadedOrg, org) {
+			t.Errorf("TestKVStore: org %d loaded from store differs from org committed.\n", org.ID)
+		}
+	}
+	for _, user := range committedData.UserList {
+		if loadedUser, found := loadedData.GetUser(user.ID); !found || !reflect.DeepEqual(loadedUser, user) {
+			t.Errorf("TestKVStore: user %d loaded from store differs from user committed.\n", user.ID)
+		}
+	}
+	for _, ticket := range committedData.TicketList {
+		if loadedTicket, found := loadedData.GetTicket(ticket.ID); !found || !reflect.DeepEqual(loadedTicket, ticket) {
+			t.Errorf("TestKVStore: ticket %s loaded from store differs from ticket committed.\n", ticket.ID)
+		}
+	}
+	if len(OrgList) != len(data.OrgList) || len(UserList) != len(data.UserList) || len(TicketList) != len(data.TicketList) {
+		t.Errorf("TestKVStore: %d orgs, %d users and %d tickets loaded from store, %d, %d and %d committed\n", len(OrgList), len(UserList), len(TicketList), len(data.OrgList), len(data.UserList), len(data.TicketList))
+	}
+
+	// the persisted indexes should relate the same records as indexes built from the loaded records
+	loaded, err := store.LoadDataset()
+	if err != nil {
+		t.Fatalf("TestKVStore: error loading dataset - %v\n", err)
+	}
+
+	built := NewDataset(OrgList, UserList, TicketList)
+	if !reflect.DeepEqual(indexedIDs(loaded), indexedIDs(built)) {
+		t.Errorf("TestKVStore: persisted indexes differ from built indexes:\n%v\n%v\n", indexedIDs(loaded), indexedIDs(built))
+	}
+}
+
+func TestKVStoreIndexesLegacyStore(t *testing.T) {
+	data := loadTestDataset(t)
+	path := filepath.Join(t.TempDir(), "zdsearch.db")
+
+	// a store written before indexes were persisted holds only records
+	kv, err := OpenKVFile(path)
+	if err != nil {
+		t.Fatalf("TestKVStoreIndexesLegacyStore: cannot open key/value file - %v\n", err)
+	}
+	writes := []KVWrite{}
+	for _, user := range data.UserList {
+		value, _ := json.Marshal(user)
+		writes = append(writes, KVWrite{Key: userKey(user.ID), Value: value})
+	}
+	for _, ticket := range data.TicketList {
+		value, _ := json.Marshal(ticket)
+		writes = append(writes, KVWrite{Key: ticketKey(ticket.ID), Value: value})
+	}
+	kv.Write(writes)
+	kv.Close()
+
+	store, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatalf("TestKVStoreIndexesLegacyStore: cannot open store - %v\n", err)
+	}
+	defer store.Close()
+
+	loaded, err := store.LoadDataset()
+	if err != nil {
+		t.Fatalf("TestKVStoreIndexesLegacyStore: error loading dataset - %v\n", err)
+	}
+	if !store.indexed() || len(store.kv.Keys(kvOrgUsersPrefix)) <= 0 {
+		t.Error("TestKVStoreIndexesLegacyStore: indexes not written to a store without them.\n")
+	}
+
+	reloaded, err := store.LoadDataset()
+	if err != nil {
+		t.Fatalf("TestKVStoreIndexesLegacyStore: error reloading dataset - %v\n", err)
+	}
+	if !reflect.DeepEqual(indexedIDs(reloaded), indexedIDs(loaded)) {
+		t.Error("TestKVStoreIndexesLegacyStore: persisted indexes differ from the indexes built on first load.\n")
+	}
+}
+
+// indexedIDs returns the (sorted) IDs of the records in each entry of a dataset's relationship indexes, keyed by index and key
+func indexedIDs(data *Dataset) map[string][]string {
+	ids := map[string][]string{}
+	for org, users := range data.OrgUserIndex {
+		for _, user := range users {
+			ids[fmt.Sprintf("org-users/%d", org)] = append(ids[fmt.Sprintf("org-users/%d", org)], strconv.Itoa(user.ID))
+		}
+	}
+	for domain, orgs := range data.OrgDomainIndex {
+		for _, org := range orgs {
+			ids["org-domains/"+domain] = append(ids["org-domains/"+domain], strconv.Itoa(org.ID))
+		}
+	}
+	for name, index := range map[string]map[int][]Ticket{"org-tickets": data.OrgTicketIndex, "submitted": data.UserSubmittedTixIndex, "assigned": data.UserAssignedTixIndex} {
+		for key, tickets := range index {
+			for _, ticket := range tickets {
+				ids[fmt.Sprintf("%s/%d", name, key)] = append(ids[fmt.Sprintf("%s/%d", name, key)], ticket.ID)
+			}
+		}
+	}
+
+	for key := range ids {
+		sort.Strings(ids[key])
+	}
+
+	return ids
+}
+
+// tempDataConfig returns the app config, with copies of the data files in a temporary directory to work on
+func tempDataConfig(t *testing.T, dir string) AppConfig {
+	config, err := ReadAppConfig("config.json")
+	if err != nil {
+		t.Fatalf("%s: cannot read config file - %v\n", t.Name(), err)
+	}
+
+	for _, fileName := range []*string{&config.OrgFileLocation, &config.UserFileLocation, &config.TicketFileLocation} {
+		fileData, err := ioutil.ReadFile(*fileName)
+		if err != nil {
+			t.Fatalf("%s: cannot read data file - %v\n", t.Name(), err)
+		}
+
+		*fileName = filepath.Join(dir, filepath.Base(*fileName))
+		ioutil.WriteFile(*fileName, fileData, 0644)
+	}
+	config.JournalFileLocation = filepath.Join(dir, "journal.jsonl")
+
+	return config
+}
+
+func TestJSONStoreCommit(t *testing.T) {
+	dir := t.TempDir()
+	config := tempDataConfig(t, dir)
+
+	store, err := NewJSONStore(config)
+	if err != nil {
+		t.Fatalf("TestJSONStoreCommit: cannot create store - %v\n", err)
+	}
+
+	OrgList, UserList, TicketList, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestJSONStoreCommit: error loading data - %v\n", err)
+	}
+
+	// rewriting every data file should leave the data unchanged
+	data := NewDataset(OrgList, UserList, TicketList)
+	err = store.Commit(data, allRecords(OrgList, UserList, TicketList))
+	if err != nil {
+		t.Fatalf("TestJSONStoreCommit: error committing data - %v\n", err)
+	}
+
+	reloadedOrgs, reloadedUsers, reloadedTickets, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestJSONStoreCommit: error reloading data - %v\n", err)
+	}
+
+	if !reflect.DeepEqual(reloadedOrgs, OrgList) || !reflect.DeepEqual(reloadedUsers, UserList) || !reflect.DeepEqual(reloadedTickets, TicketList) {
+		t.Error("TestJSONStoreCommit: data changed by being written back to the data files.\n")
+	}
+
+	// unchanged records should be written back exactly as they were read
+	for _, fileName := range []string{config.OrgFileLocation, config.UserFileLocation, config.TicketFileLocation} {
+		original, _ := ioutil.ReadFile(filepath.Base(fileName))
+		written, _ := ioutil.ReadFile(fileName)
+		if !bytes.Equal(original, written) {
+			t.Errorf("TestJSONStoreCommit: %s changed by being written back\n", filepath.Base(fileName))
+		}
+	}
+
+	// the previous version of each data file should be kept as a backup
+	if backups, _ := filepath.Glob(filepath.Join(dir, "*.json.bak")); len(backups) != 3 {
+		t.Errorf("TestJSONStoreCommit: expected 3 backup files, found %v\n", backups)
+	}
+
+	if leftover, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(leftover) > 0 {
+		t.Errorf("TestJSONStoreCommit: temporary files left behind: %v\n", leftover)
+	}
+}
+
+func TestJSONStoreCommitChangedRecord(t *testing.T) {
+	config := tempDataConfig(t, t.TempDir())
+	data, store, journal := openTestJournal(t, config)
+	journal.Close()
+
+	// a user without an alias (so the data file has no alias field for them), given one, and a deleted ticket
+	ticketID := "1a227508-9f39-427c-8f57-1b72f3fab87c"
+	for _, command := range []WriteCommand{
+		{Action: "update", EntityType: "user", ID: "1", Field: "Alias", Value: ""},
+		{Action: "update", EntityType: "user", ID: "1", Field: "Locale", Value: "fr-FR"},
+		{Action: "delete", EntityType: "ticket", ID: ticketID},
+	} {
+		if _, err := RunWriteCommand(data, command); err != nil {
+			t.Fatalf("TestJSONStoreCommitChangedRecord: error running %+v - %v\n", command, err)
+		}
+	}
+	if err := store.Commit(data, data.TakeChanges()); err != nil {
+		t.Fatalf("TestJSONStoreCommitChangedRecord: error committing data - %v\n", err)
+	}
+
+	var originalUsers, writtenUsers []json.RawMessage
+	originalData, _ := ioutil.ReadFile("users.json")
+	writtenData, _ := ioutil.ReadFile(config.UserFileLocation)
+	json.Unmarshal(originalData, &originalUsers)
+	json.Unmarshal(writtenData, &writtenUsers)
+	if len(writtenUsers) != len(originalUsers) {
+		t.Fatalf("TestJSONStoreCommitChangedRecord: %d users written, expected %d\n", len(writtenUsers), len(originalUsers))
+	}
+
+	// the changed user keeps its fields in their original order, including the alias now empty
+	originalKeys, _ := jsonObjectKeys(originalUsers[0])
+	writtenKeys, _ := jsonObjectKeys(writtenUsers[0])
+	if !reflect.DeepEqual(originalKeys, writtenKeys) || !bytes.Contains(writtenUsers[0], []byte(`"alias": ""`)) || !bytes.Contains(writtenUsers[0], []byte(`"locale": "fr-FR"`)) {
+		t.Errorf("TestJSONStoreCommitChangedRecord: changed user not written in its original layout: %s\n", writtenUsers[0])
+	}
+	for i := 1; i < len(originalUsers); i++ {
+		if !bytes.Equal(originalUsers[i], writtenUsers[i]) {
+			t.Errorf("TestJSONStoreCommitChangedRecord: unchanged user %d rewritten\n", i)
+		}
+	}
+
+	_, _, TicketList, err := store.Load()
+	if err != nil || len(TicketList) != len(data.TicketList) {
+		t.Errorf("TestJSONStoreCommitChangedRecord: deleted ticket not removed (error %v)\n", err)
+	}
+}
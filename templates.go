@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// -------------------- user-defined output templates --------------------
+
+// layout of the dates in the data, e.g. 2016-04-28T11:19:34 -10:00
+const dataDateLayout = "2006-01-02T15:04:05 -07:00"
+
+// functions available to output templates, besides the text/template builtins
+var templateFuncs = template.FuncMap{
+	// date formats a date from the data with a Go time layout, e.g. {{date "2006-01-02" .Created_at}} (values that
+	// aren't dates are left as they are)
+	"date": func(layout, value string) string {
+		parsed, err := time.Parse(dataDateLayout, value)
+		if err != nil {
+			return value
+		}
+		return parsed.Format(layout)
+	},
+	// join joins a list, e.g. {{join .Tags ", "}}
+	"join": func(values []string, separator string) string {
+		return strings.Join(values, separator)
+	},
+	// truncate shortens a value to a number of characters, ending it with "..." if it was cut, e.g. {{truncate 40 .Subject}}
+	"truncate": func(length int, value string) string {
+		runes := []rune(value)
+		if len(runes) <= length {
+			return value
+		}
+		if length <= 3 {
+			return string(runes[:length])
+		}
+		return string(runes[:length-3]) + "..."
+	},
+	// default returns a default for an empty value, e.g. {{default "unassigned" .AssigneeObj.Name}}
+	"default": func(defaultValue string, value interface{}) interface{} {
+		if value == nil || fmt.Sprintf("%v", value) == "" || fmt.Sprintf("%v", value) == "0" {
+			return defaultValue
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// OutputTemplates are text/template templates formatting search results, by search type (org, user or ticket). Each
+// template is executed for each result, with the Organization, User or Ticket record (and its associated records).
+type OutputTemplates struct {
+	templates map[string]*template.Template
+}
+
+// LoadOutputTemplates reads the template files for each search type, skipping types with no file
+func LoadOutputTemplates(files map[string]string) (*OutputTemplates, error) {
+	templates := &OutputTemplates{templates: map[string]*template.Template{}}
+	for searchType, file := range files {
+		if file == "" {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s template: %v", searchType, err)
+		}
+
+		parsed, err := template.New(filepath.Base(file)).Funcs(templateFuncs).Parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing %s template: %v", searchType, err)
+		}
+		templates.templates[searchType] = parsed
+	}
+
+	return templates, nil
+}
+
+// Name returns the name (file name) of the template for a search type, or "" if there is none
+func (templates *OutputTemplates) Name(searchType string) string {
+	if templates == nil || templates.templates[searchType] == nil {
+		return ""
+	}
+
+	return templates.templates[searchType].Name()
+}
+
+// Format formats a search result with the template for its search type. Returns false if there is no template for the
+// type, for the built-in format to be used.
+func (templates *OutputTemplates) Format(result SearchResult) (string, bool, error) {
+	if templates == nil || templates.templates[result.SearchType] == nil {
+		return "", false, nil
+	}
+
+	records := searchRecords(result)
+	if len(records) <= 0 {
+		return "<No results found>", true, nil
+	}
+
+	var formatted strings.Builder
+	for _, record := range records {
+		if err := templates.templates[result.SearchType].Execute(&formatted, record); err != nil {
+			return "", true, fmt.Errorf("Error formatting %s: %v", result.SearchType, err)
+		}
+	}
+
+	return strings.TrimRight(formatted.String(), "\n"), true, nil
+}
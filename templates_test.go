@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputTemplates(t *testing.T) {
+	data := loadTestDataset(t)
+
+	templates, err := LoadOutputTemplates(map[string]string{
+		"ticket": filepath.Join("templates", "ticket-summary.tmpl"),
+		"user":   filepath.Join("templates", "user-summary.tmpl"),
+		"org":    "",
+	})
+	if err != nil {
+		t.Fatalf("TestOutputTemplates: unexpected error: %v\n", err)
+	}
+
+	result, _ := data.Search("ticket Status hold", nil)
+	formatted, templated, err := templates.Format(result)
+	if err != nil || !templated {
+		t.Fatalf("TestOutputTemplates: ticket template not used (error %v)\n", err)
+	}
+
+	lines := strings.Split(formatted, "\n")
+	if len(lines) != len(result.Tickets) {
+		t.Errorf("TestOutputTemplates: expected a line for each of %d tickets, got %d\n", len(result.Tickets), len(lines))
+	}
+	if expected := "1a227508-9f39-427c-8f57-1b72f3fab87c  hold    low    A Catastrophe in Micronesia (Elma Castro, due 2016-08-15)"; lines[0] != expected {
+		t.Errorf("TestOutputTemplates: expected %q, got %q\n", expected, lines[0])
+	}
+
+	// the built-in format is used for types without a template
+	result, _ = data.Search("org ID 101", nil)
+	if _, templated, _ := templates.Format(result); templated {
+		t.Errorf("TestOutputTemplates: org results formatted without a template\n")
+	}
+	var none *OutputTemplates
+	if _, templated, _ := none.Format(result); templated {
+		t.Errorf("TestOutputTemplates: results formatted without templates\n")
+	}
+
+	result, _ = data.Search("user Role nobody", nil)
+	if formatted, _, _ := templates.Format(result); formatted != "<No results found>" {
+		t.Errorf("TestOutputTemplates: unexpected output for no results: %q\n", formatted)
+	}
+}
+
+func TestOutputTemplateErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestOutputTemplateErrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := LoadOutputTemplates(map[string]string{"ticket": filepath.Join(dir, "missing.tmpl")}); err == nil {
+		t.Errorf("TestOutputTemplateErrors: expected an error for a missing template\n")
+	}
+
+	invalid := filepath.Join(dir, "invalid.tmpl")
+	ioutil.WriteFile(invalid, []byte("{{.Subject"), 0600)
+	if _, err := LoadOutputTemplates(map[string]string{"ticket": invalid}); err == nil {
+		t.Errorf("TestOutputTemplateErrors: expected an error for an invalid template\n")
+	}
+
+	// fields that don't exist are reported when the template is executed
+	unknown := filepath.Join(dir, "unknown.tmpl")
+	ioutil.WriteFile(unknown, []byte("{{.Nope}}"), 0600)
+	templates, err := LoadOutputTemplates(map[string]string{"ticket": unknown})
+	if err != nil {
+		t.Fatalf("TestOutputTemplateErrors: unexpected error: %v\n", err)
+	}
+	if _, _, err := templates.Format(SearchResult{SearchType: "ticket", Tickets: []Ticket{{}}}); err == nil {
+		t.Errorf("TestOutputTemplateErrors: expected an error for an unknown field\n")
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		result   interface{}
+		expected interface{}
+	}{
+		{templateFuncs["date"].(func(string, string) string)("Jan 2, 2006", "2016-04-28T11:19:34 -10:00"), "Apr 28, 2016"},
+		{templateFuncs["date"].(func(string, string) string)("2006-01-02", "soon"), "soon"},
+		{templateFuncs["join"].(func([]string, string) string)([]string{"a", "b"}, ", "), "a, b"},
+		{templateFuncs["truncate"].(func(int, string) string)(8, "A Catastrophe"), "A Cat..."},
+		{templateFuncs["truncate"].(func(int, string) string)(20, "A Catastrophe"), "A Catastrophe"},
+		{templateFuncs["default"].(func(string, interface{}) interface{})("none", ""), "none"},
+		{templateFuncs["default"].(func(string, interface{}) interface{})("none", 0), "none"},
+		{templateFuncs["default"].(func(string, interface{}) interface{})("none", "Quilk"), "Quilk"},
+	}
+
+	for _, test := range tests {
+		if test.result != test.expected {
+			t.Errorf("TestTemplateFuncs: expected %v, got %v\n", test.expected, test.result)
+		}
+	}
+}
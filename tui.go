@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -------------------- full-screen terminal UI: query bar, results list, detail pane --------------------
+
+// prefix of the command starting the full-screen UI: tui [<searchtype> <searchfield> <search value>]
+const tuiPrefix = "tui"
+
+// terminal size used if it can't be read
+const (
+	defaultTerminalRows = 24
+	defaultTerminalCols = 80
+)
+
+// parts of the UI that keys go to
+const (
+	focusQuery = iota
+	focusResults
+	focusDetail
+)
+
+// tuiView is a list of records shown in the results list: the results of a search, or records reached from them
+type tuiView struct {
+	Title    string
+	Records  []interface{}
+	Selected int
+	Top      int // first record shown in the list
+}
+
+// TUI is a full-screen terminal UI: a query bar to enter searches, a list of the results, and a detail pane showing the
+// selected record with links to its associated records. Following a link lists the linked records, and going back returns
+// to the previous list.
+type TUI struct {
+	data    *Dataset
+	queries *SavedQueries // run from the query bar with :run <name> [<argument> ...]
+	keys    *LineEditor
+	out     io.Writer
+	rows    int
+	cols    int
+
+	query     []rune
+	focus     int
+	views     []*tuiView
+	link      int    // link selected in the detail pane
+	detailTop int    // first row shown in the detail pane
+	message   string // shown in the status line until the next key
+}
+
+// parseTUICommand returns the search to start the UI with, and whether the input is a tui command
+func parseTUICommand(input string) (string, bool) {
+	fields := strings.SplitN(strings.TrimSpace(input), " ", 2)
+	if strings.ToLower(fields[0]) != tuiPrefix {
+		return "", false
+	}
+	if len(fields) < 2 {
+		return "", true
+	}
+
+	return strings.TrimSpace(fields[1]), true
+}
+
+// NewTUI returns a full-screen UI over the dataset (and saved queries), reading keys with the line editor and drawing on out
+func NewTUI(data *Dataset, queries *SavedQueries, keys *LineEditor, out io.Writer) *TUI {
+	tui := &TUI{data: data, queries: queries, keys: keys, out: out, rows: defaultTerminalRows, cols: defaultTerminalCols}
+	tui.readSize()
+
+	return tui
+}
+
+// readSize reads the terminal size, so that a resized terminal is drawn to its new size (keeping the last size read if it
+// can't be read)
+func (tui *TUI) readSize() {
+	if tui.keys.terminal == nil {
+		return
+	}
+
+	if rows, cols, err := terminalSize(tui.keys.terminal); err == nil && rows > 0 && cols > 0 {
+		tui.rows, tui.cols = rows, cols
+	}
+}
+
+// Run shows the UI until the user quits, starting with the results of a search (if not empty)
+func (tui *TUI) Run(search string) error {
+	restore, err := tui.keys.rawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// use the terminal's alternate screen, leaving the prompt's output as it was on exit
+	fmt.Fprint(tui.out, "\x1b[?1049h")
+	defer fmt.Fprint(tui.out, "\x1b[?25h\x1b[?1049l")
+
+	tui.query = []rune(search)
+	if search != "" {
+		tui.search()
+	}
+
+	for {
+		tui.render()
+		tui.message = ""
+
+		key, err := tui.keys.readKey()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if quit := tui.handleKey(key); quit {
+			return nil
+		}
+	}
+}
+
+// search runs the query (or the saved query it runs), listing its results
+func (tui *TUI) search() {
+	query, err := tui.queries.ExpandRun(strings.TrimSpace(string(tui.query)))
+	var result SearchResult
+	if err == nil {
+		result, err = tui.data.Search(query, nil)
+	}
+	if err != nil {
+		tui.message = fmt.Sprintf("Error: %v", err)
+		return
+	}
+
+	tui.views = []*tuiView{{Title: strings.TrimSpace(string(tui.query)), Records: searchRecords(result)}}
+	tui.link, tui.detailTop = 0, 0
+	tui.focus = focusResults
+	tui.message = fmt.Sprintf("%d result(s)", result.Len())
+}
+
+// view returns the list being shown, or nil before the first search
+func (tui *TUI) view() *tuiView {
+	if len(tui.views) <= 0 {
+		return nil
+	}
+
+	return tui.views[len(tui.views)-1]
+}
+
+// selected returns the selected record, or nil if there is none
+func (tui *TUI) selected() interface{} {
+	view := tui.view()
+	if view == nil || len(view.Records) <= 0 {
+		return nil
+	}
+
+	return view.Records[view.Selected]
+}
+
+// handleKey handles a key in the focused part of the UI, returning true if the UI should exit
+func (tui *TUI) handleKey(key string) bool {
+	if key == "ctrl-c" {
+		return true
+	}
+
+	if tui.focus == focusQuery {
+		switch key {
+		case "enter":
+			tui.search()
+		case "backspace":
+			if len(tui.query) > 0 {
+				tui.query = tui.query[:len(tui.query)-1]
+			}
+		case string(rune(keyCtrlU)):
+			tui.query = nil
+		case "esc", "\t", "down":
+			if tui.view() != nil {
+				tui.focus = focusResults
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); utf8.RuneCountInString(key) == 1 && unicode.IsPrint(r) {
+				tui.query = append(tui.query, r)
+			}
+		}
+		return false
+	}
+
+	view := tui.view()
+	switch key {
+	case "q", "Q":
+		return true
+	case "/", ":":
+		tui.focus = focusQuery
+	case "b", "backspace":
+		if len(tui.views) > 1 {
+			tui.views = tui.views[:len(tui.views)-1]
+			tui.link, tui.detailTop = 0, 0
+		} else {
+			tui.message = "Already at the search results"
+		}
+	case "\t":
+		tui.focus = map[int]int{focusResults: focusDetail, focusDetail: focusResults}[tui.focus]
+
+	default:
+		if tui.focus == focusResults {
+			tui.handleResultsKey(view, key)
+		} else {
+			tui.handleDetailKey(key)
+		}
+	}
+
+	return false
+}
+
+// handleResultsKey moves the selection in the results list
+func (tui *TUI) handleResultsKey(view *tuiView, key string) {
+	height := tui.bodyHeight()
+	switch key {
+	case "down", "j":
+		view.Selected++
+	case "up", "k":
+		view.Selected--
+	case "pgdn", " ":
+		view.Selected += height
+	case "pgup":
+		view.Selected -= height
+	case "home", "g":
+		view.Selected = 0
+	case "end", "G":
+		view.Selected = len(view.Records) - 1
+	case "enter", "right", "l":
+		tui.focus = focusDetail
+		return
+	default:
+		tui.follow(key)
+		return
+	}
+
+	if view.Selected >= len(view.Records) {
+		view.Selected = len(view.Records) - 1
+	}
+	if view.Selected < 0 {
+		view.Selected = 0
+	}
+	tui.link, tui.detailTop = 0, 0
+}
+
+// handleDetailKey selects or follows a link in the detail pane
+func (tui *TUI) handleDetailKey(key string) {
+	record := tui.selected()
+	if record == nil {
+		return
+	}
+
+	// Up/Down select a link, scrolling the pane past the last link (and back), and Page Up/Page Down scroll it a page at a time
+	links := recordLinkKeys(record)
+	height := tui.bodyHeight()
+	switch key {
+	case "down", "j":
+		if tui.link < len(links)-1 {
+			tui.link++
+		} else {
+			tui.detailTop++
+		}
+	case "up", "k":
+		if tui.detailTop > tui.link {
+			tui.detailTop--
+		} else if tui.link > 0 {
+			tui.link--
+		}
+	case "pgdn", " ":
+		tui.detailTop += height
+	case "pgup":
+		tui.detailTop -= height
+	case "home", "g":
+		tui.detailTop = 0
+	case "left", "h", "esc":
+		tui.focus = focusResults
+	case "enter", "right", "l":
+		tui.follow(links[tui.link])
+	default:
+		tui.follow(key)
+	}
+}
+
+// follow lists the records linked to the selected record by a key (see linkedRecords)
+func (tui *TUI) follow(key string) {
+	record := tui.selected()
+	if record == nil {
+		return
+	}
+
+	title, records := linkedRecords(tui.data, record, key)
+	if title == "" {
+		tui.message = fmt.Sprintf("Unknown key %q", key)
+		return
+	}
+	if len(records) <= 0 {
+		tui.message = "No " + title
+		return
+	}
+
+	tui.views = append(tui.views, &tuiView{Title: title, Records: records})
+	tui.focus = focusResults
+	tui.link, tui.detailTop = 0, 0
+}
+
+// bodyHeight returns the number of rows of the results list and detail pane, below the query bar and status line and
+// above the key help
+func (tui *TUI) bodyHeight() int {
+	if height := tui.rows - 3; height > 0 {
+		return height
+	}
+
+	return 1
+}
+
+// render redraws the screen, at the terminal's current size
+func (tui *TUI) render() {
+	tui.readSize()
+
+	listWidth := tui.cols * 2 / 5
+	if listWidth < 20 {
+		listWidth = 20
+	}
+	detailWidth := tui.cols - listWidth - 3
+	if detailWidth < 1 {
+		detailWidth = 1
+	}
+	height := tui.bodyHeight()
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[?25l\x1b[H")
+
+	// query bar
+	queryLine := fitWidth(" Search: "+string(tui.query), tui.cols)
+	if tui.focus == focusQuery {
+		queryLine = "\x1b[7m" + queryLine + "\x1b[0m"
+	}
+	screen.WriteString(queryLine + "\x1b[K\r\n")
+
+	// status line: the lists followed to get to the current one, the position in it, and any message
+	status := ""
+	if view := tui.view(); view != nil {
+		titles := []string{}
+		for _, view := range tui.views {
+			titles = append(titles, view.Title)
+		}
+		status = fmt.Sprintf("%s [%d/%d]", strings.Join(titles, " > "), view.Selected+1, len(view.Records))
+		if len(view.Records) <= 0 {
+			status = strings.Join(titles, " > ") + " [no results]"
+		}
+	}
+	if tui.message != "" {
+		status += "  " + tui.message
+	}
+	screen.WriteString("\x1b[1m" + fitWidth(" "+status, tui.cols) + "\x1b[0m\x1b[K\r\n")
+
+	listLines := tui.listLines(listWidth, height)
+	detailLines := tui.detailLines(detailWidth, height)
+	for row := 0; row < height; row++ {
+		left, right := strings.Repeat(" ", listWidth), ""
+		if row < len(listLines) {
+			left = listLines[row]
+		}
+		if row < len(detailLines) {
+			right = detailLines[row]
+		}
+		screen.WriteString(left + " | " + right + "\x1b[K\r\n")
+	}
+
+	// key help for the focused part
+	help := map[int]string{
+		focusQuery:   "Enter: search  Tab/Esc: results  Ctrl-U: clear  Ctrl-C: quit",
+		focusResults: "Up/Down: select  Enter/Tab: detail  o/s/a/u/t: follow link  b: back  /: search  q: quit",
+		focusDetail:  "Up/Down: select link/scroll  PgUp/PgDn: scroll  Enter: follow  Tab/Esc: results  b: back  /: search  q: quit",
+	}[tui.focus]
+	screen.WriteString("\x1b[7m" + fitWidth(" "+help, tui.cols) + "\x1b[0m\x1b[K")
+
+	if tui.focus == focusQuery {
+		// put the cursor at the end of the query
+		screen.WriteString(fmt.Sprintf("\x1b[1;%dH\x1b[?25h", len(" Search: ")+len(tui.query)+1))
+	}
+
+	fmt.Fprint(tui.out, screen.String())
+}
+
+// listLines returns the rows of the results list, scrolled to show the selected record
+func (tui *TUI) listLines(width, height int) []string {
+	view := tui.view()
+	if view == nil {
+		return []string{fitWidth(" Enter a search, e.g. ticket Status pending", width)}
+	}
+
+	if view.Selected < view.Top {
+		view.Top = view.Selected
+	}
+	if view.Selected >= view.Top+height {
+		view.Top = view.Selected - height + 1
+	}
+
+	lines := []string{}
+	for i := view.Top; i < len(view.Records) && i < view.Top+height; i++ {
+		line := fitWidth(" "+recordSummary(view.Records[i]), width)
+		if i == view.Selected {
+			if tui.focus == focusResults {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			} else {
+				line = "\x1b[1m" + line + "\x1b[0m"
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// detailLines returns the rows of the detail pane: the selected record's links to its associated records, then its fields,
+// scrolled to the pane's first row (kept within the rows, and showing the selected link if the pane is scrolled up to it)
+func (tui *TUI) detailLines(width, height int) []string {
+	record := tui.selected()
+	if record == nil {
+		return nil
+	}
+
+	lines := []string{}
+	for i, link := range strings.Split(strings.TrimRight(formatBrowseLinks(record, false), "\n"), "\n") {
+		line := fitWidth(link, width)
+		if tui.focus == focusDetail && i == tui.link {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "")
+	for _, field := range strings.Split(strings.TrimRight(formatRecordFields(record), "\n"), "\n") {
+		for _, row := range wrapLines(field, width) {
+			lines = append(lines, fitWidth(row, width))
+		}
+	}
+
+	if tui.detailTop > len(lines)-height {
+		tui.detailTop = len(lines) - height
+	}
+	if tui.detailTop < 0 {
+		tui.detailTop = 0
+	}
+
+	return lines[tui.detailTop:]
+}
+
+// recordSummary describes a record in a line, for the results list
+func recordSummary(record interface{}) string {
+	switch record := record.(type) {
+	case Organization:
+		return fmt.Sprintf("%-4d %s", record.ID, record.Name)
+	case User:
+		return fmt.Sprintf("%-4d %s (%s)", record.ID, record.Name, record.Role)
+	case Ticket:
+		return fmt.Sprintf("%-8s %s", record.Status, record.Subject)
+	}
+
+	return fmt.Sprintf("%v", record)
+}
+
+// fitWidth pads or truncates a line (without escape sequences) to a width, expanding tabs
+func fitWidth(line string, width int) string {
+	runes := []rune(strings.Replace(line, "\t", strings.Repeat(" ", tabWidth), -1))
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
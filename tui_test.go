@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runTUI runs the full-screen UI on the given keys, as if typed at a terminal
+func runTUI(t *testing.T, data *Dataset, search, keys string) (*TUI, string) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	tui := NewTUI(data, &SavedQueries{Queries: map[string]string{}}, newLineEditor(strings.NewReader(keys), out, nil), out)
+	if err := tui.Run(search); err != nil {
+		t.Fatalf("runTUI: unexpected error: %v\n", err)
+	}
+
+	return tui, out.String()
+}
+
+func TestTUI(t *testing.T) {
+	data := loadTestDataset(t)
+	tickets, _ := SearchTickets("Status", "pending", data.TicketList)
+
+	if search, isTUICommand := parseTUICommand("tui ticket Status pending"); !isTUICommand || search != "ticket Status pending" {
+		t.Errorf("TestTUI: tui command not parsed: %q\n", search)
+	}
+
+	// enter a search in the query bar, and move through the results
+	tui, output := runTUI(t, data, "", "ticket Status pending\r\x1b[B\x1b[Bk")
+	if view := tui.view(); view == nil || len(view.Records) != len(tickets) || view.Selected != 1 || tui.focus != focusResults {
+		t.Fatalf("TestTUI: unexpected state after searching: %+v\n", view)
+	}
+	if !strings.Contains(output, "45 result(s)") || !strings.Contains(output, "[2/45]") || !strings.Contains(output, recordSummary(tickets[1])[:30]) {
+		t.Errorf("TestTUI: results not shown\n")
+	}
+
+	// follow the second link of the selected ticket (its submitter) from the detail pane, then the user's org with a key
+	tui, output = runTUI(t, data, "ticket Status pending", "\t\x1b[B\ro")
+	if len(tui.views) != 3 {
+		t.Fatalf("TestTUI: expected 3 views, got %d\n", len(tui.views))
+	}
+	submitter := tui.views[1].Records[0].(User)
+	org := tui.views[2].Records[0].(Organization)
+	if submitter.ID != tickets[0].Submitter || org.ID != submitter.Org || len(org.AssociatedUsers) != len(data.OrgUserIndex[org.ID]) {
+		t.Errorf("TestTUI: unexpected links followed: user %d, org %d\n", submitter.ID, org.ID)
+	}
+
+	// go back, and start a new search
+	tui, output = runTUI(t, data, "ticket Status pending", "sbb/\x15org Name Enthaze\r")
+	if len(tui.views) != 1 || len(tui.views[0].Records) != 1 || tui.views[0].Title != "org Name Enthaze" {
+		t.Errorf("TestTUI: unexpected views: %+v\n", tui.views)
+	}
+	if !strings.Contains(output, "Already at the search results") {
+		t.Errorf("TestTUI: going back past the search results not reported\n")
+	}
+
+	// saved queries can be run from the query bar
+	out := &bytes.Buffer{}
+	queries := &SavedQueries{Queries: map[string]string{"org-name": "org Name $1"}}
+	tui = NewTUI(data, queries, newLineEditor(strings.NewReader(":run org-name Enthaze\r"), out, nil), out)
+	if err := tui.Run(""); err != nil || len(tui.views) != 1 || len(tui.views[0].Records) != 1 {
+		t.Errorf("TestTUI: saved query not run from the query bar (error %v)\n", err)
+	}
+
+	// errors are shown in the status line, and q in the query bar is part of the query
+	tui, output = runTUI(t, data, "", "thing Name x\rq")
+	if !strings.Contains(output, "Error: Invalid search type: thing") || string(tui.query) != "thing Name xq" {
+		t.Errorf("TestTUI: unexpected handling of an invalid search: %q\n", string(tui.query))
+	}
+}
+
+func TestTUIDetailScroll(t *testing.T) {
+	data := loadTestDataset(t)
+	tickets, _ := SearchTickets("Status", "pending", data.TicketList)
+	fields := strings.Split(strings.TrimRight(formatRecordFields(tickets[0]), "\n"), "\n")
+	lastField := strings.Fields(fields[len(fields)-1])[0]
+
+	// on a short terminal the last fields of a ticket are below the detail pane, until it's scrolled down
+	run := func(keys string) (*TUI, string) {
+		out := &bytes.Buffer{}
+		tui := NewTUI(data, &SavedQueries{Queries: map[string]string{}}, newLineEditor(strings.NewReader(keys), out, nil), out)
+		tui.rows = 12
+		if err := tui.Run("ticket Status pending"); err != nil {
+			t.Fatalf("TestTUIDetailScroll: unexpected error: %v\n", err)
+		}
+		return tui, out.String()
+	}
+
+	if _, output := run(""); strings.Contains(output, lastField) {
+		t.Fatalf("TestTUIDetailScroll: %q shown without scrolling\n", lastField)
+	}
+
+	tui, output := run("\t\x1b[6~\x1b[6~\x1b[6~")
+	if tui.detailTop <= 0 || !strings.Contains(output, lastField) {
+		t.Errorf("TestTUIDetailScroll: detail pane not scrolled to its end by Page Down (first row %d)\n", tui.detailTop)
+	}
+
+	// Down scrolls the pane once the last link is selected
+	tui, _ = run("\t\x1b[B\x1b[B\x1b[B\x1b[B\x1b[B")
+	links := len(recordLinkKeys(tickets[0]))
+	if tui.link != links-1 || tui.detailTop != 5-(links-1) {
+		t.Errorf("TestTUIDetailScroll: unexpected link %d and first row %d after scrolling down\n", tui.link, tui.detailTop)
+	}
+
+	// the pane doesn't scroll past its ends, and Up scrolls it back before selecting links
+	tui, _ = run("\t\x1b[6~\x1b[6~\x1b[6~\x1b[6~\x1b[6~\x1b[5~\x1b[5~\x1b[5~\x1b[5~\x1b[5~\x1b[A")
+	if tui.detailTop != 0 || tui.link != 0 {
+		t.Errorf("TestTUIDetailScroll: unexpected link %d and first row %d after scrolling back up\n", tui.link, tui.detailTop)
+	}
+
+	// selecting another record shows it from the top
+	tui, _ = run("\t\x1b[6~\t\x1b[B")
+	if tui.detailTop != 0 {
+		t.Errorf("TestTUIDetailScroll: detail pane still scrolled after selecting another record\n")
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	if line := fitWidth("Côpeland", 4); line != "Côpe" {
+		t.Errorf("TestFitWidth: expected a truncated line, got %q\n", line)
+	}
+	if line := fitWidth("\tab", 12); line != "        ab  " {
+		t.Errorf("TestFitWidth: expected a padded line, got %q\n", line)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -------------------- data validation (referential integrity, duplicates, required fields, enums) --------------------
+
+// maximum number of example records shown for each validation issue
+const maxValidationExamples = 3
+
+// accepted values for enum-like fields. Empty values are not checked here - they are reported as missing fields if required.
+var validTicketStatuses = []string{"new", "open", "pending", "hold", "solved", "closed"}
+var validTicketPriorities = []string{"urgent", "high", "normal", "low"}
+var validTicketTypes = []string{"problem", "incident", "question", "task"}
+var validTicketVias = []string{"web", "chat", "voice", "email", "api", "mobile"}
+var validUserRoles = []string{"end-user", "agent", "admin"}
+
+// accepted values of enum-like fields, keyed by <struct name>.<field name>
+var enumFieldValues = map[string][]string{
+	"Ticket.Status":   validTicketStatuses,
+	"Ticket.Priority": validTicketPriorities,
+	"Ticket.Type":     validTicketTypes,
+	"Ticket.Via":      validTicketVias,
+	"User.Role":       validUserRoles,
+}
+
+// fields that must hold a non-zero value for each entity type
+var requiredOrgFields = []string{"ID", "Name", "URL", "Created_at"}
+var requiredUserFields = []string{"ID", "Name", "URL", "Created_at", "Role"}
+var requiredTicketFields = []string{"ID", "URL", "Created_at", "Subject", "Status", "Priority", "Submitter", "Via"}
+
+// ValidationIssue records a single kind of data problem, along with the number of records affected and a few examples
+type ValidationIssue struct {
+	Category    string // e.g. "orphaned reference", "duplicate ID"
+	Description string // e.g. "Ticket.Org references an unknown organization"
+	Count       int
+	Examples    []string
+}
+
+// ValidationReport holds all issues found across the org/user/ticket datasets
+type ValidationReport struct {
+	Issues []ValidationIssue
+}
+
+// add records an occurrence of an issue, grouping occurrences by category and description
+func (report *ValidationReport) add(category, description, example string) {
+	for i := range report.Issues {
+		if report.Issues[i].Category == category && report.Issues[i].Description == description {
+			report.Issues[i].Count++
+			if len(report.Issues[i].Examples) < maxValidationExamples {
+				report.Issues[i].Examples = append(report.Issues[i].Examples, example)
+			}
+			return
+		}
+	}
+
+	report.Issues = append(report.Issues, ValidationIssue{Category: category, Description: description, Count: 1, Examples: []string{example}})
+}
+
+// ValidateData checks orgs, users and tickets for orphaned references, duplicate IDs, missing required fields and invalid enum values
+func ValidateData(OrgList []Organization, UserList []User, TicketList []Ticket) ValidationReport {
+	report := ValidationReport{}
+
+	orgIDs := map[int]bool{}
+	for _, org := range OrgList {
+		example := fmt.Sprintf("org %d (%s)", org.ID, org.Name)
+		if orgIDs[org.ID] {
+			report.add("duplicate ID", "Organization.ID appears more than once", example)
+		}
+		orgIDs[org.ID] = true
+
+		checkRequiredFields(&report, "Organization", org, requiredOrgFields, example)
+	}
+
+	userIDs := map[int]bool{}
+	for _, user := range UserList {
+		example := fmt.Sprintf("user %d (%s)", user.ID, user.Name)
+		if userIDs[user.ID] {
+			report.add("duplicate ID", "User.ID appears more than once", example)
+		}
+		userIDs[user.ID] = true
+
+		checkRequiredFields(&report, "User", user, requiredUserFields, example)
+		checkEnumField(&report, "User.Role", user.Role, validUserRoles, example)
+	}
+
+	// user references can only be checked once all orgs are known
+	for _, user := range UserList {
+		if user.Org != 0 && !orgIDs[user.Org] {
+			report.add("orphaned reference", "User.Org references an unknown organization", fmt.Sprintf("user %d (%s) -> org %d", user.ID, user.Name, user.Org))
+		}
+	}
+
+	ticketIDs := map[string]bool{}
+	for _, ticket := range TicketList {
+		example := fmt.Sprintf("ticket %s (%s)", ticket.ID, ticket.Subject)
+		if ticketIDs[ticket.ID] {
+			report.add("duplicate ID", "Ticket.ID appears more than once", example)
+		}
+		ticketIDs[ticket.ID] = true
+
+		checkRequiredFields(&report, "Ticket", ticket, requiredTicketFields, example)
+		checkEnumField(&report, "Ticket.Status", ticket.Status, validTicketStatuses, example)
+		checkEnumField(&report, "Ticket.Priority", ticket.Priority, validTicketPriorities, example)
+		checkEnumField(&report, "Ticket.Type", ticket.Type, validTicketTypes, example)
+		checkEnumField(&report, "Ticket.Via", ticket.Via, validTicketVias, example)
+
+		if ticket.Org != 0 && !orgIDs[ticket.Org] {
+			report.add("orphaned reference", "Ticket.Org references an unknown organization", fmt.Sprintf("ticket %s -> org %d", ticket.ID, ticket.Org))
+		}
+
+		if ticket.Submitter != 0 && !userIDs[ticket.Submitter] {
+			report.add("orphaned reference", "Ticket.Submitter references an unknown user", fmt.Sprintf("ticket %s -> user %d", ticket.ID, ticket.Submitter))
+		}
+
+		if ticket.Assignee != 0 && !userIDs[ticket.Assignee] {
+			report.add("orphaned reference", "Ticket.Assignee references an unknown user", fmt.Sprintf("ticket %s -> user %d", ticket.ID, ticket.Assignee))
+		}
+	}
+
+	// list issues in a stable order so that repeated runs are easy to compare
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		if report.Issues[i].Category != report.Issues[j].Category {
+			return report.Issues[i].Category < report.Issues[j].Category
+		}
+		return report.Issues[i].Description < report.Issues[j].Description
+	})
+
+	return report
+}
+
+// checkRequiredFields reports each of the given fields that holds its zero value (i.e. was missing from the source data)
+func checkRequiredFields(report *ValidationReport, entityName string, obj interface{}, fields []string, example string) {
+	objValue := reflectValue(obj)
+
+	for _, field := range fields {
+		fieldValue := objValue.FieldByName(field)
+		if fieldValue.IsValid() && fieldValue.IsZero() {
+			report.add("missing required field", fmt.Sprintf("%s.%s is empty", entityName, field), example)
+		}
+	}
+}
+
+// checkEnumField reports a non-empty field value that is not one of the accepted values
+func checkEnumField(report *ValidationReport, fieldName, value string, validValues []string, example string) {
+	if value == "" {
+		return
+	}
+
+	for _, v := range validValues {
+		if value == v {
+			return
+		}
+	}
+
+	report.add("invalid enum value", fmt.Sprintf("%s must be one of: %s", fieldName, strings.Join(validValues, ", ")), fmt.Sprintf("%s: %q", example, value))
+}
+
+// FormatValidationReport outputs a validation report in a human-readable format
+func FormatValidationReport(report ValidationReport) string {
+	var formattedResult strings.Builder
+	formattedResult.WriteString("\nVALIDATION\n----------\n")
+
+	if len(report.Issues) <= 0 {
+		formattedResult.WriteString("<No issues found>\n")
+		return formattedResult.String()
+	}
+
+	for _, issue := range report.Issues {
+		formattedResult.WriteString(fmt.Sprintf("\n[%s] %s: %d record(s)\n", issue.Category, issue.Description, issue.Count))
+		for _, example := range issue.Examples {
+			formattedResult.WriteString(fmt.Sprintf("\te.g. %s\n", example))
+		}
+	}
+
+	return formattedResult.String()
+}
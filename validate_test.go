@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateData(t *testing.T) {
+	orgDataFile, userDataFile, ticketDataFile, err := GetAppConfig()
+	if err != nil {
+		t.Error("TestValidateData: cannot read config file.\n")
+	}
+
+	OrgList, err := ReadOrganizationData(orgDataFile)
+	if err != nil {
+		t.Error("TestValidateData: cannot get org list.\n")
+	}
+
+	UserList, err := ReadUserData(userDataFile)
+	if err != nil {
+		t.Error("TestValidateData: cannot get user list.\n")
+	}
+
+	TicketList, err := ReadTicketData(ticketDataFile)
+	if err != nil {
+		t.Error("TestValidateData: cannot get ticket list.\n")
+	}
+
+	report := ValidateData(OrgList, UserList, TicketList)
+
+	// the sample data has one ticket each with an unknown org, submitter and assignee
+	expected := map[string]int{
+		"Ticket.Org references an unknown organization": 1,
+		"Ticket.Submitter references an unknown user":   1,
+		"Ticket.Assignee references an unknown user":    1,
+	}
+
+	for _, issue := range report.Issues {
+		count, found := expected[issue.Description]
+		if found && issue.Count != count {
+			t.Errorf("TestValidateData: expected %d record(s) for %q, got %d\n", count, issue.Description, issue.Count)
+		}
+		delete(expected, issue.Description)
+
+		if issue.Category == "duplicate ID" || issue.Category == "invalid enum value" {
+			t.Errorf("TestValidateData: unexpected issue in sample data - %s: %s\n", issue.Category, issue.Description)
+		}
+	}
+
+	if len(expected) > 0 {
+		t.Errorf("TestValidateData: orphaned references not reported: %v\n", expected)
+	}
+}
+
+func TestValidateDataInvalidRecords(t *testing.T) {
+	orgs := []Organization{{ID: 101, Name: "Enthaze", URL: "u", Created_at: "c"}, {ID: 101, Name: "Copy", URL: "u", Created_at: "c"}}
+	users := []User{{ID: 1, Name: "A", URL: "u", Created_at: "c", Role: "superuser", Org: 999}}
+	tickets := []Ticket{{ID: "t1", URL: "u", Created_at: "c", Subject: "s", Status: "broken", Priority: "high", Submitter: 1, Via: "web"}}
+
+	report := ValidateData(orgs, users, tickets)
+
+	categories := map[string]int{}
+	for _, issue := range report.Issues {
+		categories[issue.Category] += issue.Count
+	}
+
+	if categories["duplicate ID"] != 1 || categories["invalid enum value"] != 2 || categories["orphaned reference"] != 1 {
+		t.Errorf("TestValidateDataInvalidRecords: incorrect issues reported: %v\n", categories)
+	}
+
+	if !strings.Contains(FormatValidationReport(report), "user 1 (A) -> org 999") {
+		t.Error("TestValidateDataInvalidRecords: example record missing from formatted report.\n")
+	}
+}
+
+func TestFormatUnresolvedReferences(t *testing.T) {
+	users := getAssociatedOrgsAndTickets([]User{{ID: 1, Org: 999}}, map[int]Organization{}, map[int][]Ticket{}, map[int][]Ticket{})
+
+	formatted := FormatUserResult(users)
+	if !strings.Contains(formatted, "<unknown org 999>") || strings.Contains(formatted, "Organization ID: 0") {
+		t.Error("TestFormatUnresolvedReferences: unresolved org not shown clearly.\n")
+	}
+}